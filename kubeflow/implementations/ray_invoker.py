@@ -43,7 +43,7 @@ def main(
         "updateinterval": "20",
         "jobparams": jobparams,
         "docker": "quay.io/ibmdpdev/ray-pod:v0.0.1",
-        "arguments": "python -u ./ray-pod.py",
+        "arguments": "/ray-pod",
         "imagepullpolicy": "Always"
     }
 
@@ -54,6 +54,10 @@ type BridgeJobSpec struct {
 	// A flag to kill an external job
 	JobKill bool `json:"kill,omitempty" description:"Kill job flag, if set pod and job on external resource are killed"`
 
+	// Action executed on the running external job, currently supported by the LSF pod.
+	// Every action is executed once, change its id to repeat the same action
+	Action *JobAction `json:"action,omitempty" description:"Action on the external job (requeue, signal, modify)"`
+
 	// struct of data related to job files
 	// +kubebuilder:validation:Required
 	JobData JobData `json:"jobdata"`
@@ -66,6 +70,14 @@ type BridgeJobSpec struct {
 
 	// struct for uploading results.
 	S3Upload Upload `json:"s3upload,omitempty"`
+
+	// HTTP client settings used by the watcher pod for accessing the external resource.
+	// If not defined, pod defaults are used
+	HTTPClient *HTTPClient `json:"httpclient,omitempty"`
+
+	// Live tailing of the remote job output to the watcher pod log (kubectl logs <job>-bridge-pod).
+	// If not defined, output is not tailed
+	Logs *Logs `json:"logs,omitempty"`
 }
 
 // Job data information
@@ -73,6 +85,7 @@ type JobData struct {
 	// Job script can get different forms depending on the external system
 	// Batch script for HPC - LSF and Slurm
 	// Python for quantum and Ray
+	// Job, Pod or PodTemplate manifest for remote Kubernetes clusters
 	// We currently support several ways to specify script:
 	//		specify location of script on the remote system - string with the location
 	//		inline script content here - the full content of the script as a string
@@ -116,6 +129,16 @@ type JobData struct {
 	// A list of S3 locations in the form of comma separated bucket:object pairs - here we assume that overall S3 information,
 	//						including URL and security is specified in S3 storage structure
 	AdditionalData string `json:"additionaldata,omitempty" description:"A list of additional files to upload to resource"`
+	// Cleanup of the script uploaded to the remote system, once the job finishes. Currently used for quantum programs,
+	// which are reused by later jobs with the same program data and metadata unless deleted, and for Jobs created
+	// in remote Kubernetes clusters, which are kept with their pods unless deleted, and for the script, submit
+	// description and input data staged to HTCondor submit nodes
+	// Possible values are:
+	//				"keep"
+	//				"delete"
+	// +kubebuilder:validation:Enum=keep;delete
+	// +kubebuilder:default:="keep"
+	ScriptCleanup string `json:"scriptcleanup,omitempty" description:"Script cleanup after job ends, keep (default) or delete"`
 }
 
 // S3 connection information
@@ -138,6 +161,72 @@ type Upload struct {
 	Files string `json:"files,omitempty" description:"String of comma separated additional files to be uploaded to S3 after job ends (.out and .err are always uploaded)"`
 }
 
+// HTTP client settings
+type HTTPClient struct {
+	// Timeout of a single request attempt
+	// +kubebuilder:default:=10
+	Timeout int `json:"timeout,omitempty" description:"Timeout of a single HTTP request attempt (in secs), default 10"`
+	// Failed requests are retried with exponential backoff and jitter. Only requests that are safe to repeat
+	// are retried on 5xx and connection errors, job submissions are retried only if not processed by the server
+	// +kubebuilder:default:=3
+	Retries int `json:"retries,omitempty" description:"Maximum number of retries, default 3"`
+	// +kubebuilder:default:=1
+	Backoff int `json:"backoff,omitempty" description:"Initial backoff between retries (in secs), default 1"`
+	// +kubebuilder:default:=30
+	MaxBackoff int `json:"maxbackoff,omitempty" description:"Maximum backoff between retries (in secs), default 30"`
+	// Secret with a custom CA bundle (ca.crt) and optional client certificate and key (tls.crt, tls.key) for mTLS.
+	// Used for both external resource and S3 access. The same keys can be also put directly into the resource secret
+	TLSSecret string `json:"tlssecret,omitempty" description:"Secret name with CA bundle and client certificate; has to be in same namespace"`
+	// Egress proxy for external resource and S3 access
+	Proxy   string `json:"proxy,omitempty" description:"Proxy URL, for example http://proxy.mycompany.com:3128"`
+	NoProxy string `json:"noproxy,omitempty" description:"Comma separated list of hosts that should not go through proxy"`
+}
+
+// Job action
+type JobAction struct {
+	// Action name
+	// Possible values are:
+	//				"requeue" - requeue the job (LSF brequeue)
+	//				"signal" - send a signal to the job (LSF bkill -s)
+	//				"modify" - modify queue or run limit of a pending job (LSF bmod)
+	// +kubebuilder:validation:Enum=requeue;signal;modify
+	Name string `json:"name" description:"Action name"`
+	// +kubebuilder:default:=""
+	ID string `json:"id,omitempty" description:"Action identifier, change it to repeat the same action"`
+	// Signal name or number, for example SIGUSR1 or 10
+	Signal string `json:"signal,omitempty" description:"Signal sent by the signal action"`
+	// Queue and run limit set by the modify action
+	Queue          string `json:"queue,omitempty" description:"New queue of the pending job"`
+	RunLimitHour   int    `json:"runlimithour,omitempty" description:"New run limit hours of the pending job"`
+	RunLimitMinute int    `json:"runlimitminute,omitempty" description:"New run limit minutes of the pending job"`
+}
+
+// Result of the job action
+type ActionStatus struct {
+	Name    string `json:"name,omitempty" description:"Action name"`
+	ID      string `json:"id,omitempty" description:"Action identifier"`
+	Result  string `json:"result,omitempty" description:"Action result, SUCCEEDED or FAILED"`
+	Message string `json:"message,omitempty" description:"Action output or failure reason"`
+	Time    string `json:"time,omitempty" description:"Time when the action was executed"`
+}
+
+// Remote job output tailing
+type Logs struct {
+	// +kubebuilder:default:=4096
+	Tail int `json:"tail,omitempty" description:"Size of the output tail shown when tailing starts (in bytes), default 4096"`
+	// +kubebuilder:default:=30
+	Interval int `json:"interval,omitempty" description:"Output polling interval (in secs), default 30"`
+}
+
+// Event of the job history in the external system
+type JobEvent struct {
+	Time     string `json:"time,omitempty" description:"Time of the event"`
+	Type     string `json:"type" description:"Event type, e.g. SUBMIT, START, SUSPEND, REQUEUE, EXIT or DONE"`
+	Text     string `json:"text,omitempty" description:"Event as reported by the external system"`
+	ExitCode *int   `json:"exitCode,omitempty" description:"Exit code of the job"`
+	Signal   string `json:"signal,omitempty" description:"Signal sent to the job"`
+}
+
 // BridgeJobStatus defines the observed state of BridgeJob
 type BridgeJobStatus struct {
 	// Current job status
@@ -152,6 +241,37 @@ type BridgeJobStatus struct {
 	// Message filled when job is finished in any state
 	// Should contain place where output files are located
 	Message string `json:"message,omitempty"`
+
+	// Result of the last action on the external job
+	Action *ActionStatus `json:"action,omitempty"`
+
+	// Job counts per state of Slurm array tasks or heterogeneous job components, e.g. "RUNNING 2, DONE 14".
+	// Updated while the job runs
+	Tasks string `json:"tasks,omitempty" description:"Job counts per state of array tasks or job components"`
+
+	// Timeline of job events from the LSF job history, reported once the job is no longer known to LSF
+	History []JobEvent `json:"history,omitempty" description:"Timeline of job events"`
+
+	// Quantum Runtime session or batch the job runs in
+	// +kubebuilder:validation:MaxLength=256
+	SessionID string `json:"sessionId,omitempty" description:"Quantum session ID"`
+
+	// Summary of the primitive results of the quantum job, reported once the job finishes
+	// +kubebuilder:validation:MaxLength=1024
+	Results string `json:"results,omitempty" description:"Summary of the job results"`
+
+	// Quantum backend selected for the job
+	Backend string `json:"backend,omitempty" description:"Quantum backend running the job"`
+
+	// Quantum program run by the job, uploaded by the pod or reused from the service
+	ProgramID string `json:"programId,omitempty" description:"Quantum program ID"`
+
+	// Summary of the latest interim result of the quantum program, updated while the job runs
+	// +kubebuilder:validation:MaxLength=1024
+	InterimResults string `json:"interimResults,omitempty" description:"Latest interim result"`
+
+	// Time of the latest interim result
+	InterimTime string `json:"interimTime,omitempty" description:"Time of the latest interim result"`
 }
 
 //+kubebuilder:object:root=true
@@ -18,8 +18,10 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
 	e "errors"
 	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
@@ -32,6 +34,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -41,7 +44,8 @@ import (
 // BridgeJobReconciler reconciles a BridgeJob object
 type BridgeJobReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
 }
 
 const (
@@ -53,6 +57,9 @@ const (
 	ROLEB_NAME     = "bridge-cm-binding"
 	//	PULL_SEC_NAME  = "artifactory"
 
+	SA_TOKEN_AUDIENCE   = "iam" // Audience of the projected service account token (IBM Cloud trusted profiles)
+	SA_TOKEN_EXPIRATION = 3600  // Expiration of the projected service account token (sec)
+
 	PENDING   = "PENDING"
 	RUNNING   = "RUNNING"
 	DONE      = "DONE"
@@ -64,6 +71,10 @@ const (
 	UNKNOWN   = "UNKNOWN"
 
 	TIME = "2006-01-02T15:04:05Z"
+
+	RESULTS_LENGTH         = 1024 // Maximal length of results summary in the status
+	SESSION_ID_LENGTH      = 256  // Maximal length of session ID in the status
+	INTERIM_RESULTS_LENGTH = 1024 // Maximal length of interim results summary in the status
 )
 
 //+kubebuilder:rbac:groups=bridgejob.ibm.com,resources=bridgejobs,verbs=get;list;watch;create;update;patch;delete
@@ -74,6 +85,7 @@ const (
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 // +kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get;list;watch;create
 // +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles,verbs=get;list;watch;create
 // +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=rolebindings,verbs=get;list;watch;create
@@ -150,13 +162,41 @@ func (r *BridgeJobReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		if errors.IsNotFound(podErr) {
 			// First validate preconditions
 			klog.Infoln("Checking Secrets for Pod.")
-			err := r.checkCredsSecret(ctx, &bridgejob, bridgejob.Spec.ResourceSecret, "username", "password")
+			// Slurm can alternatively mint tokens from the jwt key or get them from token endpoint.
+			// Quantum uses service CRN or instance with API key or trusted profile.
+			// Remote Kubernetes clusters are accessed with kubeconfig or token,
+			// PBS and HTCondor login nodes with password or private key
+			userKeys := []string{"username"}
+			passwordKeys := []string{"password"}
+			if ptype == SLURM_POD {
+				passwordKeys = append(passwordKeys, "jwtkey", "tokenurl")
+			}
+			if ptype == QUANTUM_POD {
+				userKeys = append(userKeys, "crn", "instance")
+				passwordKeys = append(passwordKeys, "apikey", "profile")
+			}
+			if ptype == PBS_POD || ptype == HTCONDOR_POD {
+				passwordKeys = append(passwordKeys, "privatekey")
+			}
+			if ptype == KUBE_POD {
+				userKeys = []string{"kubeconfig", "token"}
+				passwordKeys = userKeys
+			}
+			err := r.checkCredsSecret(ctx, &bridgejob, bridgejob.Spec.ResourceSecret, userKeys, passwordKeys...)
 			if err != nil {
 				return ctrl.Result{}, err
 			}
 			// Check for S3 ticket (if used)
 			if len(bridgejob.Spec.S3Storage.S3Secret) != 0 {
-				err := r.checkCredsSecret(ctx, &bridgejob, bridgejob.Spec.S3Storage.S3Secret, "accesskey", "secretkey")
+				err := r.checkCredsSecret(ctx, &bridgejob, bridgejob.Spec.S3Storage.S3Secret, []string{"accesskey"}, "secretkey")
+				if err != nil {
+					return ctrl.Result{}, err
+				}
+			}
+
+			// Check for TLS secret (if used)
+			if bridgejob.Spec.HTTPClient != nil && len(bridgejob.Spec.HTTPClient.TLSSecret) != 0 {
+				err := r.checkTLSSecret(ctx, &bridgejob, bridgejob.Spec.HTTPClient.TLSSecret)
 				if err != nil {
 					return ctrl.Result{}, err
 				}
@@ -236,9 +276,39 @@ func (r *BridgeJobReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		}
 	}
 
+	// Pass job action to the pod
+	if bridgejob.Spec.Action != nil {
+		request, err := json.Marshal(bridgejob.Spec.Action)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if cm.Data["action"] != string(request) {
+			if ptype != LSF_POD {
+				// Pod can not execute the action, just report it
+				cm.Data["status.action.request"] = string(request)
+				cm.Data["status.action.name"] = bridgejob.Spec.Action.Name
+				cm.Data["status.action.id"] = bridgejob.Spec.Action.ID
+				cm.Data["status.action.result"] = FAILED
+				cm.Data["status.action.message"] = fmt.Sprintf("Job actions are not supported by %s pod", ptype)
+				cm.Data["status.action.time"] = time.Now().UTC().Format(TIME)
+			}
+			cm.Data["action"] = string(request)
+			err := r.Update(ctx, cm)
+			if err != nil {
+				klog.Errorf("Updating ConfigMap with job action not successful; err %s", err.Error())
+				return ctrl.Result{}, err
+			}
+			klog.Infof("Updating ConfigMap %s with job action %s successful", bridgejob.Name+CM_NAME, bridgejob.Spec.Action.Name)
+			return ctrl.Result{}, nil
+		}
+	}
+
 	// Get execution status and update it, if it has changed
 	jobStatus := cm.Data["status.jobStatus"]
 	updated := updateCondition(&bridgejob, jobStatus, cm)
+	if r.updateAction(&bridgejob, cm) {
+		updated = true
+	}
 	if updated {
 		err := r.Status().Update(context.Background(), &bridgejob)
 		if err != nil {
@@ -268,6 +338,7 @@ func (r *BridgeJobReconciler) newConfigMapDefinition(ctx context.Context, bridge
 	cmData["jobdata.jobParameters"] = bridgejob.Spec.JobData.JobParameters
 	cmData["jobdata.scriptExtraLocation"] = bridgejob.Spec.JobData.ScriptExtraLocation
 	cmData["jobdata.additionalData"] = bridgejob.Spec.JobData.AdditionalData
+	cmData["jobdata.scriptCleanup"] = bridgejob.Spec.JobData.ScriptCleanup
 
 	// Set S3, if defined
 	if len(bridgejob.Spec.S3Storage.S3Secret) > 0 {
@@ -283,6 +354,25 @@ func (r *BridgeJobReconciler) newConfigMapDefinition(ctx context.Context, bridge
 		cmData["s3upload.files"] = bridgejob.Spec.S3Upload.Files
 	}
 
+	// HTTP client settings
+	if bridgejob.Spec.HTTPClient != nil {
+		cmData["http.timeout"] = strconv.Itoa(bridgejob.Spec.HTTPClient.Timeout)
+		cmData["http.retries"] = strconv.Itoa(bridgejob.Spec.HTTPClient.Retries)
+		cmData["http.backoff"] = strconv.Itoa(bridgejob.Spec.HTTPClient.Backoff)
+		cmData["http.maxBackoff"] = strconv.Itoa(bridgejob.Spec.HTTPClient.MaxBackoff)
+		// Proxy is only used by the pod HTTP transport, not by its Kubernetes client
+		if len(bridgejob.Spec.HTTPClient.Proxy) > 0 {
+			cmData["http.proxy"] = bridgejob.Spec.HTTPClient.Proxy
+			cmData["http.noProxy"] = bridgejob.Spec.HTTPClient.NoProxy
+		}
+	}
+
+	// Output tailing
+	if bridgejob.Spec.Logs != nil {
+		cmData["logs.tail"] = strconv.Itoa(bridgejob.Spec.Logs.Tail)
+		cmData["logs.interval"] = strconv.Itoa(bridgejob.Spec.Logs.Interval)
+	}
+
 	// There is already status
 	if len(bridgejob.Status.JobStatus) > 0 {
 		cmData["status.startTime"] = bridgejob.Status.StartTime
@@ -321,15 +411,15 @@ func (r *BridgeJobReconciler) addS3Data(ctx context.Context, bridgejob *bridgeop
 	return nil
 }
 
-// Ensure that required secret exists and formatted properly
-func (r *BridgeJobReconciler) checkCredsSecret(ctx context.Context, bridgejob *bridgeoperatorv1alpha1.BridgeJob, secretname, u, p string) error {
+// Ensure that required secret exists and formatted properly. Secret has to contain one of user keys and one of password keys
+func (r *BridgeJobReconciler) checkCredsSecret(ctx context.Context, bridgejob *bridgeoperatorv1alpha1.BridgeJob, secretname string, u []string, p ...string) error {
 	secret := &apiv1.Secret{}
 	secretErr := r.Get(ctx, types.NamespacedName{Name: secretname, Namespace: bridgejob.Namespace}, secret)
 
 	if secretErr != nil {
 		return r.failCR(ctx, bridgejob, secretname, secretErr)
 	} else {
-		secErr := checkSecretContent(secret, u, p)
+		secErr := checkSecretContent(secret, u, p...)
 		if secErr != nil {
 			return r.failCR(ctx, bridgejob, secretname, secErr)
 		}
@@ -338,15 +428,42 @@ func (r *BridgeJobReconciler) checkCredsSecret(ctx context.Context, bridgejob *b
 }
 
 // Validate secret content
-func checkSecretContent(secret *apiv1.Secret, u, p string) error {
-	username := secret.Data[u]
-	password := secret.Data[p]
-	if len(string(username)) == 0 || len(string(password)) == 0 {
+func checkSecretContent(secret *apiv1.Secret, u []string, p ...string) error {
+	if !hasSecretKey(secret, u...) || !hasSecretKey(secret, p...) {
 		return fmt.Errorf("secret %s with credentials missing data", secret.Name)
 	}
 	return nil
 }
 
+// Check that secret contains a non empty value of one of keys
+func hasSecretKey(secret *apiv1.Secret, keys ...string) bool {
+	for _, key := range keys {
+		if len(secret.Data[key]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Ensure that TLS secret exists and contains either CA bundle or client certificate and key
+func (r *BridgeJobReconciler) checkTLSSecret(ctx context.Context, bridgejob *bridgeoperatorv1alpha1.BridgeJob, secretname string) error {
+	secret := &apiv1.Secret{}
+	secretErr := r.Get(ctx, types.NamespacedName{Name: secretname, Namespace: bridgejob.Namespace}, secret)
+	if secretErr != nil {
+		return r.failCR(ctx, bridgejob, secretname, secretErr)
+	}
+	ca := len(secret.Data["ca.crt"]) > 0
+	cert := len(secret.Data["tls.crt"]) > 0
+	key := len(secret.Data["tls.key"]) > 0
+	if cert != key {
+		return r.failCR(ctx, bridgejob, secretname, fmt.Errorf("secret %s has to contain both tls.crt and tls.key", secretname))
+	}
+	if !ca && !cert {
+		return r.failCR(ctx, bridgejob, secretname, fmt.Errorf("secret %s missing ca.crt or tls.crt/tls.key", secretname))
+	}
+	return nil
+}
+
 // Ensure that RBAC for Pod execution exists
 func (r *BridgeJobReconciler) checkRBAC(ctx context.Context, bridgejob *bridgeoperatorv1alpha1.BridgeJob) error {
 	// Service account
@@ -481,6 +598,16 @@ func (r *BridgeJobReconciler) newPodDefinition(ctx context.Context, bridgejob *b
 		r.mountS3Creds(ctx, bridgejob, pod)
 	}
 
+	// See if we need TLS settings
+	if bridgejob.Spec.HTTPClient != nil && len(bridgejob.Spec.HTTPClient.TLSSecret) > 0 {
+		r.setConnection(ctx, bridgejob, pod)
+	}
+
+	// Quantum pod can exchange service account token for the IAM token of a trusted profile
+	if getPodType(bridgejob) == QUANTUM_POD {
+		mountServiceAccountToken(pod)
+	}
+
 	// Set owner reference
 	if err := controllerutil.SetControllerReference(bridgejob, pod, r.Scheme); err != nil {
 		return nil, err
@@ -488,6 +615,53 @@ func (r *BridgeJobReconciler) newPodDefinition(ctx context.Context, bridgejob *b
 	return pod, nil
 }
 
+// Mount TLS secret
+func (r *BridgeJobReconciler) setConnection(ctx context.Context, bridgejob *bridgeoperatorv1alpha1.BridgeJob, pod *apiv1.Pod) {
+	volume := apiv1.Volume{
+		Name: "tls",
+		VolumeSource: apiv1.VolumeSource{
+			Secret: &apiv1.SecretVolumeSource{
+				SecretName: bridgejob.Spec.HTTPClient.TLSSecret,
+			},
+		},
+	}
+	volumeMount := apiv1.VolumeMount{
+		Name:      "tls",
+		MountPath: "/tls",
+		ReadOnly:  true,
+	}
+	pod.Spec.Volumes = append(pod.Spec.Volumes, volume)
+	pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, volumeMount)
+}
+
+// Mount projected service account token, used as compute resource token for IBM Cloud IAM
+func mountServiceAccountToken(pod *apiv1.Pod) {
+	expiration := int64(SA_TOKEN_EXPIRATION)
+	volume := apiv1.Volume{
+		Name: "sa-token",
+		VolumeSource: apiv1.VolumeSource{
+			Projected: &apiv1.ProjectedVolumeSource{
+				Sources: []apiv1.VolumeProjection{
+					{
+						ServiceAccountToken: &apiv1.ServiceAccountTokenProjection{
+							Audience:          SA_TOKEN_AUDIENCE,
+							ExpirationSeconds: &expiration,
+							Path:              "sa-token",
+						},
+					},
+				},
+			},
+		},
+	}
+	volumeMount := apiv1.VolumeMount{
+		Name:      "sa-token",
+		MountPath: "/var/run/secrets/tokens",
+		ReadOnly:  true,
+	}
+	pod.Spec.Volumes = append(pod.Spec.Volumes, volume)
+	pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, volumeMount)
+}
+
 // Mount S3 credentials
 func (r *BridgeJobReconciler) mountS3Creds(ctx context.Context, bridgejob *bridgeoperatorv1alpha1.BridgeJob, pod *apiv1.Pod) {
 
@@ -515,8 +689,9 @@ func updateCondition(bridgejob *bridgeoperatorv1alpha1.BridgeJob, status string,
 	if len(status) == 0 {
 		return false
 	}
+	updated := updateDetails(bridgejob, cm)
 	if bridgejob.Status.JobStatus == status {
-		return false
+		return updated
 	}
 
 	// Update status
@@ -530,6 +705,15 @@ func updateCondition(bridgejob *bridgeoperatorv1alpha1.BridgeJob, status string,
 		// Get pod type
 		ptype := getPodType(bridgejob)
 
+		// Report HTTP retries done by the pod
+		retries, err := strconv.Atoi(cm.Data["metrics.httpRetries"])
+		if err == nil && retries > 0 {
+			podshttpretries.Add(float64(retries))
+			if ptype != UNKNOWN_POD {
+				counters[ptype][POD_HTTPRETRIES].Add(float64(retries))
+			}
+		}
+
 		// Report usage
 		if status == DONE || status == SUCCEEDED {
 
@@ -564,6 +748,76 @@ func updateCondition(bridgejob *bridgeoperatorv1alpha1.BridgeJob, status string,
 	return true
 }
 
+// Update details of the job reported by the pod while it runs
+func updateDetails(bridgejob *bridgeoperatorv1alpha1.BridgeJob, cm *apiv1.ConfigMap) bool {
+	if cm == nil {
+		return false
+	}
+	updated := false
+	set := func(field *string, key string) {
+		if *field != cm.Data[key] {
+			*field = cm.Data[key]
+			updated = true
+		}
+	}
+	// Values cut to the length allowed by the CRD, so that the status update is not rejected
+	setBounded := func(field *string, key string, length int) {
+		value := cm.Data[key]
+		if len(value) > length {
+			value = value[:length-3] + "..."
+		}
+		if *field != value {
+			*field = value
+			updated = true
+		}
+	}
+	set(&bridgejob.Status.Tasks, "status.tasks")
+	set(&bridgejob.Status.Backend, "status.backend")
+	set(&bridgejob.Status.ProgramID, "status.programId")
+	setBounded(&bridgejob.Status.SessionID, "status.sessionId", SESSION_ID_LENGTH)
+	setBounded(&bridgejob.Status.Results, "status.results", RESULTS_LENGTH)
+	setBounded(&bridgejob.Status.InterimResults, "status.interimResults", INTERIM_RESULTS_LENGTH)
+	set(&bridgejob.Status.InterimTime, "status.interimTime")
+
+	if timeline := cm.Data["status.history"]; len(timeline) > 0 {
+		history := []bridgeoperatorv1alpha1.JobEvent{}
+		if err := json.Unmarshal([]byte(timeline), &history); err != nil {
+			klog.Error("Invalid job history; err ", err)
+		} else if !reflect.DeepEqual(bridgejob.Status.History, history) {
+			bridgejob.Status.History = history
+			updated = true
+		}
+	}
+	return updated
+}
+
+// Update result of the job action executed by the pod and record it as an event
+func (r *BridgeJobReconciler) updateAction(bridgejob *bridgeoperatorv1alpha1.BridgeJob, cm *apiv1.ConfigMap) bool {
+	if len(cm.Data["status.action.result"]) == 0 {
+		return false
+	}
+	action := bridgeoperatorv1alpha1.ActionStatus{
+		Name:    cm.Data["status.action.name"],
+		ID:      cm.Data["status.action.id"],
+		Result:  cm.Data["status.action.result"],
+		Message: cm.Data["status.action.message"],
+		Time:    cm.Data["status.action.time"],
+	}
+	if bridgejob.Status.Action != nil && *bridgejob.Status.Action == action {
+		return false
+	}
+	bridgejob.Status.Action = &action
+
+	if r.Recorder != nil {
+		if action.Result == SUCCEEDED {
+			r.Recorder.Eventf(bridgejob, apiv1.EventTypeNormal, "ActionSucceeded", "Job action %s succeeded: %s", action.Name, action.Message)
+		} else {
+			r.Recorder.Eventf(bridgejob, apiv1.EventTypeWarning, "ActionFailed", "Job action %s failed: %s", action.Name, action.Message)
+		}
+	}
+	return true
+}
+
 // Fail CR for kubernetes issues
 func (r *BridgeJobReconciler) failCR(ctx context.Context, bridgejob *bridgeoperatorv1alpha1.BridgeJob, objectname string, e error) error {
 	_ = updateCondition(bridgejob, FAILED, nil)
@@ -627,5 +881,15 @@ func getPodType(bridgejob *bridgeoperatorv1alpha1.BridgeJob) string {
 	if strings.Contains(pod_image, QUANTUM_POD) {
 		return QUANTUM_POD
 	}
+	if strings.Contains(pod_image, PBS_POD) {
+		return PBS_POD
+	}
+	if strings.Contains(pod_image, HTCONDOR_POD) {
+		return HTCONDOR_POD
+	}
+	// kube alone is part of many image names
+	if strings.Contains(pod_image, KUBE_POD+"-pod") {
+		return KUBE_POD
+	}
 	return UNKNOWN_POD
 }
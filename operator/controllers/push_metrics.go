@@ -6,17 +6,21 @@ import (
 )
 
 const (
-	LSF_POD     = "lsf"
-	SLURM_POD   = "slurm"
-	RAY_POD     = "ray"
-	QUANTUM_POD = "quantum"
-	UNKNOWN_POD = "unknown"
+	LSF_POD      = "lsf"
+	SLURM_POD    = "slurm"
+	RAY_POD      = "ray"
+	QUANTUM_POD  = "quantum"
+	KUBE_POD     = "kube"
+	PBS_POD      = "pbs"
+	HTCONDOR_POD = "htcondor"
+	UNKNOWN_POD  = "unknown"
 
 	POD_CREATED      = "created"
 	POD_FAILED       = "failed"
 	POD_KILLED       = "killed"
 	POD_JOBFAILED    = "jobfailed"
 	POD_JOBCOMPLETED = "jobcompleted"
+	POD_HTTPRETRIES  = "httpretries"
 )
 
 var (
@@ -50,6 +54,24 @@ var (
 			Help: "Number of created quantum pods",
 		},
 	)
+	kube_podscreated = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kube_pods_created_total",
+			Help: "Number of created kube pods",
+		},
+	)
+	pbs_podscreated = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "pbs_pods_created_total",
+			Help: "Number of created pbs pods",
+		},
+	)
+	htcondor_podscreated = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "htcondor_pods_created_total",
+			Help: "Number of created htcondor pods",
+		},
+	)
 	podsfailed = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Name: "pods_failed_total",
@@ -80,6 +102,24 @@ var (
 			Help: "Number of failed quantum pods",
 		},
 	)
+	kube_podsfailed = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kube_pods_failed_total",
+			Help: "Number of failed kube pods",
+		},
+	)
+	pbs_podsfailed = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "pbs_pods_failed_total",
+			Help: "Number of failed pbs pods",
+		},
+	)
+	htcondor_podsfailed = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "htcondor_pods_failed_total",
+			Help: "Number of failed htcondor pods",
+		},
+	)
 	podskilled = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Name: "pods_killed_total",
@@ -110,6 +150,24 @@ var (
 			Help: "Number of killed quantum pods",
 		},
 	)
+	kube_podskilled = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kube_pods_killed_total",
+			Help: "Number of killed kube pods",
+		},
+	)
+	pbs_podskilled = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "pbs_pods_killed_total",
+			Help: "Number of killed pbs pods",
+		},
+	)
+	htcondor_podskilled = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "htcondor_pods_killed_total",
+			Help: "Number of killed htcondor pods",
+		},
+	)
 	podsjobfailed = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Name: "pods_job_failed_total",
@@ -140,6 +198,24 @@ var (
 			Help: "Number of failed remote quantum jobs",
 		},
 	)
+	kube_podsjobfailed = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kube_pods_job_failed_total",
+			Help: "Number of failed remote kube jobs",
+		},
+	)
+	pbs_podsjobfailed = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "pbs_pods_job_failed_total",
+			Help: "Number of failed remote pbs jobs",
+		},
+	)
+	htcondor_podsjobfailed = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "htcondor_pods_job_failed_total",
+			Help: "Number of failed remote htcondor jobs",
+		},
+	)
 	podsjobcompleted = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Name: "pods_job_completed_total",
@@ -170,6 +246,72 @@ var (
 			Help: "Number of completed remote quantum jobs",
 		},
 	)
+	kube_podsjobcompleted = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kube_pods_job_completed_total",
+			Help: "Number of completed remote kube jobs",
+		},
+	)
+	pbs_podsjobcompleted = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "pbs_pods_job_completed_total",
+			Help: "Number of completed remote pbs jobs",
+		},
+	)
+	htcondor_podsjobcompleted = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "htcondor_pods_job_completed_total",
+			Help: "Number of completed remote htcondor jobs",
+		},
+	)
+	podshttpretries = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "pods_http_retries_total",
+			Help: "Number of HTTP requests to remote systems retried by pods",
+		},
+	)
+	lsf_podshttpretries = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "lsf_pods_http_retries_total",
+			Help: "Number of HTTP requests retried by lsf pods",
+		},
+	)
+	slurm_podshttpretries = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "slurm_pods_http_retries_total",
+			Help: "Number of HTTP requests retried by slurm pods",
+		},
+	)
+	ray_podshttpretries = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ray_pods_http_retries_total",
+			Help: "Number of HTTP requests retried by ray pods",
+		},
+	)
+	quantum_podshttpretries = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "quantum_pods_http_retries_total",
+			Help: "Number of HTTP requests retried by quantum pods",
+		},
+	)
+	kube_podshttpretries = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kube_pods_http_retries_total",
+			Help: "Number of HTTP requests retried by kube pods",
+		},
+	)
+	pbs_podshttpretries = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "pbs_pods_http_retries_total",
+			Help: "Number of HTTP requests retried by pbs pods",
+		},
+	)
+	htcondor_podshttpretries = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "htcondor_pods_http_retries_total",
+			Help: "Number of HTTP requests retried by htcondor pods",
+		},
+	)
 	podsjobduration = prometheus.NewGauge(
 		prometheus.GaugeOpts{
 			Name: "pods_job_duration_total",
@@ -200,6 +342,24 @@ var (
 			Help: "Overall duration of remote quantum jobs in mins",
 		},
 	)
+	kube_podsjobduration = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "kube_pods_job_duration_total",
+			Help: "Overall duration of remote kube jobs in mins",
+		},
+	)
+	pbs_podsjobduration = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "pbs_pods_job_duration_total",
+			Help: "Overall duration of remote pbs jobs in mins",
+		},
+	)
+	htcondor_podsjobduration = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "htcondor_pods_job_duration_total",
+			Help: "Overall duration of remote htcondor jobs in mins",
+		},
+	)
 
 	lsf_podcounters = map[string]prometheus.Counter{
 		POD_CREATED:      lsf_podscreated,
@@ -207,6 +367,7 @@ var (
 		POD_KILLED:       lsf_podskilled,
 		POD_JOBFAILED:    lsf_podsjobfailed,
 		POD_JOBCOMPLETED: lsf_podsjobcompleted,
+		POD_HTTPRETRIES:  lsf_podshttpretries,
 	}
 	slurm_podcounters = map[string]prometheus.Counter{
 		POD_CREATED:      slurm_podscreated,
@@ -214,6 +375,7 @@ var (
 		POD_KILLED:       slurm_podskilled,
 		POD_JOBFAILED:    slurm_podsjobfailed,
 		POD_JOBCOMPLETED: slurm_podsjobcompleted,
+		POD_HTTPRETRIES:  slurm_podshttpretries,
 	}
 	ray_podcounters = map[string]prometheus.Counter{
 		POD_CREATED:      ray_podscreated,
@@ -221,6 +383,7 @@ var (
 		POD_KILLED:       ray_podskilled,
 		POD_JOBFAILED:    ray_podsjobfailed,
 		POD_JOBCOMPLETED: ray_podsjobcompleted,
+		POD_HTTPRETRIES:  ray_podshttpretries,
 	}
 	quantum_podcounters = map[string]prometheus.Counter{
 		POD_CREATED:      quantum_podscreated,
@@ -228,31 +391,63 @@ var (
 		POD_KILLED:       quantum_podskilled,
 		POD_JOBFAILED:    quantum_podsjobfailed,
 		POD_JOBCOMPLETED: quantum_podsjobcompleted,
+		POD_HTTPRETRIES:  quantum_podshttpretries,
+	}
+	kube_podcounters = map[string]prometheus.Counter{
+		POD_CREATED:      kube_podscreated,
+		POD_FAILED:       kube_podsfailed,
+		POD_KILLED:       kube_podskilled,
+		POD_JOBFAILED:    kube_podsjobfailed,
+		POD_JOBCOMPLETED: kube_podsjobcompleted,
+		POD_HTTPRETRIES:  kube_podshttpretries,
+	}
+	pbs_podcounters = map[string]prometheus.Counter{
+		POD_CREATED:      pbs_podscreated,
+		POD_FAILED:       pbs_podsfailed,
+		POD_KILLED:       pbs_podskilled,
+		POD_JOBFAILED:    pbs_podsjobfailed,
+		POD_JOBCOMPLETED: pbs_podsjobcompleted,
+		POD_HTTPRETRIES:  pbs_podshttpretries,
+	}
+	htcondor_podcounters = map[string]prometheus.Counter{
+		POD_CREATED:      htcondor_podscreated,
+		POD_FAILED:       htcondor_podsfailed,
+		POD_KILLED:       htcondor_podskilled,
+		POD_JOBFAILED:    htcondor_podsjobfailed,
+		POD_JOBCOMPLETED: htcondor_podsjobcompleted,
+		POD_HTTPRETRIES:  htcondor_podshttpretries,
 	}
 
 	counters = map[string]map[string]prometheus.Counter{
-		LSF_POD:     lsf_podcounters,
-		SLURM_POD:   slurm_podcounters,
-		RAY_POD:     ray_podcounters,
-		QUANTUM_POD: quantum_podcounters,
+		LSF_POD:      lsf_podcounters,
+		SLURM_POD:    slurm_podcounters,
+		RAY_POD:      ray_podcounters,
+		QUANTUM_POD:  quantum_podcounters,
+		KUBE_POD:     kube_podcounters,
+		PBS_POD:      pbs_podcounters,
+		HTCONDOR_POD: htcondor_podcounters,
 	}
 
 	gauges = map[string]prometheus.Gauge{
-		LSF_POD:     lsf_podsjobduration,
-		SLURM_POD:   slurm_podsjobduration,
-		RAY_POD:     ray_podsjobduration,
-		QUANTUM_POD: quantum_podsjobduration,
+		LSF_POD:      lsf_podsjobduration,
+		SLURM_POD:    slurm_podsjobduration,
+		RAY_POD:      ray_podsjobduration,
+		QUANTUM_POD:  quantum_podsjobduration,
+		KUBE_POD:     kube_podsjobduration,
+		PBS_POD:      pbs_podsjobduration,
+		HTCONDOR_POD: htcondor_podsjobduration,
 	}
 )
 
 func init() {
 	// Register custom metrics with the global prometheus registry
 	metrics.Registry.MustRegister(
-		podscreated, lsf_podscreated, slurm_podscreated, ray_podscreated, quantum_podscreated,
-		podsfailed, lsf_podsfailed, slurm_podsfailed, ray_podsfailed, quantum_podsfailed,
-		podskilled, lsf_podskilled, slurm_podskilled, ray_podskilled, quantum_podskilled,
-		podsjobfailed, lsf_podsjobfailed, slurm_podsjobfailed, ray_podsjobfailed, quantum_podsjobfailed,
-		podsjobcompleted, lsf_podsjobcompleted, slurm_podsjobcompleted, ray_podsjobcompleted, quantum_podsjobcompleted,
-		podsjobduration, lsf_podsjobduration, slurm_podsjobduration, ray_podsjobduration, quantum_podsjobduration,
+		podscreated, lsf_podscreated, slurm_podscreated, ray_podscreated, quantum_podscreated, kube_podscreated, pbs_podscreated, htcondor_podscreated,
+		podsfailed, lsf_podsfailed, slurm_podsfailed, ray_podsfailed, quantum_podsfailed, kube_podsfailed, pbs_podsfailed, htcondor_podsfailed,
+		podskilled, lsf_podskilled, slurm_podskilled, ray_podskilled, quantum_podskilled, kube_podskilled, pbs_podskilled, htcondor_podskilled,
+		podsjobfailed, lsf_podsjobfailed, slurm_podsjobfailed, ray_podsjobfailed, quantum_podsjobfailed, kube_podsjobfailed, pbs_podsjobfailed, htcondor_podsjobfailed,
+		podsjobcompleted, lsf_podsjobcompleted, slurm_podsjobcompleted, ray_podsjobcompleted, quantum_podsjobcompleted, kube_podsjobcompleted, pbs_podsjobcompleted, htcondor_podsjobcompleted,
+		podshttpretries, lsf_podshttpretries, slurm_podshttpretries, ray_podshttpretries, quantum_podshttpretries, kube_podshttpretries, pbs_podshttpretries, htcondor_podshttpretries,
+		podsjobduration, lsf_podsjobduration, slurm_podsjobduration, ray_podsjobduration, quantum_podsjobduration, kube_podsjobduration, pbs_podsjobduration, htcondor_podsjobduration,
 	)
 }
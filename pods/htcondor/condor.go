@@ -0,0 +1,306 @@
+//=============================================================================
+// HTCondor commands
+// Jobs are submitted by condor_submit with a generated submit description, queried by condor_q
+// and, once they left the queue, condor_history in JSON format and removed by condor_rm.
+// All jobs of a submission form one cluster, whose ID is the ID of the BridgeJob.
+// Job properties are mapped to submit commands:
+//		condorJobName                    batch_name, job name by default
+//		universe                         universe, vanilla by default
+//		arguments                        arguments
+//		CpusPerNode (or Tasks)           request_cpus
+//		Memory, GpusPerNode, Disk        request_memory, request_gpus, request_disk
+//		requirements, accountingGroup    requirements, accounting_group
+//		RunLimitHour, RunLimitMinute     periodic_remove of jobs running longer
+//		OutputFileName, ErrorFileName    output, error; <name>.<cluster>.<process>.out/err by default
+//		streamOutput                     stream_output and stream_error, outputs can be tailed
+//		count                            number of jobs in the cluster (queue <count>)
+//		submitCommands                   further submit commands, added as they are
+//		currentWorkingDir                directory the job is submitted from
+//=============================================================================
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTCondor job status (JobStatus attribute)
+const (
+	CONDOR_IDLE         = 1
+	CONDOR_RUNNING      = 2
+	CONDOR_REMOVED      = 3
+	CONDOR_COMPLETED    = 4
+	CONDOR_HELD         = 5
+	CONDOR_TRANSFERRING = 6
+	CONDOR_SUSPENDED    = 7
+)
+
+// Job attributes queried by condor_q and condor_history
+var ATTRIBUTES = []string{"ClusterId", "ProcId", "JobStatus", "ExitCode", "ExitBySignal", "ExitSignal",
+	"HoldReason", "RemoveReason", "JobStartDate", "CompletionDate", "EnteredCurrentStatus", "Out", "Err", "Iwd"}
+
+// Job (process of the cluster) as reported by condor_q -json
+type Proc struct {
+	ClusterId            int
+	ProcId               int
+	JobStatus            int
+	ExitCode             *int
+	ExitBySignal         bool
+	ExitSignal           int
+	HoldReason           string
+	RemoveReason         string
+	JobStartDate         int64
+	CompletionDate       int64
+	EnteredCurrentStatus int64
+	Out                  string
+	Err                  string
+	Iwd                  string
+}
+
+// ID of the job, <cluster>.<process>
+func (p *Proc) ID() string {
+	return fmt.Sprintf("%d.%d", p.ClusterId, p.ProcId)
+}
+
+// Build submit description of the job, running executable with input files transferred to the execute node
+func submitDescription(props map[string]string, executable string, inputs []string) string {
+	lines := []string{fmt.Sprintf("# Submitted by bridge operator for %s/%s", NAMESPACE, JOB_NAME)}
+	command := func(name string, value string) {
+		if len(value) > 0 {
+			lines = append(lines, name+" = "+value)
+		}
+	}
+	universe := props["universe"]
+	if len(universe) == 0 {
+		universe = "vanilla"
+	}
+	name := props["condorJobName"]
+	if len(name) == 0 {
+		name = JOB_NAME
+	}
+	command("universe", universe)
+	command("executable", executable)
+	command("arguments", props["arguments"])
+	command("batch_name", name)
+	cpus := props["CpusPerNode"]
+	if len(cpus) == 0 {
+		cpus = props["Tasks"]
+	}
+	command("request_cpus", cpus)
+	command("request_memory", props["Memory"])
+	command("request_gpus", props["GpusPerNode"])
+	command("request_disk", props["Disk"])
+	command("requirements", props["requirements"])
+	command("accounting_group", props["accountingGroup"])
+	if limit := runLimit(props); limit > 0 {
+		command("periodic_remove", fmt.Sprintf("(JobStatus == %d) && (time() - JobCurrentStartDate > %d)", CONDOR_RUNNING, limit))
+	}
+	command("should_transfer_files", "YES")
+	command("when_to_transfer_output", "ON_EXIT")
+	command("transfer_input_files", strings.Join(inputs, ","))
+	output := props["OutputFileName"]
+	if len(output) == 0 {
+		output = JOB_NAME + ".$(Cluster).$(Process).out"
+	}
+	errors := props["ErrorFileName"]
+	if len(errors) == 0 {
+		errors = JOB_NAME + ".$(Cluster).$(Process).err"
+	}
+	command("output", output)
+	command("error", errors)
+	command("log", JOB_NAME+".log")
+	if props["streamOutput"] == "true" {
+		command("stream_output", "True")
+		command("stream_error", "True")
+	}
+	if extra := strings.TrimSpace(props["submitCommands"]); len(extra) > 0 {
+		lines = append(lines, extra)
+	}
+	count := props["count"]
+	if n, err := strconv.Atoi(count); err != nil || n < 1 {
+		count = "1"
+	}
+	lines = append(lines, "queue "+count)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Run limit of the job (sec)
+func runLimit(props map[string]string) int {
+	hours, _ := strconv.Atoi(props["RunLimitHour"])
+	minutes, _ := strconv.Atoi(props["RunLimitMinute"])
+	if hours < 0 || minutes < 0 {
+		return 0
+	}
+	return (hours*60 + minutes) * 60
+}
+
+// Parse cluster ID from condor_submit -terse output (<cluster>.<first proc> - <cluster>.<last proc>)
+func parseClusterID(output []byte) (string, error) {
+	fields := strings.Fields(string(output))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("condor_submit returned no job ID")
+	}
+	cluster := strings.SplitN(fields[0], ".", 2)[0]
+	if _, err := strconv.Atoi(cluster); err != nil {
+		return "", fmt.Errorf("unexpected condor_submit output %s", strings.TrimSpace(string(output)))
+	}
+	return cluster, nil
+}
+
+// Parse condor_q/condor_history JSON output. Nothing is printed if there are no jobs
+func parseProcs(output []byte) ([]Proc, error) {
+	procs := []Proc{}
+	if len(strings.TrimSpace(string(output))) == 0 {
+		return procs, nil
+	}
+	if err := json.Unmarshal(output, &procs); err != nil {
+		return nil, fmt.Errorf("failed to parse job status; err %s", err.Error())
+	}
+	return procs, nil
+}
+
+// Merge jobs in the queue with jobs in history, the queue takes precedence. Jobs are sorted by process
+func mergeProcs(queue []Proc, history []Proc) []Proc {
+	procs := map[int]Proc{}
+	for _, p := range history {
+		procs[p.ProcId] = p
+	}
+	for _, p := range queue {
+		procs[p.ProcId] = p
+	}
+	merged := []Proc{}
+	for _, p := range procs {
+		merged = append(merged, p)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].ProcId < merged[j].ProcId })
+	return merged
+}
+
+// Get state of a job of the cluster. Removed jobs are killed if kill was requested, failed otherwise
+func procState(p *Proc, killRequested bool) string {
+	switch p.JobStatus {
+	case CONDOR_IDLE:
+		return PENDING
+	case CONDOR_RUNNING, CONDOR_TRANSFERRING:
+		return RUNNING
+	case CONDOR_HELD, CONDOR_SUSPENDED:
+		return SUSPENDED
+	case CONDOR_COMPLETED:
+		if p.ExitBySignal || p.ExitCode == nil || *p.ExitCode != 0 {
+			return FAILED
+		}
+		return DONE
+	case CONDOR_REMOVED:
+		if killRequested {
+			return KILL
+		}
+		return FAILED
+	}
+	return UNKNOWN
+}
+
+// Get state of the cluster: running while any job runs, pending while any job waits, suspended if jobs are held.
+// Once all jobs finish, it is DONE only if all of them are DONE, otherwise KILL if any was removed on kill, or FAILED
+func jobState(procs []Proc, killRequested bool) string {
+	counts := map[string]int{}
+	for i := range procs {
+		counts[procState(&procs[i], killRequested)]++
+	}
+	for _, state := range []string{RUNNING, PENDING, SUSPENDED, UNKNOWN} {
+		if counts[state] > 0 {
+			return state
+		}
+	}
+	if counts[DONE] == len(procs) {
+		return DONE
+	}
+	if counts[KILL] > 0 {
+		return KILL
+	}
+	return FAILED
+}
+
+// Number of jobs of the cluster in every state
+func taskSummary(procs []Proc, killRequested bool) string {
+	counts := map[string]int{}
+	for i := range procs {
+		counts[procState(&procs[i], killRequested)]++
+	}
+	summary := []string{}
+	for _, state := range []string{PENDING, RUNNING, SUSPENDED, DONE, FAILED, KILL, UNKNOWN} {
+		if counts[state] > 0 {
+			summary = append(summary, fmt.Sprintf("%s %d", state, counts[state]))
+		}
+	}
+	return strings.Join(summary, ", ")
+}
+
+// Describe held and unsuccessful jobs of the cluster
+func procMessage(procs []Proc) string {
+	msgs := []string{}
+	for _, p := range procs {
+		switch p.JobStatus {
+		case CONDOR_HELD:
+			msgs = append(msgs, fmt.Sprintf("%s held: %s", p.ID(), p.HoldReason))
+		case CONDOR_REMOVED:
+			msg := p.ID() + " removed"
+			if len(p.RemoveReason) > 0 {
+				msg += ": " + p.RemoveReason
+			}
+			msgs = append(msgs, msg)
+		case CONDOR_COMPLETED:
+			if p.ExitBySignal {
+				msgs = append(msgs, fmt.Sprintf("%s killed by signal %d", p.ID(), p.ExitSignal))
+			} else if p.ExitCode != nil && *p.ExitCode != 0 {
+				msgs = append(msgs, fmt.Sprintf("%s exited with code %d", p.ID(), *p.ExitCode))
+			}
+		}
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Start time of the first and end time of the last job of the cluster
+func jobTimes(procs []Proc) (string, string) {
+	var start, end int64
+	for _, p := range procs {
+		if p.JobStartDate > 0 && (start == 0 || p.JobStartDate < start) {
+			start = p.JobStartDate
+		}
+		finish := p.CompletionDate
+		if finish == 0 && p.JobStatus == CONDOR_REMOVED {
+			finish = p.EnteredCurrentStatus
+		}
+		if finish > end {
+			end = finish
+		}
+	}
+	return formatTime(start), formatTime(end)
+}
+
+// Convert epoch time to operator time
+func formatTime(t int64) string {
+	if t <= 0 {
+		return ""
+	}
+	return time.Unix(t, 0).UTC().Format(TIME)
+}
+
+// Output files of a job, relative to its initial directory unless absolute
+func outputFiles(p *Proc) []string {
+	files := []string{}
+	for _, f := range []string{p.Out, p.Err} {
+		if len(f) == 0 || f == "/dev/null" {
+			continue
+		}
+		if !strings.HasPrefix(f, "/") && len(p.Iwd) > 0 {
+			f = strings.TrimSuffix(p.Iwd, "/") + "/" + f
+		}
+		files = append(files, f)
+	}
+	return files
+}
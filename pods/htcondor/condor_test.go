@@ -0,0 +1,143 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const queueOutput = `[
+{
+  "ClusterId": 42,
+  "ProcId": 1,
+  "JobStatus": 5,
+  "HoldReason": "Error from slot1@node1: Failed to open input file",
+  "EnteredCurrentStatus": 1697709600,
+  "Out": "condorjob.42.1.out",
+  "Err": "/dev/null",
+  "Iwd": "/home/user/bridge/default/condorjob"
+}
+]
+`
+
+const historyOutput = `[
+{
+  "ClusterId": 42,
+  "ProcId": 0,
+  "JobStatus": 4,
+  "ExitCode": 0,
+  "ExitBySignal": false,
+  "JobStartDate": 1697709600,
+  "CompletionDate": 1697713200,
+  "Out": "condorjob.42.0.out",
+  "Err": "condorjob.42.0.err",
+  "Iwd": "/home/user/bridge/default/condorjob"
+},
+{
+  "ClusterId": 42,
+  "ProcId": 1,
+  "JobStatus": 3,
+  "RemoveReason": "via condor_rm (by user user)",
+  "JobStartDate": 1697709000,
+  "EnteredCurrentStatus": 1697713500,
+  "Out": "condorjob.42.1.out",
+  "Err": "/dev/null",
+  "Iwd": "/home/user/bridge/default/condorjob"
+}
+]
+`
+
+// Typed resources are mapped to request commands, inputs are transferred to the execute node
+func TestSubmitDescription(t *testing.T) {
+	JOB_NAME, NAMESPACE = "condorjob", "default"
+	props := map[string]string{
+		"CpusPerNode":    "4",
+		"Tasks":          "8",
+		"Memory":         "8GB",
+		"GpusPerNode":    "1",
+		"RunLimitHour":   "1",
+		"RunLimitMinute": "30",
+		"streamOutput":   "true",
+		"count":          "3",
+		"submitCommands": "+ProjectName = \"bridge\"",
+	}
+	description := submitDescription(props, SCRIPT_NAME, []string{"data.csv", "model.bin"})
+	for _, line := range []string{
+		"universe = vanilla",
+		"executable = script",
+		"batch_name = condorjob",
+		"request_cpus = 4",
+		"request_memory = 8GB",
+		"request_gpus = 1",
+		"periodic_remove = (JobStatus == 2) && (time() - JobCurrentStartDate > 5400)",
+		"transfer_input_files = data.csv,model.bin",
+		"output = condorjob.$(Cluster).$(Process).out",
+		"log = condorjob.log",
+		"stream_error = True",
+		"+ProjectName = \"bridge\"",
+	} {
+		if !strings.Contains(description, line+"\n") {
+			t.Errorf("missing %s in description:\n%s", line, description)
+		}
+	}
+	if !strings.HasSuffix(description, "\nqueue 3\n") {
+		t.Errorf("unexpected queue in description:\n%s", description)
+	}
+	description = submitDescription(map[string]string{"Tasks": "2", "count": "many"}, "/home/user/run.sh", nil)
+	if !strings.Contains(description, "request_cpus = 2\n") || strings.Contains(description, "transfer_input_files") ||
+		strings.Contains(description, "periodic_remove") || !strings.HasSuffix(description, "\nqueue 1\n") {
+		t.Errorf("unexpected description:\n%s", description)
+	}
+}
+
+func TestParseClusterID(t *testing.T) {
+	if id, err := parseClusterID([]byte("42.0 - 42.2\n")); err != nil || id != "42" {
+		t.Errorf("unexpected cluster %s; err %v", id, err)
+	}
+	if _, err := parseClusterID([]byte("ERROR: on Line 3 of submit file\n")); err == nil {
+		t.Error("expected error")
+	}
+}
+
+// Jobs in the queue take precedence over history, the cluster is aggregated over its jobs
+func TestJobState(t *testing.T) {
+	queue, err := parseProcs([]byte(queueOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := parseProcs([]byte(historyOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	procs := mergeProcs(queue, history)
+	if len(procs) != 2 || procs[0].ProcId != 0 || procs[1].JobStatus != CONDOR_HELD {
+		t.Fatalf("unexpected jobs %+v", procs)
+	}
+	if state := jobState(procs, false); state != SUSPENDED {
+		t.Errorf("expected %s, got %s", SUSPENDED, state)
+	}
+	if msg := procMessage(procs); msg != "42.1 held: "+queue[0].HoldReason {
+		t.Errorf("unexpected message %s", msg)
+	}
+
+	if state := jobState(history, true); state != KILL {
+		t.Errorf("expected %s, got %s", KILL, state)
+	}
+	if state := jobState(history, false); state != FAILED {
+		t.Errorf("expected %s, got %s", FAILED, state)
+	}
+	if summary := taskSummary(history, true); summary != "DONE 1, KILL 1" {
+		t.Errorf("unexpected summary %s", summary)
+	}
+	if state := jobState(history[:1], false); state != DONE {
+		t.Errorf("expected %s, got %s", DONE, state)
+	}
+	if start, end := jobTimes(history); start != "2023-10-19T09:50:00Z" || end != "2023-10-19T11:05:00Z" {
+		t.Errorf("unexpected times %s, %s", start, end)
+	}
+	if files := outputFiles(&history[1]); len(files) != 1 || files[0] != "/home/user/bridge/default/condorjob/condorjob.42.1.out" {
+		t.Errorf("unexpected output files %v", files)
+	}
+	if procs, err := parseProcs([]byte("\n")); err != nil || len(procs) != 0 {
+		t.Errorf("unexpected jobs %+v; err %v", procs, err)
+	}
+}
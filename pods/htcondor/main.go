@@ -0,0 +1,480 @@
+//=============================================================================
+// Code for managing jobs deployed on HTCondor pools
+//=============================================================================
+
+package main
+
+import (
+	"encoding/json"
+	e "errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ibm/bridge-operator/podutils"
+
+	"k8s.io/klog"
+)
+
+const (
+	TIME = "2006-01-02T15:04:05Z"
+
+	// Job states reported to the operator
+	SUBMITTED = "SUBMITTED"
+	PENDING   = "PENDING"
+	RUNNING   = "RUNNING"
+	SUSPENDED = "SUSPENDED"
+	DONE      = "DONE"
+	KILL      = "KILL"
+	FAILED    = "FAILED"
+	UNKNOWN   = "UNKNOWN"
+
+	MAX_MISSES = 10 // Number of polls the cluster can be missing in the queue and history
+
+	CREDS_DIR   = "/credentials/"
+	FILES_DIR   = "/downloads/"
+	SCRIPT_NAME = "script"
+)
+
+var SSH *podutils.SSHClient
+var JOB_NAME string
+var NAMESPACE string
+var POLL int
+var S3 string
+var JobProp map[string]string
+
+var tailed = map[string]bool{} // Jobs of the cluster whose outputs are tailed
+
+// Parse job properties, values that are not strings are kept as JSON
+func parseJobProperties(properties string) (map[string]string, error) {
+	props := map[string]string{}
+	if len(strings.TrimSpace(properties)) == 0 {
+		return props, nil
+	}
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(properties), &raw); err != nil {
+		return props, err
+	}
+	for k, v := range raw {
+		var str string
+		if json.Unmarshal(v, &str) == nil {
+			props[k] = str
+		} else {
+			props[k] = strings.TrimSpace(string(v))
+		}
+	}
+	return props, nil
+}
+
+// Directory the job is submitted from, relative to home on the submit node unless absolute
+func workDir() string {
+	if dir := strings.TrimSuffix(JobProp["currentWorkingDir"], "/"); len(dir) > 0 {
+		return dir
+	}
+	return "bridge/" + NAMESPACE + "/" + JOB_NAME
+}
+
+// Name of the generated submit description
+func submitFile() string {
+	return JOB_NAME + ".sub"
+}
+
+// Stage additional data (comma separated bucket:object list) into the working directory.
+// Returns names of the staged files, transferred to the execute node as input files
+func stageInputs(data map[string]string) ([]string, error) {
+	inputs := []string{}
+	for _, f := range strings.Split(data["jobdata.additionalData"], ",") {
+		f = strings.TrimSpace(f)
+		if len(f) == 0 {
+			continue
+		}
+		if len(S3) == 0 {
+			return nil, e.New("input data requested, but S3 storage is not configured")
+		}
+		pair := strings.SplitN(f, ":", 2)
+		if len(pair) != 2 || len(pair[0]) == 0 || len(pair[1]) == 0 {
+			return nil, fmt.Errorf("invalid input data location %s, expected bucket:object", f)
+		}
+		name := path.Base(pair[1])
+		content := podutils.DownloadS3Data(pair[0], pair[1], data)
+		if err := SSH.PushFile(workDir()+"/"+name, []byte(content)); err != nil {
+			return nil, fmt.Errorf("failed to stage %s; err %s", f, err.Error())
+		}
+		klog.Info("Staged input ", f)
+		inputs = append(inputs, name)
+	}
+	return inputs, nil
+}
+
+// Submit job, returns its cluster ID and message
+func submit(data map[string]string) (string, string) {
+	inputs, err := stageInputs(data)
+	if err != nil {
+		klog.Error("Failed to stage input data; err ", err)
+		return "", "Failed to stage input data: " + err.Error()
+	}
+
+	// Stage the script, unless it is already on the submit node
+	executable := data["jobdata.jobScript"]
+	if data["jobdata.scriptLocation"] != "remote" {
+		script := data["jobdata.jobScript"]
+		if data["jobdata.scriptLocation"] == "s3" {
+			s3info := strings.Split(script, ":")
+			if len(s3info) != 2 {
+				return "", "Invalid S3 location of job script " + script
+			}
+			script = podutils.DownloadS3Data(s3info[0], s3info[1], data)
+		}
+		if err := SSH.PushFile(workDir()+"/"+SCRIPT_NAME, []byte(script)); err != nil {
+			klog.Error("Failed to stage job script; err ", err)
+			return "", "Failed to stage job script: " + err.Error()
+		}
+		executable = SCRIPT_NAME
+	}
+
+	description := submitDescription(JobProp, executable, inputs)
+	if err := SSH.PushFile(workDir()+"/"+submitFile(), []byte(description)); err != nil {
+		klog.Error("Failed to stage submit description; err ", err)
+		return "", "Failed to stage submit description: " + err.Error()
+	}
+	klog.Info("Submitting job with description:\n", description)
+
+	output, err := SSH.Run("cd "+podutils.ShellQuote(workDir())+" && condor_submit -terse "+podutils.ShellQuote(submitFile()), nil)
+	if err != nil {
+		klog.Error("Submitting job not successful; err ", err)
+		return "", "Failed to submit a job to HTCondor: " + err.Error()
+	}
+	id, err := parseClusterID(output)
+	if err != nil {
+		klog.Error("Submitting job not successful; err ", err)
+		return "", err.Error()
+	}
+	klog.Info("Successfully submitted a job with cluster id ", id)
+	return id, ""
+}
+
+// Get jobs of the cluster. Jobs in the queue are completed from history once none of them is active.
+// Returns no jobs if the cluster is not known to the schedd
+func getProcs(id string) ([]Proc, error) {
+	attributes := " -json -attributes " + strings.Join(ATTRIBUTES, ",") + " " + podutils.ShellQuote(id)
+	output, err := SSH.Run("condor_q"+attributes, nil)
+	if err != nil {
+		return nil, err
+	}
+	queue, err := parseProcs(output)
+	if err != nil {
+		return nil, err
+	}
+	if len(queue) > 0 && !finished(jobState(queue, false)) {
+		return queue, nil
+	}
+	output, err = SSH.Run("condor_history"+attributes, nil)
+	if err != nil {
+		return nil, err
+	}
+	history, err := parseProcs(output)
+	if err != nil {
+		return nil, err
+	}
+	return mergeProcs(queue, history), nil
+}
+
+// Kill the job, removing all jobs of the cluster
+func killJob(id string, state string) {
+	if finished(state) {
+		klog.Info("Job ", id, " is already in finished state ", state)
+		return
+	}
+	if _, err := SSH.Run("condor_rm "+podutils.ShellQuote(id), nil); err != nil {
+		klog.Info("Job ", id, " is not killed; err ", err, ". Continue in monitoring, will try to kill again.")
+		return
+	}
+	// The jobs are reported as removed once they leave the execute nodes
+	klog.Info("Job ", id, " removed")
+}
+
+func finished(state string) bool {
+	return state == DONE || state == KILL || state == FAILED
+}
+
+// Start tailing outputs of the cluster jobs not tailed yet, once they run. Outputs are only available
+// on the submit node while the job runs when streamed
+func tailProcs(procs []Proc, data map[string]string) {
+	if JobProp["streamOutput"] != "true" {
+		return
+	}
+	streams := []podutils.LogStream{}
+	for i := range procs {
+		if procs[i].JobStatus != CONDOR_RUNNING || tailed[procs[i].ID()] {
+			continue
+		}
+		tailed[procs[i].ID()] = true
+		for j, f := range outputFiles(&procs[i]) {
+			name := procs[i].ID() + " stdout"
+			if j > 0 {
+				name = procs[i].ID() + " stderr"
+			}
+			filename := f
+			streams = append(streams, podutils.LogStream{Name: name, Fetch: func() ([]byte, error) {
+				return SSH.FetchFile(filename)
+			}, FetchFrom: func(offset int64) ([]byte, int64, error) {
+				return SSH.FetchFileFrom(filename, offset)
+			}})
+		}
+	}
+	podutils.TailLogs(data, streams...)
+}
+
+// Files of the output sandbox: files in the working directory created or changed after submission,
+// including files transferred back from the execute nodes. Paths are relative to the working directory
+func sandboxFiles(dir string) ([]string, error) {
+	output, err := SSH.Run("cd "+podutils.ShellQuote(dir)+" && find . -type f -newer "+podutils.ShellQuote(submitFile()), nil)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, f := range strings.Split(string(output), "\n") {
+		if f = strings.TrimPrefix(strings.TrimSpace(f), "./"); len(f) > 0 {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// Upload the output sandbox, outputs of the jobs, listed result files and the submit description
+// to <bucket>/<jobname>/. Uploaded objects are reported in the status message
+func uploadOutputs(procs []Proc, data map[string]string, info map[string]string) {
+	// Skip if S3 info is not provided
+	if len(S3) == 0 || len(data["s3upload.bucket"]) == 0 {
+		return
+	}
+	dir := workDir()
+	if len(procs) > 0 && len(procs[0].Iwd) > 0 {
+		dir = procs[0].Iwd
+	}
+
+	// Objects to upload, by name relative to the job prefix
+	files := map[string]string{submitFile(): dir + "/" + submitFile()}
+	names := []string{submitFile()}
+	add := func(name string, file string) {
+		if _, ok := files[name]; !ok {
+			files[name] = file
+			names = append(names, name)
+		}
+	}
+	sandbox, err := sandboxFiles(dir)
+	if err != nil {
+		klog.Info("Failed to list output sandbox in ", dir, "; err ", err)
+	}
+	for _, f := range sandbox {
+		add(f, dir+"/"+f)
+	}
+	for i := range procs {
+		for _, f := range outputFiles(&procs[i]) {
+			add(strings.TrimPrefix(strings.TrimPrefix(f, dir), "/"), f)
+		}
+	}
+	for _, f := range strings.Split(data["s3upload.files"], ",") {
+		if f = strings.TrimSpace(f); len(f) > 0 {
+			if strings.HasPrefix(f, "/") {
+				add(path.Base(f), f)
+			} else {
+				add(f, dir+"/"+f)
+			}
+		}
+	}
+
+	// Load to S3, one by one so that a failure does not prevent uploading the rest
+	prefix := JOB_NAME + "/"
+	uploaded := []string{}
+	for _, name := range names {
+		content, err := SSH.FetchFile(files[name])
+		if err != nil {
+			klog.Info("Error downloading file ", files[name], ", this file won't be uploaded to S3; err ", err.Error())
+			continue
+		}
+		local := filepath.Join(FILES_DIR, name)
+		if err := os.MkdirAll(filepath.Dir(local), 0755); err != nil {
+			klog.Info("Error saving file ", files[name], ", this file won't be uploaded to S3; err ", err.Error())
+			continue
+		}
+		if err := os.WriteFile(local, content, 0644); err != nil {
+			klog.Info("Error saving file ", files[name], ", this file won't be uploaded to S3; err ", err.Error())
+			continue
+		}
+		object := podutils.UploadFileLocation{Name: prefix + name, Path: local}
+		if err := podutils.UploadS3DataDisk(data, []podutils.UploadFileLocation{object}); err == nil {
+			uploaded = append(uploaded, object.Name)
+		}
+	}
+	if len(uploaded) == 0 {
+		return
+	}
+	msg := fmt.Sprintf("Uploaded to S3 bucket %s: %s", data["s3upload.bucket"], strings.Join(uploaded, ", "))
+	if len(info["status.message"]) > 0 {
+		msg = info["status.message"] + "; " + msg
+	}
+	info["status.message"] = msg
+}
+
+// Delete the files staged for the job: script, submit description and input data
+func cleanup(data map[string]string) {
+	files := []string{submitFile()}
+	if data["jobdata.scriptLocation"] != "remote" {
+		files = append(files, SCRIPT_NAME)
+	}
+	for _, f := range strings.Split(data["jobdata.additionalData"], ",") {
+		if pair := strings.SplitN(strings.TrimSpace(f), ":", 2); len(pair) == 2 && len(pair[1]) > 0 {
+			files = append(files, path.Base(pair[1]))
+		}
+	}
+	command := "cd " + podutils.ShellQuote(workDir()) + " && rm -f --"
+	for _, f := range files {
+		command += " " + podutils.ShellQuote(f)
+	}
+	if _, err := SSH.Run(command, nil); err != nil {
+		klog.Info("Failed to delete staged files; err ", err)
+	}
+}
+
+// Monitoring job execution
+// Method that runs constantly monitoring HTCondor cluster
+func monitor(info map[string]string) {
+	id := info["id"]
+	misses := 0
+	// Run forever
+	for {
+		// Sleep before next run
+		time.Sleep(time.Duration(POLL) * time.Second)
+
+		// Get current config map
+		cm := podutils.GetConfigMap()
+		killRequested := cm.Data["kill"] == "true"
+
+		// Get current execution status and update config map
+		var state = ""
+		procs, err := getProcs(id)
+		if err != nil {
+			klog.Info("Failed to get job ", id, "; err ", err)
+			continue
+		}
+		if len(procs) > 0 {
+			misses = 0
+			tailProcs(procs, cm.Data)
+			state = jobState(procs, killRequested)
+			info["status.jobStatus"] = state
+			info["status.tasks"] = taskSummary(procs, killRequested)
+			info["status.message"] = procMessage(procs)
+			start, end := jobTimes(procs)
+			if len(start) > 0 {
+				info["status.startTime"] = start
+			}
+			if finished(state) {
+				info["status.endTime"] = end
+				if len(end) == 0 {
+					info["status.endTime"] = time.Now().Format(TIME)
+				}
+				podutils.FlushLogs()
+				uploadOutputs(procs, cm.Data, info)
+				if cm.Data["jobdata.scriptCleanup"] == "delete" {
+					cleanup(cm.Data)
+				}
+			} else if killRequested {
+				killJob(id, state)
+			}
+			podutils.UpdateConfigMap(cm, info)
+		} else {
+			misses++
+			if misses >= MAX_MISSES {
+				state = UNKNOWN
+				info["status.jobStatus"] = UNKNOWN
+				info["status.endTime"] = time.Now().Format(TIME)
+				info["status.message"] = fmt.Sprintf("HTCondor cluster %s not found in queue or history", id)
+				podutils.UpdateConfigMap(cm, info)
+				os.Exit(1)
+			}
+		}
+		// Terminate if we are done
+		if state == DONE {
+			os.Exit(0)
+		}
+		if state == KILL || state == FAILED {
+			os.Exit(1)
+		}
+	}
+}
+
+// Main method
+func main() {
+
+	// Get namespace and job name from environment
+	NAMESPACE = os.Getenv("NAMESPACE")
+	JOB_NAME = os.Getenv("JOBNAME")
+
+	// Initialize utils
+	podutils.InitUtils(JOB_NAME, NAMESPACE)
+
+	// Get config map and its parameters
+	cm := podutils.GetConfigMap()
+	podutils.SetHTTPSettings(cm.Data)
+	SSH = podutils.NewSSHClient(cm.Data["resourceURL"], CREDS_DIR)
+	POLL, _ = strconv.Atoi(cm.Data["updateInterval"])
+	S3 = cm.Data["s3.secret"]
+	var err error
+	JobProp, err = parseJobProperties(cm.Data["jobproperties"])
+	if err != nil {
+		klog.Info("Error in JobProperties provided ", err)
+	}
+
+	// Check access to the submit node
+	if err := SSH.Connect(); err != nil {
+		klog.Exit("Failed to connect to HTCondor submit node ", SSH.Address, "; err ", err)
+	}
+
+	// Get ID from config map
+	id := cm.Data["id"]
+
+	// create info for keeping track of execution parameters
+	info := make(map[string]string)
+	info["status.startTime"] = cm.Data["status.startTime"]
+	info["status.endTime"] = ""
+	info["status.message"] = ""
+
+	// If an ID is present in the config map it means that that we have already started a job
+	if len(id) == 0 {
+		klog.Info("HTCondor Job with name ", JOB_NAME, " does not exist. Submitting new job.")
+
+		var msg string
+		id, msg = submit(cm.Data)
+		info["status.message"] = msg
+
+		if len(id) == 0 {
+			// Failed to submit a job
+			info["status.jobStatus"] = FAILED
+			info["status.endTime"] = time.Now().Format(TIME)
+		} else {
+			info["id"] = id
+			info["status.jobStatus"] = SUBMITTED
+			info["status.startTime"] = time.Now().Format(TIME)
+			info["status.submitTime"] = info["status.startTime"]
+		}
+
+		podutils.UpdateConfigMap(cm, info)
+
+		// Start monitoring or exit
+		if len(id) != 0 {
+			monitor(info)
+		} else {
+			klog.Exit("Failed to start HTCondor job")
+		}
+	} else {
+		// Job is already running
+		klog.Info("HTCondor Job has associated ID in ConfigMap. Handling state.")
+		info["id"] = id
+		monitor(info)
+	}
+}
@@ -0,0 +1,110 @@
+//=============================================================================
+// Access to the remote Kubernetes cluster
+// Credentials are read from the resource secret:
+//		kubeconfig - kubeconfig of the remote cluster, its current context (or context key) is used
+//		token      - bearer token, used with the API server given by resourceURL if there is no kubeconfig
+//		ca.crt     - CA bundle of the API server for token access, system roots are used if not set
+//		namespace  - namespace of the jobs, the one of the kubeconfig context or default if not set
+// The client is rebuilt from the secret when the cluster rejects its credentials, so rotated secrets are picked up
+//=============================================================================
+
+package main
+
+import (
+	e "errors"
+	"os"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"k8s.io/klog"
+)
+
+var clusterLock sync.Mutex
+var cluster *kubernetes.Clientset // Client of the remote cluster, nil until built from the secret
+
+// Read optional credential from the resource secret
+func readCred(key string) string {
+	content, err := os.ReadFile(CREDS_DIR + key)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// Build REST config and default namespace of the remote cluster from the resource secret
+func clusterConfig() (*rest.Config, string, error) {
+	namespace := readCred("namespace")
+	if kubeconfig := readCred("kubeconfig"); len(kubeconfig) > 0 {
+		config, err := clientcmd.Load([]byte(kubeconfig))
+		if err != nil {
+			return nil, "", err
+		}
+		overrides := &clientcmd.ConfigOverrides{CurrentContext: readCred("context")}
+		if len(RESOURCE_URL) > 0 {
+			overrides.ClusterInfo.Server = RESOURCE_URL
+		}
+		clientConfig := clientcmd.NewDefaultClientConfig(*config, overrides)
+		restConfig, err := clientConfig.ClientConfig()
+		if err != nil {
+			return nil, "", err
+		}
+		if len(namespace) == 0 {
+			namespace, _, _ = clientConfig.Namespace()
+		}
+		return restConfig, namespace, nil
+	}
+
+	if len(readCred("token")) == 0 {
+		return nil, "", e.New("resource secret has neither kubeconfig nor token")
+	}
+	if len(RESOURCE_URL) == 0 {
+		return nil, "", e.New("API server of the remote cluster (resourceURL) missing")
+	}
+	restConfig := &rest.Config{Host: RESOURCE_URL, BearerTokenFile: CREDS_DIR + "token"}
+	if ca := readCred("ca.crt"); len(ca) > 0 {
+		restConfig.TLSClientConfig.CAData = []byte(ca)
+	}
+	return restConfig, namespace, nil
+}
+
+// Get client of the remote cluster
+func remoteClient() (*kubernetes.Clientset, error) {
+	clusterLock.Lock()
+	defer clusterLock.Unlock()
+	if cluster != nil {
+		return cluster, nil
+	}
+	config, namespace, err := clusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	if len(REMOTE_NAMESPACE) == 0 {
+		REMOTE_NAMESPACE = namespace
+		if len(REMOTE_NAMESPACE) == 0 {
+			REMOTE_NAMESPACE = "default"
+		}
+	}
+	klog.Info("Connected to remote cluster ", config.Host, ", namespace ", REMOTE_NAMESPACE)
+	cluster = client
+	return cluster, nil
+}
+
+// Check error returned by the remote cluster, the client is rebuilt on the next call if credentials were rejected
+func checkError(err error) error {
+	if errors.IsUnauthorized(err) {
+		klog.Info("Remote cluster rejected credentials, reloading them from the secret")
+		clusterLock.Lock()
+		cluster = nil
+		clusterLock.Unlock()
+	}
+	return err
+}
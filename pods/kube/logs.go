@@ -0,0 +1,101 @@
+//=============================================================================
+// Job outputs
+// Container logs of the job pods are tailed to the pod log while the job runs. Once it finishes,
+// the logs and the final job manifest are uploaded to S3 under the job name
+//=============================================================================
+
+package main
+
+import (
+	"context"
+	"sort"
+
+	"github.com/ibm/bridge-operator/podutils"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"k8s.io/klog"
+)
+
+var tailed = map[string]bool{} // Pod containers whose logs are tailed
+
+// List pods of the job, in creation order
+func jobPods(job *batchv1.Job) ([]corev1.Pod, error) {
+	client, err := remoteClient()
+	if err != nil {
+		return nil, err
+	}
+	selector := metav1.FormatLabelSelector(job.Spec.Selector)
+	pods, err := client.CoreV1().Pods(job.Namespace).List(context.Background(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, checkError(err)
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].CreationTimestamp.Before(&pods.Items[j].CreationTimestamp)
+	})
+	return pods.Items, nil
+}
+
+// Get log of pod container
+func containerLog(namespace string, pod string, container string) ([]byte, error) {
+	client, err := remoteClient()
+	if err != nil {
+		return nil, err
+	}
+	log, err := client.CoreV1().Pods(namespace).GetLogs(pod, &corev1.PodLogOptions{Container: container}).DoRaw(context.Background())
+	return log, checkError(err)
+}
+
+// Start tailing containers of job pods not tailed yet. Pods are only tailed once they started
+func tailPods(pods []corev1.Pod, data map[string]string) {
+	streams := []podutils.LogStream{}
+	for _, pod := range pods {
+		if pod.Status.Phase == corev1.PodPending {
+			continue
+		}
+		for _, c := range pod.Spec.Containers {
+			name := pod.Name + "/" + c.Name
+			if tailed[name] {
+				continue
+			}
+			tailed[name] = true
+			namespace, podName, container := pod.Namespace, pod.Name, c.Name
+			streams = append(streams, podutils.LogStream{Name: name, Fetch: func() ([]byte, error) {
+				return containerLog(namespace, podName, container)
+			}})
+		}
+	}
+	podutils.TailLogs(data, streams...)
+}
+
+// Upload container logs of all job pods and the job manifest to S3
+func uploadOutputs(job *batchv1.Job, data map[string]string, info map[string]string) {
+	if len(S3) == 0 || len(data["s3upload.bucket"]) == 0 {
+		return
+	}
+	files := []podutils.UploadFile{}
+	if manifest, err := yaml.Marshal(job); err == nil {
+		files = append(files, podutils.UploadFile{Name: "job.yaml", Content: string(manifest)})
+	}
+	pods, err := jobPods(job)
+	if err != nil {
+		klog.Info("Failed to list job pods; err ", err)
+	}
+	for _, pod := range pods {
+		for _, c := range pod.Spec.Containers {
+			log, err := containerLog(pod.Namespace, pod.Name, c.Name)
+			if err != nil {
+				klog.Info("Failed to get log of ", pod.Name, "/", c.Name, "; err ", err)
+				continue
+			}
+			files = append(files, podutils.UploadFile{Name: "logs/" + pod.Name + "/" + c.Name + ".log", Content: string(log)})
+		}
+	}
+	if len(info["status.message"]) == 0 {
+		info["status.message"] = "Job logs can be found at S3 location specified"
+	}
+	podutils.UploadS3Data(data, info, files)
+}
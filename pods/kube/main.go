@@ -0,0 +1,337 @@
+//=============================================================================
+// Code for managing jobs deployed on remote Kubernetes clusters
+//=============================================================================
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ibm/bridge-operator/podutils"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/klog"
+)
+
+const (
+	TIME = "2006-01-02T15:04:05Z"
+
+	// Job states reported to the operator
+	SUBMITTED = "SUBMITTED"
+	PENDING   = "PENDING"
+	RUNNING   = "RUNNING"
+	SUSPENDED = "SUSPENDED"
+	DONE      = "DONE"
+	KILL      = "KILL"
+	FAILED    = "FAILED"
+	UNKNOWN   = "UNKNOWN"
+
+	MAX_MISSES = 10 // Number of polls the job can be missing in the remote cluster
+
+	CREDS_DIR = "/credentials/"
+)
+
+var RESOURCE_URL string
+var JOB_NAME string
+var NAMESPACE string
+var REMOTE_NAMESPACE string
+var POLL int
+var S3 string
+var PROPS *JobProperties
+
+// Submit job, returns its ID (namespace/name) and message
+func submit(data map[string]string) (string, string) {
+	if data["jobdata.scriptLocation"] == "remote" {
+		return "", "Remote script location is not supported for Kubernetes jobs, use inline or s3"
+	}
+	manifest := data["jobdata.jobScript"]
+	if data["jobdata.scriptLocation"] == "s3" {
+		s3info := strings.Split(manifest, ":")
+		if len(s3info) != 2 {
+			return "", "Invalid S3 location of job manifest " + manifest
+		}
+		manifest = podutils.DownloadS3Data(s3info[0], s3info[1], data)
+	}
+	paramContent := data["jobdata.jobParameters"]
+	if data["jobdata.scriptExtraLocation"] == "s3" && len(paramContent) > 0 {
+		s3info := strings.Split(paramContent, ":")
+		if len(s3info) != 2 {
+			return "", "Invalid S3 location of job parameters " + paramContent
+		}
+		paramContent = podutils.DownloadS3Data(s3info[0], s3info[1], data)
+	}
+	params, err := parseParameters(paramContent)
+	if err != nil {
+		return "", err.Error()
+	}
+	job, err := buildJob(manifest, params, PROPS)
+	if err != nil {
+		klog.Error("Failed to build job; err ", err)
+		return "", err.Error()
+	}
+
+	client, err := remoteClient()
+	if err != nil {
+		klog.Error("Failed to connect to remote cluster; err ", err)
+		return "", "Failed to connect to remote cluster: " + err.Error()
+	}
+	namespace := job.Namespace
+	if len(namespace) == 0 {
+		namespace = REMOTE_NAMESPACE
+	}
+	created, err := client.BatchV1().Jobs(namespace).Create(context.Background(), job, metav1.CreateOptions{})
+	if err != nil {
+		checkError(err)
+		klog.Error("Failed to create job; err ", err)
+		return "", "Failed to create job in remote cluster: " + err.Error()
+	}
+	klog.Info("Successfully created job ", created.Namespace, "/", created.Name)
+	return created.Namespace + "/" + created.Name, ""
+}
+
+// Get job. Returns nil if the job is not known to the remote cluster
+func getJob(id string) (*batchv1.Job, error) {
+	client, err := remoteClient()
+	if err != nil {
+		return nil, err
+	}
+	namespace, name := splitID(id)
+	job, err := client.BatchV1().Jobs(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, checkError(err)
+	}
+	return job, nil
+}
+
+// Delete job with its pods
+func deleteJob(id string) error {
+	client, err := remoteClient()
+	if err != nil {
+		return err
+	}
+	namespace, name := splitID(id)
+	propagation := metav1.DeletePropagationBackground
+	err = client.BatchV1().Jobs(namespace).Delete(context.Background(), name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return checkError(err)
+}
+
+// Split job ID to namespace and name
+func splitID(id string) (string, string) {
+	if i := strings.Index(id, "/"); i >= 0 {
+		return id[:i], id[i+1:]
+	}
+	return REMOTE_NAMESPACE, id
+}
+
+// Get job state from its conditions and pods
+func jobState(job *batchv1.Job, pods []corev1.Pod) string {
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			return DONE
+		case batchv1.JobFailed:
+			return FAILED
+		}
+	}
+	if job.Spec.Suspend != nil && *job.Spec.Suspend {
+		return SUSPENDED
+	}
+	for _, pod := range pods {
+		if pod.Status.Phase == corev1.PodRunning {
+			return RUNNING
+		}
+	}
+	return PENDING
+}
+
+// Get end time and message of finished job
+func jobResult(job *batchv1.Job) (string, string) {
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue || (c.Type != batchv1.JobComplete && c.Type != batchv1.JobFailed) {
+			continue
+		}
+		end := c.LastTransitionTime
+		if job.Status.CompletionTime != nil {
+			end = *job.Status.CompletionTime
+		}
+		msg := c.Message
+		if len(c.Reason) > 0 && c.Type == batchv1.JobFailed {
+			msg = strings.TrimSpace(c.Reason + " " + c.Message)
+		}
+		return end.UTC().Format(TIME), msg
+	}
+	return time.Now().Format(TIME), ""
+}
+
+func finished(state string) bool {
+	return state == DONE || state == KILL || state == FAILED
+}
+
+// Kill the job. Outputs are collected first, as deleting the job removes its pods
+func killJob(id string, job *batchv1.Job, data map[string]string, info map[string]string) bool {
+	uploadOutputs(job, data, info)
+	if err := deleteJob(id); err != nil {
+		klog.Info("Job ", id, " is not killed; err ", err, ". Continue in monitoring, will try to kill again.")
+		return false
+	}
+	klog.Info("Job ", id, " killed successfully.")
+	info["status.jobStatus"] = KILL
+	info["status.endTime"] = time.Now().Format(TIME)
+	return true
+}
+
+// Monitoring job execution
+// Method that runs constantly monitoring the remote job
+func monitor(info map[string]string) {
+	id := info["id"]
+	misses := 0
+	// Run forever
+	for {
+		// Sleep before next run
+		time.Sleep(time.Duration(POLL) * time.Second)
+
+		// Get current config map
+		cm := podutils.GetConfigMap()
+
+		// Get current execution status and update config map
+		var state = ""
+		job, err := getJob(id)
+		if err != nil {
+			klog.Info("Failed to get job ", id, "; err ", err)
+			continue
+		}
+		if job != nil {
+			misses = 0
+			pods, err := jobPods(job)
+			if err != nil {
+				klog.Info("Failed to list pods of job ", id, "; err ", err)
+			}
+			tailPods(pods, cm.Data)
+			state = jobState(job, pods)
+			info["status.jobStatus"] = state
+			info["status.pods"] = fmt.Sprintf("active %d, succeeded %d, failed %d", job.Status.Active, job.Status.Succeeded, job.Status.Failed)
+			if job.Status.StartTime != nil {
+				info["status.startTime"] = job.Status.StartTime.UTC().Format(TIME)
+			}
+			if finished(state) {
+				info["status.endTime"], info["status.message"] = jobResult(job)
+				podutils.FlushLogs()
+				uploadOutputs(job, cm.Data, info)
+				if cm.Data["jobdata.scriptCleanup"] == "delete" {
+					if err := deleteJob(id); err != nil {
+						klog.Info("Failed to delete job ", id, "; err ", err)
+					}
+				}
+			} else if cm.Data["kill"] == "true" {
+				podutils.FlushLogs()
+				if killJob(id, job, cm.Data, info) {
+					state = KILL
+				}
+			}
+			podutils.UpdateConfigMap(cm, info)
+		} else {
+			misses++
+			if misses >= MAX_MISSES {
+				state = UNKNOWN
+				info["status.jobStatus"] = UNKNOWN
+				info["status.endTime"] = time.Now().Format(TIME)
+				info["status.message"] = fmt.Sprintf("Job %s not found in remote cluster", id)
+				podutils.UpdateConfigMap(cm, info)
+				os.Exit(1)
+			}
+		}
+		// Terminate if we are done
+		if state == DONE {
+			os.Exit(0)
+		}
+		if state == KILL || state == FAILED {
+			os.Exit(1)
+		}
+	}
+}
+
+// Main method
+func main() {
+
+	// Get namespace and job name from environment
+	NAMESPACE = os.Getenv("NAMESPACE")
+	JOB_NAME = os.Getenv("JOBNAME")
+
+	// Initialize utils
+	podutils.InitUtils(JOB_NAME, NAMESPACE)
+
+	// Get config map and its parameters
+	cm := podutils.GetConfigMap()
+	podutils.SetHTTPSettings(cm.Data)
+	RESOURCE_URL = strings.TrimSuffix(cm.Data["resourceURL"], "/")
+	POLL, _ = strconv.Atoi(cm.Data["updateInterval"])
+	S3 = cm.Data["s3.secret"]
+	var err error
+	PROPS, err = parseJobProperties(cm.Data["jobproperties"])
+	if err != nil {
+		klog.Info("Error in JobProperties provided ", err)
+		PROPS = &JobProperties{}
+	}
+	REMOTE_NAMESPACE = PROPS.Namespace
+
+	// Get ID from config map
+	id := cm.Data["id"]
+
+	// create info for keeping track of execution parameters
+	info := make(map[string]string)
+	info["status.startTime"] = cm.Data["status.startTime"]
+	info["status.endTime"] = ""
+	info["status.message"] = ""
+
+	// If an ID is present in the config map it means that that we have already started a job
+	if len(id) == 0 {
+		klog.Info("Kubernetes Job with name ", JOB_NAME, " does not exist. Submitting new job.")
+
+		var msg string
+		id, msg = submit(cm.Data)
+		info["status.message"] = msg
+
+		if len(id) == 0 {
+			// Failed to submit a job
+			info["status.jobStatus"] = FAILED
+			info["status.endTime"] = time.Now().Format(TIME)
+		} else {
+			info["id"] = id
+			info["status.jobStatus"] = SUBMITTED
+			info["status.startTime"] = time.Now().Format(TIME)
+			info["status.submitTime"] = info["status.startTime"]
+		}
+
+		podutils.UpdateConfigMap(cm, info)
+
+		// Start monitoring or exit
+		if len(id) != 0 {
+			monitor(info)
+		} else {
+			klog.Exit("Failed to start Kubernetes job")
+		}
+	} else {
+		// Job is already running
+		klog.Info("Kubernetes Job has associated ID in ConfigMap. Handling state.")
+		info["id"] = id
+		monitor(info)
+	}
+}
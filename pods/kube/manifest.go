@@ -0,0 +1,161 @@
+//=============================================================================
+// Job manifest
+// Job script is a batch/v1 Job, or a Pod or PodTemplate whose spec becomes the template of the Job.
+// Manifests are YAML or JSON. Job parameters are added as environment variables to all containers
+//=============================================================================
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	LABEL_NAME      = "bridgejob.ibm.com/name"      // Name of the BridgeJob owning the remote job
+	LABEL_NAMESPACE = "bridgejob.ibm.com/namespace" // Namespace of the BridgeJob owning the remote job
+)
+
+// Job properties (jobproperties)
+type JobProperties struct {
+	Namespace             string `json:"namespace"`             // Namespace of the job in the remote cluster
+	BackoffLimit          *int32 `json:"backoffLimit"`          // Retries of the job, 0 for jobs built from pods if not set
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds"` // Run time limit of the job
+}
+
+// Parse job properties
+func parseJobProperties(content string) (*JobProperties, error) {
+	props := JobProperties{}
+	if len(strings.TrimSpace(content)) == 0 {
+		return &props, nil
+	}
+	if err := json.Unmarshal([]byte(content), &props); err != nil {
+		return nil, fmt.Errorf("failed to parse job properties; err %s", err.Error())
+	}
+	return &props, nil
+}
+
+// Build the job from manifest
+func buildJob(manifest string, params map[string]string, props *JobProperties) (*batchv1.Job, error) {
+	meta := metav1.TypeMeta{}
+	if err := yaml.Unmarshal([]byte(manifest), &meta); err != nil {
+		return nil, fmt.Errorf("failed to parse job manifest; err %s", err.Error())
+	}
+	job := &batchv1.Job{}
+	fromPod := false
+	switch meta.Kind {
+	case "Job":
+		if err := yaml.UnmarshalStrict([]byte(manifest), job); err != nil {
+			return nil, fmt.Errorf("failed to parse job; err %s", err.Error())
+		}
+	case "Pod":
+		pod := corev1.Pod{}
+		if err := yaml.UnmarshalStrict([]byte(manifest), &pod); err != nil {
+			return nil, fmt.Errorf("failed to parse pod; err %s", err.Error())
+		}
+		job.ObjectMeta = objectMeta(pod.ObjectMeta)
+		job.Spec.Template = corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: pod.Labels, Annotations: pod.Annotations},
+			Spec:       pod.Spec,
+		}
+		fromPod = true
+	case "PodTemplate":
+		template := corev1.PodTemplate{}
+		if err := yaml.UnmarshalStrict([]byte(manifest), &template); err != nil {
+			return nil, fmt.Errorf("failed to parse pod template; err %s", err.Error())
+		}
+		job.ObjectMeta = objectMeta(template.ObjectMeta)
+		job.Spec.Template = template.Template
+		fromPod = true
+	default:
+		return nil, fmt.Errorf("unsupported kind %q of job manifest, expected Job, Pod or PodTemplate", meta.Kind)
+	}
+	job.TypeMeta = metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"}
+	if len(job.Spec.Template.Spec.Containers) == 0 {
+		return nil, fmt.Errorf("job manifest has no containers")
+	}
+
+	// Jobs are named after the BridgeJob unless named by the manifest, the remote cluster makes the name unique
+	if len(job.Name) == 0 && len(job.GenerateName) == 0 {
+		job.GenerateName = JOB_NAME + "-"
+	}
+	job.Labels = bridgeLabels(job.Labels)
+	job.Spec.Template.Labels = bridgeLabels(job.Spec.Template.Labels)
+
+	// Pods are not restarted by default, failures are reported instead
+	if len(job.Spec.Template.Spec.RestartPolicy) == 0 || job.Spec.Template.Spec.RestartPolicy == corev1.RestartPolicyAlways {
+		job.Spec.Template.Spec.RestartPolicy = corev1.RestartPolicyNever
+	}
+	if props.BackoffLimit != nil {
+		job.Spec.BackoffLimit = props.BackoffLimit
+	} else if fromPod {
+		limit := int32(0)
+		job.Spec.BackoffLimit = &limit
+	}
+	if props.ActiveDeadlineSeconds != nil {
+		job.Spec.ActiveDeadlineSeconds = props.ActiveDeadlineSeconds
+	}
+
+	// Add parameters to the environment, in key order
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	spec := &job.Spec.Template.Spec
+	for i := range spec.Containers {
+		for _, key := range keys {
+			spec.Containers[i].Env = append(spec.Containers[i].Env, corev1.EnvVar{Name: key, Value: params[key]})
+		}
+	}
+	return job, nil
+}
+
+// Copy of labels with labels identifying the BridgeJob
+func bridgeLabels(labels map[string]string) map[string]string {
+	result := map[string]string{LABEL_NAME: JOB_NAME, LABEL_NAMESPACE: NAMESPACE}
+	for k, v := range labels {
+		if _, ok := result[k]; !ok {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// Metadata of the manifest kept for the job
+func objectMeta(meta metav1.ObjectMeta) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:         meta.Name,
+		GenerateName: meta.GenerateName,
+		Labels:       meta.Labels,
+		Annotations:  meta.Annotations,
+	}
+}
+
+// Parse job parameters, a JSON object of values. Values that are not strings are passed as JSON
+func parseParameters(content string) (map[string]string, error) {
+	params := map[string]interface{}{}
+	if len(strings.TrimSpace(content)) > 0 {
+		if err := json.Unmarshal([]byte(content), &params); err != nil {
+			return nil, fmt.Errorf("failed to parse job parameters; err %s", err.Error())
+		}
+	}
+	result := map[string]string{}
+	for key, value := range params {
+		switch v := value.(type) {
+		case string:
+			result[key] = v
+		default:
+			encoded, _ := json.Marshal(v)
+			result[key] = string(encoded)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const podManifest = `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: train
+  labels:
+    app: train
+spec:
+  containers:
+  - name: train
+    image: python:3.10-slim
+    env:
+    - name: MODE
+      value: fast
+`
+
+const jobManifest = `{
+  "apiVersion": "batch/v1",
+  "kind": "Job",
+  "metadata": {"namespace": "other"},
+  "spec": {
+    "backoffLimit": 3,
+    "template": {"spec": {"restartPolicy": "OnFailure", "containers": [{"name": "a", "image": "busybox"}]}}
+  }
+}`
+
+// Pods become the template of a job that is not retried, parameters are added to the environment
+func TestBuildJobFromPod(t *testing.T) {
+	JOB_NAME, NAMESPACE = "kubejob", "default"
+	job, err := buildJob(podManifest, map[string]string{"EPOCHS": "10", "BATCH": "32"}, &JobProperties{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Kind != "Job" || job.Name != "train" || job.Labels["app"] != "train" || job.Labels[LABEL_NAME] != "kubejob" {
+		t.Errorf("unexpected job metadata %+v", job.ObjectMeta)
+	}
+	if job.Spec.Template.Labels[LABEL_NAMESPACE] != "default" || len(job.Spec.Template.Name) > 0 {
+		t.Errorf("unexpected template metadata %+v", job.Spec.Template.ObjectMeta)
+	}
+	if job.Spec.BackoffLimit == nil || *job.Spec.BackoffLimit != 0 {
+		t.Error("job built from pod is retried")
+	}
+	if job.Spec.Template.Spec.RestartPolicy != corev1.RestartPolicyNever {
+		t.Errorf("unexpected restart policy %s", job.Spec.Template.Spec.RestartPolicy)
+	}
+	env := job.Spec.Template.Spec.Containers[0].Env
+	if len(env) != 3 || env[0].Name != "MODE" || env[1].Name != "BATCH" || env[2].Name != "EPOCHS" || env[2].Value != "10" {
+		t.Errorf("unexpected environment %+v", env)
+	}
+}
+
+// Jobs are kept as they are, except for properties
+func TestBuildJob(t *testing.T) {
+	JOB_NAME, NAMESPACE = "kubejob", "default"
+	deadline := int64(600)
+	job, err := buildJob(jobManifest, nil, &JobProperties{ActiveDeadlineSeconds: &deadline})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Namespace != "other" || job.GenerateName != "kubejob-" {
+		t.Errorf("unexpected job metadata %+v", job.ObjectMeta)
+	}
+	if *job.Spec.BackoffLimit != 3 || *job.Spec.ActiveDeadlineSeconds != 600 {
+		t.Errorf("unexpected job spec %+v", job.Spec)
+	}
+	if job.Spec.Template.Spec.RestartPolicy != corev1.RestartPolicyOnFailure {
+		t.Errorf("unexpected restart policy %s", job.Spec.Template.Spec.RestartPolicy)
+	}
+
+	for _, manifest := range []string{"kind: Deployment", "kind: Job\nspec: {}", "kind: Pod\nspec:\n  unknown: 1"} {
+		if _, err := buildJob(manifest, nil, &JobProperties{}); err == nil {
+			t.Errorf("invalid manifest %q accepted", manifest)
+		}
+	}
+}
+
+// Job state is given by its conditions and by the phase of its pods
+func TestJobState(t *testing.T) {
+	job := &batchv1.Job{}
+	pending := corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodPending}}
+	running := corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodRunning}}
+	if state := jobState(job, []corev1.Pod{pending}); state != PENDING {
+		t.Errorf("expected %s, got %s", PENDING, state)
+	}
+	if state := jobState(job, []corev1.Pod{pending, running}); state != RUNNING {
+		t.Errorf("expected %s, got %s", RUNNING, state)
+	}
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "DeadlineExceeded"}}
+	if state := jobState(job, []corev1.Pod{running}); state != FAILED {
+		t.Errorf("expected %s, got %s", FAILED, state)
+	}
+	if _, msg := jobResult(job); msg != "DeadlineExceeded" {
+		t.Errorf("unexpected message %s", msg)
+	}
+	job.Status.Conditions[0].Type = batchv1.JobComplete
+	if state := jobState(job, nil); state != DONE {
+		t.Errorf("expected %s, got %s", DONE, state)
+	}
+}
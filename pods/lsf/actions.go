@@ -0,0 +1,111 @@
+//=============================================================================
+// Job actions requested through the BridgeJob action field
+// The operator puts the requested action (JSON) into the action key of the ConfigMap.
+// The pod executes every new request once and reports the result in status.action.* keys,
+// which the operator copies to the BridgeJob status and records as an event
+//=============================================================================
+
+package main
+
+import (
+	"encoding/json"
+	e "errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const (
+	ACTION_REQUEUE = "requeue"
+	ACTION_SIGNAL  = "signal"
+	ACTION_MODIFY  = "modify"
+
+	ACTION_SUCCEEDED = "SUCCEEDED"
+)
+
+// Requested job action
+type JobAction struct {
+	Name           string `json:"name"`
+	ID             string `json:"id"`
+	Signal         string `json:"signal"`
+	Queue          string `json:"queue"`
+	RunLimitHour   int    `json:"runlimithour"`
+	RunLimitMinute int    `json:"runlimitminute"`
+}
+
+// Allowed action arguments, they are passed to LSF commands
+var (
+	signalPattern = regexp.MustCompile(`^(SIG)?[A-Z0-9]+$`)
+	queuePattern  = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+)
+
+// Execute new action requested in the ConfigMap and report its result. Actions are not idempotent, so the handled
+// request is checked in info as well, which is kept between polls even if the ConfigMap update fails
+func handleAction(id, state string, data map[string]string, info map[string]string) {
+	request := data["action"]
+	if len(request) == 0 || request == data["status.action.request"] || request == info["status.action.request"] {
+		return
+	}
+	action := JobAction{}
+	err := json.Unmarshal([]byte(request), &action)
+	if err == nil {
+		klog.Info("Executing job action ", action.Name, " on job ", id)
+		err = executeAction(id, state, &action)
+	}
+
+	info["status.action.request"] = request
+	info["status.action.name"] = action.Name
+	info["status.action.id"] = action.ID
+	info["status.action.time"] = time.Now().UTC().Format(TIME)
+	if err != nil {
+		klog.Info("Job action ", action.Name, " failed; err ", err.Error())
+		info["status.action.result"] = FAILED
+		info["status.action.message"] = err.Error()
+		return
+	}
+	klog.Info("Job action ", action.Name, " on job ", id, " succeeded")
+	info["status.action.result"] = ACTION_SUCCEEDED
+	info["status.action.message"] = fmt.Sprintf("Job %s: %s executed", id, action.Name)
+}
+
+// Validate and execute the action
+func executeAction(id, state string, action *JobAction) error {
+	switch action.Name {
+	case ACTION_REQUEUE:
+		return CLIENT.Requeue(id)
+	case ACTION_SIGNAL:
+		if !signalPattern.MatchString(action.Signal) {
+			return fmt.Errorf("invalid signal %q", action.Signal)
+		}
+		return CLIENT.Signal(id, action.Signal)
+	case ACTION_MODIFY:
+		if state != PENDING {
+			return fmt.Errorf("only pending jobs can be modified, job state is %s", state)
+		}
+		if len(action.Queue) > 0 && !queuePattern.MatchString(action.Queue) {
+			return fmt.Errorf("invalid queue %q", action.Queue)
+		}
+		if action.RunLimitHour < 0 || action.RunLimitMinute < 0 {
+			return e.New("run limit can not be negative")
+		}
+		if len(action.Queue) == 0 && action.RunLimitHour == 0 && action.RunLimitMinute == 0 {
+			return e.New("nothing to modify, queue or run limit expected")
+		}
+		return CLIENT.Modify(id, action.Queue, action.RunLimitHour*60+action.RunLimitMinute)
+	}
+	return fmt.Errorf("unknown action %q", action.Name)
+}
+
+// Options of bmod command
+func bmodOptions(queue string, runLimit int) string {
+	options := ""
+	if len(queue) > 0 {
+		options += " -q " + queue
+	}
+	if runLimit > 0 {
+		options += fmt.Sprintf(" -W %d:%02d", runLimit/60, runLimit%60)
+	}
+	return options
+}
@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+// Client counting requeue requests
+type requeueClient struct {
+	ACClient
+	requeued int
+}
+
+func (c *requeueClient) Requeue(id string) error {
+	c.requeued++
+	return nil
+}
+
+// Action is executed once, even if its result was not written to the ConfigMap
+func TestHandleActionOnce(t *testing.T) {
+	client := &requeueClient{}
+	saved := CLIENT
+	CLIENT = client
+	defer func() { CLIENT = saved }()
+
+	data := map[string]string{"action": `{"name":"requeue","id":"1"}`}
+	info := map[string]string{}
+	for poll := 0; poll < 3; poll++ {
+		handleAction("42", RUNNING, data, info)
+	}
+	if client.requeued != 1 {
+		t.Errorf("expected 1 requeue, got %d", client.requeued)
+	}
+	if info["status.action.result"] != ACTION_SUCCEEDED {
+		t.Errorf("unexpected result %s", info["status.action.result"])
+	}
+
+	data["action"] = `{"name":"requeue","id":"2"}`
+	handleAction("42", RUNNING, data, info)
+	if client.requeued != 2 {
+		t.Errorf("expected new request to be executed, got %d requeues", client.requeued)
+	}
+}
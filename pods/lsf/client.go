@@ -0,0 +1,365 @@
+//=============================================================================
+// Application Center clients
+// The legacy client uses the API of Application Centre versions prior to 9.1.5
+// (multipart submission, ws/userCmd, webservice/pacclient/file). The REST client uses
+// the Application Center 10.x RESTful API (JSON submission, job actions, job file download).
+// The client is selected by the acAPI job property, or by probing the ws/version endpoint
+//=============================================================================
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	e "errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog"
+
+	"github.com/ibm/bridge-operator/podutils"
+)
+
+const (
+	API_LEGACY = "legacy"
+	API_REST   = "rest"
+	API_AUTO   = "auto"
+)
+
+// Application Center client
+type ACClient interface {
+	// Submit job with application parameters. Files are staged to the job working directory
+	Submit(params map[string]string, files []string) (int, error)
+	// Kill job
+	Kill(id string) error
+	// Requeue job
+	Requeue(id string) error
+	// Send signal to job
+	Signal(id, signal string) error
+	// Modify queue or run limit (minutes) of pending job
+	Modify(id, queue string, runLimit int) error
+	// Download job file
+	DownloadFile(id, filename string) ([]byte, error)
+	// Download job file from offset. Returns the content and its offset, 0 if the whole file is returned
+	DownloadFileFrom(id, filename string, offset int64) ([]byte, int64, error)
+	// Get standard output of job without output file
+	Peek(id string) ([]byte, error)
+}
+
+// Client for Application Centre versions prior to 9.1.5
+type legacyClient struct{}
+
+// Client for Application Center 10.x
+type restClient struct {
+	version string
+}
+
+// Result of command executed by ws/userCmd
+type CmdResult struct {
+	XMLName xml.Name `xml:"cmdResult"`
+	Code    int      `xml:"code"`
+	Message string   `xml:"message"`
+	Output  string   `xml:"output"`
+}
+
+// Submission response
+type JobId struct {
+	Id    int `json:"id"`
+	JobId int `json:"jobId"`
+}
+
+// Version response
+type ACVersion struct {
+	Version string `json:"version"`
+}
+
+var CLIENT ACClient
+
+var majorVersion = regexp.MustCompile(`(\d+)\.\d+`)
+
+// Create client for the requested API, probing Application Center if the API is not set
+func newClient(api string) ACClient {
+	switch api {
+	case API_LEGACY:
+		klog.Info("Using legacy Application Center API")
+		return &legacyClient{}
+	case API_REST:
+		klog.Info("Using Application Center RESTful API")
+		return &restClient{}
+	case "", API_AUTO:
+	default:
+		klog.Info("Unknown Application Center API ", api, ", probing")
+	}
+	version := probeVersion()
+	if m := majorVersion.FindStringSubmatch(version); m != nil {
+		if major, _ := strconv.Atoi(m[1]); major >= 10 {
+			klog.Info("Application Center version ", version, ", using RESTful API")
+			return &restClient{version: version}
+		}
+	}
+	klog.Info("Application Center version ", version, ", using legacy API")
+	return &legacyClient{}
+}
+
+// Get Application Center version, empty if it can not be determined (versions prior to 10)
+func probeVersion() string {
+	req, err := http.NewRequest("GET", AC+"ws/version", nil)
+	if err != nil {
+		klog.Error("Error creating version request; err ", err)
+		return ""
+	}
+	req.Header.Set("Accept", "application/json")
+	respBody, statusCode := sendReq(req)
+	if statusCode != 200 {
+		return ""
+	}
+	version := ACVersion{}
+	if json.Unmarshal(respBody, &version) == nil && len(version.Version) > 0 {
+		return version.Version
+	}
+	return strings.TrimSpace(string(respBody))
+}
+
+// Get job id from the submission response
+func parseJobId(respBody []byte) (int, error) {
+	var id JobId
+	if err := json.Unmarshal(respBody, &id); err != nil {
+		return 0, fmt.Errorf("failed to parse submission response %s", string(respBody))
+	}
+	if id.Id == 0 {
+		id.Id = id.JobId
+	}
+	if id.Id == 0 {
+		return 0, e.New("job submittion failed (id 0)")
+	}
+	return id.Id, nil
+}
+
+// Submit job as multipart, with files attached
+func submitMultipart(params map[string]string, files []string) (int, error) {
+	req, err := newStreamRequest("POST", AC+"ws/jobs/submit", newSubmitBody("generic", params, files))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	respBody, statusCode := sendReq(req)
+	if statusCode != 200 {
+		return 0, fmt.Errorf("submitting job not successful - status code %d, err %s", statusCode, string(respBody))
+	}
+	return parseJobId(respBody)
+}
+
+func (c *legacyClient) Submit(params map[string]string, files []string) (int, error) {
+	return submitMultipart(params, files)
+}
+
+func (c *legacyClient) Kill(id string) error {
+	return userCmd("bkill " + id)
+}
+
+func (c *legacyClient) Requeue(id string) error {
+	return userCmd("brequeue " + id)
+}
+
+func (c *legacyClient) Signal(id, signal string) error {
+	return userCmd("bkill -s " + signal + " " + id)
+}
+
+func (c *legacyClient) Modify(id, queue string, runLimit int) error {
+	return userCmd("bmod" + bmodOptions(queue, runLimit) + " " + id)
+}
+
+func (c *legacyClient) DownloadFile(id, filename string) ([]byte, error) {
+	url := AC + "webservice/pacclient/file/" + id
+
+	// Create a new download request
+	req, err := http.NewRequest("GET", url, strings.NewReader(filename))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", MULTIPLE_ACCEPT_TYPE)
+	req.Header.Set("Content-Type", "text/plain")
+
+	// Download
+	respBody, statusCode := sendReq(req)
+	if statusCode != 200 {
+		return nil, fmt.Errorf("downloading file from server not successful (%d)", statusCode)
+	}
+	// File content follows its name
+	parts := bytes.SplitN(respBody, []byte(filepath.Base(filename)+">"), 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("file %s not found in server response", filename)
+	}
+	return parts[1], nil
+}
+
+// Output of job without output file is peeked at by bpeek
+func (c *legacyClient) Peek(id string) ([]byte, error) {
+	return userCmdOutput("bpeek " + id)
+}
+
+// File API has no ranges, the whole file is downloaded
+func (c *legacyClient) DownloadFileFrom(id, filename string, offset int64) ([]byte, int64, error) {
+	content, err := c.DownloadFile(id, filename)
+	return content, 0, err
+}
+
+// Submit job. Without output file, output is written to <job ID>.out in the working directory,
+// so that it can be downloaded while the job runs. Files are uploaded to the staging directory (stagingDir job property) through the file
+// transfer API, which becomes the job working directory. Without staging directory, multipart submission is used
+func (c *restClient) Submit(params map[string]string, files []string) (int, error) {
+	if len(params["OUTPUT_FILE"]) == 0 {
+		params["OUTPUT_FILE"] = "%J.out"
+	}
+	dir := JobProp["stagingDir"]
+	if len(files) > 0 && len(dir) == 0 {
+		return submitMultipart(params, files)
+	}
+	for _, f := range files {
+		if err := c.upload(dir, f); err != nil {
+			return 0, err
+		}
+	}
+	if len(dir) > 0 {
+		params["CWD"] = dir
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"appName": "generic", "params": params})
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest("POST", AC+"ws/jobs/submit", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	respBody, statusCode := sendReq(req)
+	if statusCode != 200 {
+		return 0, fmt.Errorf("submitting job not successful - status code %d, err %s", statusCode, string(respBody))
+	}
+	return parseJobId(respBody)
+}
+
+// Upload file to the directory on the cluster
+func (c *restClient) upload(dir, file string) error {
+	req, err := newStreamRequest("POST", AC+"ws/files/upload", newUploadBody(dir, file))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	respBody, statusCode := sendReq(req)
+	if statusCode != 200 {
+		return fmt.Errorf("uploading file %s not successful - status code %d, err %s", file, statusCode, string(respBody))
+	}
+	klog.Info("Successfully uploaded file ", file, " to ", dir)
+	return nil
+}
+
+func (c *restClient) Kill(id string) error {
+	return c.action(id, "kill")
+}
+
+func (c *restClient) Requeue(id string) error {
+	return c.action(id, "requeue")
+}
+
+// Signals and modifications have no job action, LSF commands are used
+func (c *restClient) Signal(id, signal string) error {
+	return userCmd("bkill -s " + signal + " " + id)
+}
+
+func (c *restClient) Modify(id, queue string, runLimit int) error {
+	return userCmd("bmod" + bmodOptions(queue, runLimit) + " " + id)
+}
+
+// Execute job action
+func (c *restClient) action(id, action string) error {
+	req, err := http.NewRequest("PUT", AC+"ws/jobs/"+id+"/"+action, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	respBody, statusCode := sendReq(req)
+	if statusCode != 200 {
+		return fmt.Errorf("job %s action %s not successful - status code %d, err %s", id, action, statusCode, string(respBody))
+	}
+	return nil
+}
+
+func (c *restClient) DownloadFile(id, filename string) ([]byte, error) {
+	content, _, err := c.DownloadFileFrom(id, filename, 0)
+	return content, err
+}
+
+func (c *restClient) DownloadFileFrom(id, filename string, offset int64) ([]byte, int64, error) {
+	req, err := http.NewRequest("GET", AC+"ws/jobfiles/download/"+id+"?file="+url.QueryEscape(filename), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", "application/octet-stream")
+	podutils.SetRange(req, offset)
+	respBody, statusCode := sendReq(req)
+	content, from, ok := podutils.RangeContent(respBody, statusCode, offset)
+	if !ok {
+		return nil, 0, fmt.Errorf("downloading file from server not successful (%d)", statusCode)
+	}
+	return content, from, nil
+}
+
+// Output of job without output file is downloaded by the job file API, see Submit
+func (c *restClient) Peek(id string) ([]byte, error) {
+	return c.DownloadFile(id, id+".out")
+}
+
+// Execute LSF command on behalf of the user. The command fails if LSF rejects it
+func userCmd(cmd string) error {
+	_, err := userCmdOutput(cmd)
+	return err
+}
+
+// Execute LSF command on behalf of the user and get its output
+func userCmdOutput(cmd string) ([]byte, error) {
+	respBody, err := sendUserCmd(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return parseCmdResult(cmd, respBody)
+}
+
+// Send LSF command to ws/userCmd, returns the response
+func sendUserCmd(cmd string) ([]byte, error) {
+	strBody := fmt.Sprintf("<UserCmd><cmd>%s</cmd></UserCmd>", xmlEscape(cmd))
+	req, err := http.NewRequest("POST", AC+"ws/userCmd", strings.NewReader(strBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/xml")
+	req.Header.Set("Content-Type", "application/xml")
+
+	respBody, statusCode := sendReq(req)
+	if statusCode != 200 {
+		return nil, fmt.Errorf("command %s not successful, status %d, respBody %s", cmd, statusCode, string(respBody))
+	}
+	return respBody, nil
+}
+
+// Get command output from the ws/userCmd response
+func parseCmdResult(cmd string, body []byte) ([]byte, error) {
+	result := CmdResult{}
+	if err := xml.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("invalid response of command %s; err %s", cmd, err.Error())
+	}
+	if result.Code != 0 {
+		return nil, fmt.Errorf("command %s failed with code %d: %s", cmd, result.Code, result.Message)
+	}
+	return []byte(result.Output), nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ibm/bridge-operator/podutils"
+)
+
+// Actions executed by LSF commands fail if LSF rejects the command
+func TestUserCmdActions(t *testing.T) {
+	commands := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ws/userCmd" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		commands = append(commands, string(body))
+		w.Header().Set("Content-Type", "application/xml")
+		if strings.Contains(string(body), " 42<") {
+			w.Write([]byte(`<cmdResult><code>0</code><message></message><output>Job &lt;42&gt; is being requeued</output></cmdResult>`))
+		} else {
+			w.Write([]byte(`<cmdResult><code>255</code><message>Job &lt;43&gt;: Job has already finished</message><output></output></cmdResult>`))
+		}
+	}))
+	defer server.Close()
+	AC = server.URL + "/"
+	TOKEN = podutils.NewTokenProvider(func() (string, time.Time, error) { return "token", time.Time{}, nil })
+	saved := CLIENT
+	CLIENT = &legacyClient{}
+	defer func() { CLIENT = saved }()
+
+	tests := []struct {
+		id      string
+		request string
+		command string
+		result  string
+	}{
+		{"42", `{"name":"requeue","id":"1"}`, "brequeue 42", ACTION_SUCCEEDED},
+		{"43", `{"name":"requeue","id":"2"}`, "brequeue 43", FAILED},
+		{"43", `{"name":"signal","id":"3","signal":"SIGUSR1"}`, "bkill -s SIGUSR1 43", FAILED},
+		{"43", `{"name":"modify","id":"4","queue":"short"}`, "bmod -q short 43", FAILED},
+	}
+	for _, test := range tests {
+		commands = commands[:0]
+		info := map[string]string{}
+		handleAction(test.id, PENDING, map[string]string{"action": test.request}, info)
+		if len(commands) != 1 || commands[0] != "<UserCmd><cmd>"+test.command+"</cmd></UserCmd>" {
+			t.Errorf("%s: unexpected commands %v", test.request, commands)
+		}
+		if info["status.action.result"] != test.result {
+			t.Errorf("%s: got result %s, expected %s; %s", test.request, info["status.action.result"], test.result, info["status.action.message"])
+		}
+	}
+	if err := userCmd("bkill 43"); err == nil || err.Error() != "command bkill 43 failed with code 255: Job <43>: Job has already finished" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+// Command output is taken from the ws/userCmd result
+func TestParseCmdResult(t *testing.T) {
+	body := []byte(`<?xml version="1.0" encoding="UTF-8"?><cmdResult><code>0</code><message></message>` +
+		`<output>&lt;&lt; output from stdout &gt;&gt;
+step 1 &amp; 2 done
+</output></cmdResult>`)
+	output, err := parseCmdResult("bpeek 42", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(output) != "<< output from stdout >>\nstep 1 & 2 done\n" {
+		t.Errorf("unexpected output %q", output)
+	}
+
+	body = []byte(`<cmdResult><code>255</code><message>Job &lt;42&gt; is not found</message><output></output></cmdResult>`)
+	if _, err := parseCmdResult("bpeek 42", body); err == nil || err.Error() != "command bpeek 42 failed with code 255: Job <42> is not found" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err := parseCmdResult("bpeek 42", []byte(`{"output": "x"}`)); err == nil {
+		t.Error("expected error for unknown response")
+	}
+}
@@ -3,7 +3,6 @@ module github.com/ibm/bridge-operator/lsf-pod
 go 1.18
 
 require (
-	github.com/clbanning/mxj/v2 v2.5.6
 	github.com/google/uuid v1.3.0
 	github.com/ibm/bridge-operator/podutils v0.0.1
 	k8s.io/klog v1.0.0
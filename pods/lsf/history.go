@@ -0,0 +1,256 @@
+//=============================================================================
+// LSF job history
+// Application Center returns job history (ws/jobhistory) as XML records, where the content
+// is the bhist -l output of the job. The content is parsed into a timeline of job events,
+// which gives the job state, exit code and times of jobs no longer known to LSF
+//=============================================================================
+
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	e "errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// Job event types
+const (
+	EVENT_SUBMIT   = "SUBMIT"
+	EVENT_DISPATCH = "DISPATCH"
+	EVENT_START    = "START"
+	EVENT_SUSPEND  = "SUSPEND"
+	EVENT_RESUME   = "RESUME"
+	EVENT_REQUEUE  = "REQUEUE"
+	EVENT_MODIFY   = "MODIFY"
+	EVENT_SIGNAL   = "SIGNAL"
+	EVENT_EXIT     = "EXIT"
+	EVENT_DONE     = "DONE"
+	EVENT_OTHER    = "OTHER"
+)
+
+// Job history response
+type JobHistory struct {
+	XMLName xml.Name        `xml:"jobHistory"`
+	Total   string          `xml:"total,attr"`
+	History []HistoryRecord `xml:"history"`
+}
+
+// Job history record
+type HistoryRecord struct {
+	Id          string      `xml:"id"`
+	Content     string      `xml:"content"`
+	TimeSummary TimeSummary `xml:"timeSummary"`
+}
+
+// Time spent in job states (sec)
+type TimeSummary struct {
+	PendingTime       string `xml:"pendingTime"`
+	PSuspTime         string `xml:"pSuspTime"`
+	RunTime           string `xml:"runTime"`
+	USuspTime         string `xml:"uSuspTime"`
+	SSuspTime         string `xml:"sSuspTime"`
+	UnknownTime       string `xml:"unknownTime"`
+	TotalTime         string `xml:"totalTime"`
+	TimeOfCalculation string `xml:"timeOfCalculation"`
+}
+
+// Job event
+type JobEvent struct {
+	Time     string `json:"time"`
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	ExitCode *int   `json:"exitCode,omitempty"`
+	Signal   string `json:"signal,omitempty"`
+}
+
+var (
+	// Event starts with its time, e.g. "Mon Oct 10 10:00:02: " or "Mon Oct 10 10:00:02 2022: "
+	eventTime   = regexp.MustCompile(`(?:Mon|Tue|Wed|Thu|Fri|Sat|Sun) (?:Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec) +\d{1,2} \d{2}:\d{2}:\d{2}(?: \d{4})?: `)
+	exitCode    = regexp.MustCompile(`Exited with exit code (\d+)`)
+	exitSignal  = regexp.MustCompile(`Exited by (?:LSF )?signal (\d+)`)
+	signalName  = regexp.MustCompile(`Signal <([A-Z0-9]+)> requested`)
+	lineStart   = regexp.MustCompile(`\n\s*`)
+	killReasons = []string{"TERM_OWNER", "TERM_ADMIN", "TERM_FORCE_OWNER", "TERM_FORCE_ADMIN"}
+)
+
+// Get job record from history. Used if we can't find the job by ID
+func getJobFromHistory(id string) (*HistoryRecord, error) {
+	url := AC + "ws/jobhistory?ids=" + id
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("Accept", MULTIPLE_ACCEPT_TYPE)
+
+	respBody, statusCode := sendReq(req)
+	if statusCode != 200 {
+		return nil, fmt.Errorf("retrieving job history not successful, status code %d, err %s", statusCode, string(respBody))
+	}
+	return parseJobHistory(respBody, id)
+}
+
+// Parse job history response and get the record of the job
+func parseJobHistory(body []byte, id string) (*HistoryRecord, error) {
+	history := JobHistory{}
+	if err := xml.Unmarshal(body, &history); err != nil {
+		return nil, fmt.Errorf("unmarshaling job history not successful; err %s", err.Error())
+	}
+	for i := range history.History {
+		if history.History[i].Id == id || len(history.History[i].Id) == 0 {
+			return &history.History[i], nil
+		}
+	}
+	return nil, e.New("job not found in history")
+}
+
+// Parse history content into job events
+func (r *HistoryRecord) Events() []JobEvent {
+	// Long lines are wrapped, continuation lines are indented
+	content := lineStart.ReplaceAllString(r.Content, "")
+	bounds := eventTime.FindAllStringIndex(content, -1)
+	events := make([]JobEvent, 0, len(bounds))
+	for i, b := range bounds {
+		end := len(content)
+		if i+1 < len(bounds) {
+			end = bounds[i+1][0]
+		}
+		text := content[b[1]:end]
+		if j := strings.Index(text, "Summary of time"); j >= 0 {
+			text = text[:j]
+		}
+		text = strings.TrimSuffix(strings.TrimSpace(text), ";")
+		event := classifyEvent(text)
+		event.Time = parseEventTime(content[b[0] : b[1]-2])
+		events = append(events, event)
+	}
+	return events
+}
+
+// Get event type and details from its text
+func classifyEvent(text string) JobEvent {
+	event := JobEvent{Type: EVENT_OTHER, Text: text}
+	switch {
+	case strings.HasPrefix(text, "Submitted"):
+		event.Type = EVENT_SUBMIT
+	case strings.HasPrefix(text, "Dispatched"):
+		event.Type = EVENT_DISPATCH
+	case strings.HasPrefix(text, "Starting"), strings.HasPrefix(text, "Started"):
+		event.Type = EVENT_START
+	case strings.HasPrefix(text, "Suspended"):
+		event.Type = EVENT_SUSPEND
+	case strings.HasPrefix(text, "Resumed"), text == "Running":
+		event.Type = EVENT_RESUME
+	case strings.Contains(text, "requeued"), strings.HasPrefix(text, "Requeue"):
+		event.Type = EVENT_REQUEUE
+	case strings.HasPrefix(text, "Parameters of Job are changed"):
+		event.Type = EVENT_MODIFY
+	case signalName.MatchString(text):
+		event.Type = EVENT_SIGNAL
+		event.Signal = signalName.FindStringSubmatch(text)[1]
+	case strings.HasPrefix(text, "Done successfully"):
+		event.Type = EVENT_DONE
+		code := 0
+		event.ExitCode = &code
+	case strings.HasPrefix(text, "Exited"), strings.HasPrefix(text, "Completed <exit>"):
+		event.Type = EVENT_EXIT
+		if m := exitCode.FindStringSubmatch(text); m != nil {
+			code, _ := strconv.Atoi(m[1])
+			event.ExitCode = &code
+		} else if m := exitSignal.FindStringSubmatch(text); m != nil {
+			// Shell convention for jobs terminated by a signal
+			code, _ := strconv.Atoi(m[1])
+			code += 128
+			event.ExitCode = &code
+		}
+	}
+	return event
+}
+
+// Convert event time to the status time format (UTC). History times are local times of the cluster, which has to be
+// the time zone of the pod (TZ), and may omit the year
+func parseEventTime(value string) string {
+	value = strings.Join(strings.Fields(value), " ")
+	if t, err := time.ParseInLocation("Mon Jan 2 15:04:05 2006", value, time.Local); err == nil {
+		return t.UTC().Format(TIME)
+	}
+	t, err := time.ParseInLocation("Mon Jan 2 15:04:05", value, time.Local)
+	if err != nil {
+		return value
+	}
+	now := time.Now()
+	t = t.AddDate(now.Year(), 0, 0)
+	if t.After(now.Add(24 * time.Hour)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t.UTC().Format(TIME)
+}
+
+// Get job state from the event timeline
+func stateFromEvents(events []JobEvent) string {
+	state := UNKNOWN
+	killed := false
+	for _, event := range events {
+		switch event.Type {
+		case EVENT_SUBMIT, EVENT_REQUEUE:
+			state = PENDING
+			killed = false
+		case EVENT_DISPATCH, EVENT_START, EVENT_RESUME:
+			state = RUNNING
+		case EVENT_SUSPEND:
+			state = SUSPENDED
+		case EVENT_SIGNAL:
+			if event.Signal == "KILL" {
+				killed = true
+			}
+		case EVENT_DONE:
+			state = DONE
+		case EVENT_EXIT:
+			state = EXIT
+			for _, reason := range killReasons {
+				if strings.Contains(event.Text, reason) {
+					killed = true
+				}
+			}
+			if killed {
+				state = KILL
+			}
+		}
+	}
+	return state
+}
+
+// Set job information from history: state, times, exit code and the event timeline (status.history)
+func infoFromHistory(record *HistoryRecord, info map[string]string) string {
+	events := record.Events()
+	state := stateFromEvents(events)
+	for _, event := range events {
+		switch event.Type {
+		case EVENT_SUBMIT:
+			if len(info["status.submitTime"]) == 0 {
+				info["status.submitTime"] = event.Time
+			}
+		case EVENT_START:
+			info["status.startTime"] = event.Time
+		case EVENT_DONE, EVENT_EXIT:
+			info["status.endTime"] = event.Time
+			if event.ExitCode != nil {
+				info["status.exitCode"] = strconv.Itoa(*event.ExitCode)
+			}
+		}
+	}
+	timeline, err := json.Marshal(events)
+	if err == nil {
+		info["status.history"] = string(timeline)
+	}
+	klog.Info("Job history: ", string(timeline))
+	return state
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// Timeline of the recorded history: requeued job which exited with code 3
+func TestJobHistoryEvents(t *testing.T) {
+	// Cluster two hours ahead of UTC
+	saved := time.Local
+	time.Local = time.FixedZone("CEST", 2*60*60)
+	defer func() { time.Local = saved }()
+
+	body, err := os.ReadFile("testdata/jobhistory.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := parseJobHistory(body, "4521")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.TimeSummary.RunTime != "505" {
+		t.Errorf("run time %q, expected 505", record.TimeSummary.RunTime)
+	}
+
+	expected := []string{EVENT_SUBMIT, EVENT_DISPATCH, EVENT_START, EVENT_SUSPEND, EVENT_RESUME,
+		EVENT_REQUEUE, EVENT_DISPATCH, EVENT_START, EVENT_EXIT}
+	events := record.Events()
+	if len(events) != len(expected) {
+		t.Fatalf("got %d events %v, expected %d", len(events), events, len(expected))
+	}
+	for i, event := range events {
+		if event.Type != expected[i] {
+			t.Errorf("event %d (%s) has type %s, expected %s", i, event.Text, event.Type, expected[i])
+		}
+	}
+	if events[0].Text != "Submitted from host <login1>, to Queue <normal>, CWD <$HOME/jobs>, Output File <sample.out>, Error File <sample.err>" {
+		t.Errorf("wrapped lines not joined: %q", events[0].Text)
+	}
+
+	info := map[string]string{}
+	if state := infoFromHistory(record, info); state != EXIT {
+		t.Errorf("state %s, expected %s", state, EXIT)
+	}
+	if info["status.exitCode"] != "3" {
+		t.Errorf("exit code %q, expected 3", info["status.exitCode"])
+	}
+	if info["status.startTime"][10:] != "T08:04:11Z" || info["status.endTime"][10:] != "T08:09:30Z" {
+		t.Errorf("start time %s, end time %s", info["status.startTime"], info["status.endTime"])
+	}
+}
+
+// Job state from the event timeline
+func TestStateFromEvents(t *testing.T) {
+	tests := []struct {
+		texts []string
+		state string
+	}{
+		{[]string{"Submitted from host <h>"}, PENDING},
+		{[]string{"Submitted from host <h>", "Starting (Pid 1)"}, RUNNING},
+		{[]string{"Submitted from host <h>", "Starting (Pid 1)", "Suspended by the user or administrator <u>"}, SUSPENDED},
+		{[]string{"Submitted from host <h>", "Starting (Pid 1)", "Done successfully. The CPU time used is 1.0 seconds"}, DONE},
+		{[]string{"Submitted from host <h>", "Signal <KILL> requested by user or administrator <u>", "Exited by LSF signal 9"}, KILL},
+		{[]string{"Submitted from host <h>", "Completed <exit>; TERM_OWNER: job killed by owner"}, KILL},
+		{[]string{"Submitted from host <h>", "Exited with exit code 1"}, EXIT},
+		{[]string{"Job was modified"}, UNKNOWN},
+	}
+	for _, test := range tests {
+		events := []JobEvent{}
+		for _, text := range test.texts {
+			events = append(events, classifyEvent(text))
+		}
+		if state := stateFromEvents(events); state != test.state {
+			t.Errorf("%v: state %s, expected %s", test.texts, state, test.state)
+		}
+	}
+}
+
+// Local event times are converted to UTC
+func TestParseEventTime(t *testing.T) {
+	saved := time.Local
+	time.Local = time.FixedZone("EST", -5*60*60)
+	defer func() { time.Local = saved }()
+
+	if got := parseEventTime("Mon Oct 10  22:00:02 2022"); got != "2022-10-11T03:00:02Z" {
+		t.Errorf("got %s, expected 2022-10-11T03:00:02Z", got)
+	}
+	last := time.Now().In(time.Local).AddDate(0, 0, -2)
+	value := last.Format("Mon Jan 2 15:04:05")
+	if got, expected := parseEventTime(value), last.UTC().Format(TIME); got != expected {
+		t.Errorf("%s: got %s, expected %s", value, got, expected)
+	}
+}
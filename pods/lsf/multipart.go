@@ -0,0 +1,257 @@
+//=============================================================================
+// Multipart bodies for Application Center requests
+// Bodies are streamed, so that input files of arbitrary size are never held in memory.
+// They can be recreated for retries and their length is computed upfront
+//=============================================================================
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// Streamed request body
+type streamBody interface {
+	// Content type of the body
+	contentType() string
+	// Write the body. If counter is given, file content is not copied, only its size is added to the counter
+	write(w io.Writer, counter *countingWriter) error
+}
+
+// Multipart body of the job submission
+type submitBody struct {
+	boundary     string            // Boundary of the body
+	dataBoundary string            // Boundary of the nested data part with application parameters
+	appName      string            // Application (template) name
+	params       map[string]string // Application parameters
+	files        []string          // Local files uploaded with the job
+}
+
+// Multipart body of the file upload to a directory
+type uploadBody struct {
+	boundary string // Boundary of the body
+	dir      string // Target directory
+	file     string // Local file to upload
+}
+
+// Counts bytes written, used for computing body length
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// Create submission body
+func newSubmitBody(appName string, params map[string]string, files []string) *submitBody {
+	return &submitBody{
+		boundary:     uuid.New().String(),
+		dataBoundary: uuid.New().String(),
+		appName:      appName,
+		params:       params,
+		files:        files,
+	}
+}
+
+// Content type of the body
+func (b *submitBody) contentType() string {
+	return "multipart/mixed; boundary=" + b.boundary
+}
+
+// Create file upload body
+func newUploadBody(dir, file string) *uploadBody {
+	return &uploadBody{
+		boundary: uuid.New().String(),
+		dir:      dir,
+		file:     file,
+	}
+}
+
+// Content type of the body
+func (b *uploadBody) contentType() string {
+	return "multipart/mixed; boundary=" + b.boundary
+}
+
+// Get body length without reading the files
+func bodyLength(b streamBody) (int64, error) {
+	counter := &countingWriter{}
+	err := b.write(counter, counter)
+	return counter.n, err
+}
+
+// Get body reader. Every call returns a new reader, so it can be used for request retries
+func bodyReader(b streamBody) io.ReadCloser {
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(b.write(w, nil))
+	}()
+	return r
+}
+
+// Create request with streamed body, which can be resent
+func newStreamRequest(method, url string, b streamBody) (*http.Request, error) {
+	length, err := bodyLength(b)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, url, bodyReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = length
+	req.GetBody = func() (io.ReadCloser, error) { return bodyReader(b), nil }
+	req.Header.Set("Content-Type", b.contentType())
+	return req, nil
+}
+
+// Escape XML text
+func xmlEscape(text string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(text))
+	return buf.String()
+}
+
+// Application parameter in XML
+func appParam(id, value, ptype string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("<AppParam><id>")
+	xml.EscapeText(&buf, []byte(id))
+	buf.WriteString("</id><value>")
+	xml.EscapeText(&buf, []byte(value))
+	buf.WriteString("</value><type>")
+	xml.EscapeText(&buf, []byte(ptype))
+	buf.WriteString("</type></AppParam>")
+	return buf.Bytes()
+}
+
+// Header of a part
+func partHeader(name string, extra ...string) textproto.MIMEHeader {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf("form-data; name=%q", name))
+	// Keys are kept as given (e.g. Content-ID), the same way as Application Center clients send them
+	for i := 0; i+1 < len(extra); i += 2 {
+		header[extra[i]] = []string{extra[i+1]}
+	}
+	return header
+}
+
+func (b *submitBody) write(w io.Writer, counter *countingWriter) error {
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(b.boundary); err != nil {
+		return err
+	}
+
+	// Application name
+	part, err := mw.CreatePart(partHeader("AppName", "Content-ID", "<AppName>"))
+	if err != nil {
+		return err
+	}
+	io.WriteString(part, b.appName)
+
+	// Application parameters and file references, nested multipart
+	part, err = mw.CreatePart(partHeader("data", "Content-ID", "<data>", "Accept-Language", "en-us",
+		"Content-Type", "multipart/mixed; boundary="+b.dataBoundary))
+	if err != nil {
+		return err
+	}
+	data := multipart.NewWriter(part)
+	if err := data.SetBoundary(b.dataBoundary); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(b.params))
+	for name := range b.params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	paramHeader := []string{"Content-Type", "application/xml; charset=UTF-8", "Content-Transfer-Encoding", "8bit", "Accept-Language", "en"}
+	for _, name := range names {
+		p, err := data.CreatePart(partHeader(name, paramHeader...))
+		if err != nil {
+			return err
+		}
+		p.Write(appParam(name, b.params[name], ""))
+	}
+	for _, f := range b.files {
+		name := filepath.Base(f)
+		p, err := data.CreatePart(partHeader(name, paramHeader...))
+		if err != nil {
+			return err
+		}
+		p.Write(appParam(name, name+",upload", "file"))
+	}
+	if err := data.Close(); err != nil {
+		return err
+	}
+
+	// File content
+	for _, f := range b.files {
+		name := filepath.Base(f)
+		part, err := mw.CreatePart(partHeader(name, "Content-Type", "application/octet-stream",
+			"Content-Transfer-Encoding", "binary", "Content-ID", "<"+name+">"))
+		if err != nil {
+			return err
+		}
+		if err := copyFile(part, f, counter); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+func (b *uploadBody) write(w io.Writer, counter *countingWriter) error {
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(b.boundary); err != nil {
+		return err
+	}
+
+	// Target directory
+	part, err := mw.CreatePart(partHeader("dir"))
+	if err != nil {
+		return err
+	}
+	io.WriteString(part, b.dir)
+
+	// File content
+	name := filepath.Base(b.file)
+	part, err = mw.CreatePart(partHeader(name, "Content-Type", "application/octet-stream",
+		"Content-Transfer-Encoding", "binary", "Content-ID", "<"+name+">"))
+	if err != nil {
+		return err
+	}
+	if err := copyFile(part, b.file, counter); err != nil {
+		return err
+	}
+	return mw.Close()
+}
+
+// Copy file content to the writer, or only count its size
+func copyFile(w io.Writer, path string, counter *countingWriter) error {
+	if counter != nil {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		counter.n += info.Size()
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"testing"
+)
+
+func fixtureBody() *submitBody {
+	return newSubmitBody("generic", map[string]string{
+		"JOB_NAME":     "lsfjob-sample",
+		"QUEUE":        "normal",
+		"COMMANDTORUN": "grep \"a<b\" input && echo 'x' > out",
+	}, []string{"testdata/script"})
+}
+
+// Part of multipart body with its content
+type bodyPart struct {
+	name    string
+	header  textproto.MIMEHeader
+	content []byte
+}
+
+// Read parts of multipart body with content type, checking that they are separated by its boundary
+func readParts(t *testing.T, contentType string, body io.Reader) []bodyPart {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/mixed" || len(params["boundary"]) == 0 {
+		t.Fatalf("unexpected content type %s", contentType)
+	}
+	reader := multipart.NewReader(body, params["boundary"])
+	parts := []bodyPart{}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return parts
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, bodyPart{name: part.FormName(), header: part.Header, content: content})
+	}
+}
+
+// Check headers of part
+func checkHeaders(t *testing.T, part bodyPart, headers map[string]string) {
+	for k, v := range headers {
+		if got := part.header.Get(k); got != v {
+			t.Errorf("part %s: header %s is %q, expected %q", part.name, k, got, v)
+		}
+	}
+}
+
+// Submission body follows Application Center submit request: application name, nested data part with
+// application parameters as AppParam documents, and a binary part for every file
+func TestSubmitBody(t *testing.T) {
+	body := fixtureBody()
+	parts := readParts(t, body.contentType(), bodyReader(body))
+	if len(parts) != 3 {
+		t.Fatalf("expected 3 parts, got %d", len(parts))
+	}
+
+	appName, data, file := parts[0], parts[1], parts[2]
+	if appName.name != "AppName" || string(appName.content) != "generic" {
+		t.Errorf("unexpected application part %s: %q", appName.name, appName.content)
+	}
+	checkHeaders(t, appName, map[string]string{"Content-ID": "<AppName>"})
+
+	if data.name != "data" {
+		t.Fatalf("expected data part, got %s", data.name)
+	}
+	checkHeaders(t, data, map[string]string{"Content-ID": "<data>", "Accept-Language": "en-us"})
+	expected := map[string]struct{ value, kind string }{
+		"JOB_NAME":     {"lsfjob-sample", ""},
+		"QUEUE":        {"normal", ""},
+		"COMMANDTORUN": {"grep \"a<b\" input && echo 'x' > out", ""},
+		"script":       {"script,upload", "file"},
+	}
+	params := readParts(t, data.header.Get("Content-Type"), bytes.NewReader(data.content))
+	if len(params) != len(expected) {
+		t.Errorf("expected %d parameters, got %d", len(expected), len(params))
+	}
+	for _, param := range params {
+		checkHeaders(t, param, map[string]string{"Content-Type": "application/xml; charset=UTF-8",
+			"Content-Transfer-Encoding": "8bit", "Accept-Language": "en"})
+		var value struct {
+			ID    string `xml:"id"`
+			Value string `xml:"value"`
+			Type  string `xml:"type"`
+		}
+		if err := xml.Unmarshal(param.content, &value); err != nil {
+			t.Errorf("parameter %s: %s", param.name, err)
+			continue
+		}
+		want, ok := expected[param.name]
+		if !ok || value.ID != param.name || value.Value != want.value || value.Type != want.kind {
+			t.Errorf("unexpected parameter %s: %+v", param.name, value)
+		}
+	}
+
+	script, err := os.ReadFile("testdata/script")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.name != "script" || !bytes.Equal(file.content, script) {
+		t.Errorf("unexpected file part %s: %q", file.name, file.content)
+	}
+	checkHeaders(t, file, map[string]string{"Content-ID": "<script>", "Content-Type": "application/octet-stream",
+		"Content-Transfer-Encoding": "binary"})
+}
+
+// Computed length is used as Content-Length of the streamed body
+func TestSubmitBodyLength(t *testing.T) {
+	body := fixtureBody()
+	content, err := io.ReadAll(bodyReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	length, err := bodyLength(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if length != int64(len(content)) {
+		t.Errorf("computed length %d, body length %d", length, len(content))
+	}
+}
+
+// Every reader streams the whole body, so that requests can be retried
+func TestSubmitBodyRewind(t *testing.T) {
+	body := fixtureBody()
+	first, _ := io.ReadAll(bodyReader(body))
+	second, _ := io.ReadAll(bodyReader(body))
+	if !bytes.Equal(first, second) {
+		t.Error("second body differs from the first one")
+	}
+}
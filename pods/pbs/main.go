@@ -0,0 +1,402 @@
+//=============================================================================
+// Code for managing HPC jobs deployed on PBS Pro / OpenPBS
+//=============================================================================
+
+package main
+
+import (
+	"encoding/json"
+	e "errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ibm/bridge-operator/podutils"
+
+	"k8s.io/klog"
+)
+
+const (
+	TIME = "2006-01-02T15:04:05Z"
+
+	// Job states reported to the operator
+	SUBMITTED = "SUBMITTED"
+	PENDING   = "PENDING"
+	RUNNING   = "RUNNING"
+	SUSPENDED = "SUSPENDED"
+	DONE      = "DONE"
+	KILL      = "KILL"
+	FAILED    = "FAILED"
+	UNKNOWN   = "UNKNOWN"
+
+	MAX_MISSES = 10 // Number of polls the job can be missing in qstat
+
+	CREDS_DIR   = "/credentials/"
+	FILES_DIR   = "/downloads/"
+	SCRIPT_NAME = "script"
+)
+
+var SSH *podutils.SSHClient
+var JOB_NAME string
+var NAMESPACE string
+var POLL int
+var S3 string
+var JobProp map[string]string
+
+// Parse job properties, values that are not strings are kept as JSON
+func parseJobProperties(properties string) (map[string]string, error) {
+	props := map[string]string{}
+	if len(strings.TrimSpace(properties)) == 0 {
+		return props, nil
+	}
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(properties), &raw); err != nil {
+		return props, err
+	}
+	for k, v := range raw {
+		var str string
+		if json.Unmarshal(v, &str) == nil {
+			props[k] = str
+		} else {
+			props[k] = strings.TrimSpace(string(v))
+		}
+	}
+	return props, nil
+}
+
+// Path of file in the working directory of the job
+func workPath(name string) string {
+	if dir := JobProp["currentWorkingDir"]; len(dir) > 0 && !strings.HasPrefix(name, "/") {
+		return strings.TrimSuffix(dir, "/") + "/" + name
+	}
+	return name
+}
+
+// Stage additional data (comma separated bucket:object list) into the working directory
+func stageInputs(data map[string]string) error {
+	for _, f := range strings.Split(data["jobdata.additionalData"], ",") {
+		f = strings.TrimSpace(f)
+		if len(f) == 0 {
+			continue
+		}
+		if len(S3) == 0 {
+			return e.New("input data requested, but S3 storage is not configured")
+		}
+		pair := strings.SplitN(f, ":", 2)
+		if len(pair) != 2 || len(pair[0]) == 0 || len(pair[1]) == 0 {
+			return fmt.Errorf("invalid input data location %s, expected bucket:object", f)
+		}
+		content := podutils.DownloadS3Data(pair[0], pair[1], data)
+		if err := SSH.PushFile(workPath(path.Base(pair[1])), []byte(content)); err != nil {
+			return fmt.Errorf("failed to stage %s; err %s", f, err.Error())
+		}
+		klog.Info("Staged input ", f)
+	}
+	return nil
+}
+
+// Submit job, returns its ID and message
+func submit(data map[string]string) (string, string) {
+	if err := stageInputs(data); err != nil {
+		klog.Error("Failed to stage input data; err ", err)
+		return "", "Failed to stage input data: " + err.Error()
+	}
+
+	var command string
+	var script *strings.Reader
+	switch data["jobdata.scriptLocation"] {
+	case "remote":
+		command = qsubCommand(JobProp, data["jobdata.jobScript"])
+	case "s3":
+		s3info := strings.Split(data["jobdata.jobScript"], ":")
+		if len(s3info) != 2 {
+			return "", "Invalid S3 location of job script " + data["jobdata.jobScript"]
+		}
+		script = strings.NewReader(podutils.DownloadS3Data(s3info[0], s3info[1], data))
+		command = qsubCommand(JobProp, "")
+	default:
+		script = strings.NewReader(data["jobdata.jobScript"])
+		command = qsubCommand(JobProp, "")
+	}
+	klog.Info("Submitting job: ", command)
+
+	var output []byte
+	var err error
+	if script != nil {
+		output, err = SSH.Run(command, script)
+	} else {
+		output, err = SSH.Run(command, nil)
+	}
+	if err != nil {
+		klog.Error("Submitting job not successful; err ", err)
+		return "", "Failed to submit a job to PBS: " + err.Error()
+	}
+	id, err := parseJobID(output)
+	if err != nil {
+		klog.Error("Submitting job not successful; err ", err)
+		return "", err.Error()
+	}
+	klog.Info("Successfully submitted a job with job id ", id)
+	return id, ""
+}
+
+// Get job, including finished jobs kept in history. Returns nil if the job is not known to PBS
+func getJob(id string) (*Job, error) {
+	output, err := SSH.Run("qstat -f -F json -x "+podutils.ShellQuote(id), nil)
+	if err != nil {
+		cmdErr := &podutils.CommandError{}
+		if e.As(err, &cmdErr) && strings.Contains(cmdErr.Stderr, "Unknown Job Id") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return parseQstat(output, id)
+}
+
+// Kill the job
+func killJob(id string, state string) {
+	if finished(state) {
+		klog.Info("Job ", id, " is already in finished state ", state)
+		return
+	}
+	if _, err := SSH.Run("qdel "+podutils.ShellQuote(id), nil); err != nil {
+		klog.Info("Job ", id, " is not killed; err ", err, ". Continue in monitoring, will try to kill again.")
+		return
+	}
+	// The job is reported as finished by PBS once it terminates
+	klog.Info("Job ", id, " deleted")
+}
+
+func finished(state string) bool {
+	return state == DONE || state == KILL || state == FAILED
+}
+
+// Upload outputs of the job, listed result files and execution script to <bucket>/<jobname>/.
+// Uploaded objects are reported in the status message
+func uploadOutputs(job *Job, data map[string]string, info map[string]string) {
+	// Skip if S3 info is not provided
+	if len(S3) == 0 || len(data["s3upload.bucket"]) == 0 {
+		return
+	}
+	prefix := JOB_NAME + "/"
+	var objects []podutils.UploadFileLocation
+
+	// Add execution script, if not already on s3
+	if data["jobdata.scriptLocation"] == "inline" {
+		err := os.WriteFile(FILES_DIR+SCRIPT_NAME, []byte(data["jobdata.jobScript"]), 0644)
+		if err != nil {
+			klog.Info("Error saving execution script, it won't be uploaded to S3; err ", err.Error())
+		} else {
+			objects = append(objects, podutils.UploadFileLocation{Name: prefix + SCRIPT_NAME, Path: FILES_DIR + SCRIPT_NAME})
+		}
+	}
+
+	files := outputFiles(job)
+	for _, f := range strings.Split(data["s3upload.files"], ",") {
+		if f = strings.TrimSpace(f); len(f) > 0 {
+			files = append(files, workPath(f))
+		}
+	}
+	for _, f := range files {
+		content, err := SSH.FetchFile(f)
+		if err != nil {
+			klog.Info("Error downloading file ", f, ", this file won't be uploaded to S3; err ", err.Error())
+			continue
+		}
+		shortname := path.Base(f)
+		if err := os.WriteFile(FILES_DIR+shortname, content, 0644); err != nil {
+			klog.Info("Error saving file ", f, ", this file won't be uploaded to S3; err ", err.Error())
+			continue
+		}
+		objects = append(objects, podutils.UploadFileLocation{Name: prefix + shortname, Path: FILES_DIR + shortname})
+	}
+
+	// Load to S3, one by one so that a failure does not prevent uploading the rest
+	uploaded := []string{}
+	for _, object := range objects {
+		if err := podutils.UploadS3DataDisk(data, []podutils.UploadFileLocation{object}); err == nil {
+			uploaded = append(uploaded, object.Name)
+		}
+	}
+	if len(uploaded) == 0 {
+		return
+	}
+	msg := fmt.Sprintf("Uploaded to S3 bucket %s: %s", data["s3upload.bucket"], strings.Join(uploaded, ", "))
+	if len(info["status.message"]) > 0 {
+		msg = info["status.message"] + "; " + msg
+	}
+	info["status.message"] = msg
+}
+
+// Output streams of the job, tailed to the pod log. Output is only available while the job runs when written directly
+func logStreams(job *Job) []podutils.LogStream {
+	if JobProp["directWrite"] != "true" {
+		return nil
+	}
+	streams := []podutils.LogStream{}
+	for i, f := range outputFiles(job) {
+		name := "stdout"
+		if i > 0 {
+			name = "stderr"
+		}
+		filename := f
+		streams = append(streams, podutils.LogStream{Name: name, Fetch: func() ([]byte, error) {
+			return SSH.FetchFile(filename)
+		}, FetchFrom: func(offset int64) ([]byte, int64, error) {
+			return SSH.FetchFileFrom(filename, offset)
+		}})
+	}
+	return streams
+}
+
+// Monitoring job execution
+// Method that runs constantly monitoring PBS job
+func monitor(info map[string]string) {
+	id := info["id"]
+	misses := 0
+	tailing := false
+	// Run forever
+	for {
+		// Sleep before next run
+		time.Sleep(time.Duration(POLL) * time.Second)
+
+		// Get current config map
+		cm := podutils.GetConfigMap()
+		killRequested := cm.Data["kill"] == "true"
+
+		// Get current execution status and update config map
+		var state = ""
+		job, err := getJob(id)
+		if err != nil {
+			klog.Info("Failed to get job ", id, "; err ", err)
+			continue
+		}
+		if job != nil {
+			misses = 0
+			if !tailing && job.State != "Q" && job.State != "H" {
+				podutils.TailLogs(cm.Data, logStreams(job)...)
+				tailing = true
+			}
+			state = jobState(job, killRequested)
+			info["status.jobStatus"] = state
+			info["status.pbsState"] = job.State
+			if t := formatTime(job.StartTime); len(t) > 0 {
+				info["status.startTime"] = t
+			}
+			if finished(state) {
+				if job.ExitStatus != nil {
+					info["status.exitStatus"] = strconv.Itoa(*job.ExitStatus)
+				}
+				info["status.endTime"] = formatTime(job.ObitTime)
+				if len(info["status.endTime"]) == 0 {
+					info["status.endTime"] = time.Now().Format(TIME)
+				}
+				info["status.message"] = exitMessage(job)
+				uploadOutputs(job, cm.Data, info)
+			} else if killRequested {
+				killJob(id, state)
+			}
+			podutils.UpdateConfigMap(cm, info)
+		} else if killRequested && misses == 0 {
+			// Deleted jobs are not reported without job history
+			state = KILL
+			info["status.jobStatus"] = KILL
+			info["status.endTime"] = time.Now().Format(TIME)
+			podutils.UpdateConfigMap(cm, info)
+		} else {
+			misses++
+			if misses >= MAX_MISSES {
+				state = UNKNOWN
+				info["status.jobStatus"] = UNKNOWN
+				info["status.endTime"] = time.Now().Format(TIME)
+				info["status.message"] = fmt.Sprintf("PBS job %s not found, job history may be disabled", id)
+				podutils.UpdateConfigMap(cm, info)
+				os.Exit(1)
+			}
+		}
+		// Terminate if we are done
+		if finished(state) {
+			podutils.FlushLogs()
+		}
+		if state == DONE {
+			os.Exit(0)
+		}
+		if state == KILL || state == FAILED {
+			os.Exit(1)
+		}
+	}
+}
+
+// Main method
+func main() {
+
+	// Get namespace and job name from environment
+	NAMESPACE = os.Getenv("NAMESPACE")
+	JOB_NAME = os.Getenv("JOBNAME")
+
+	// Initialize utils
+	podutils.InitUtils(JOB_NAME, NAMESPACE)
+
+	// Get config map and its parameters
+	cm := podutils.GetConfigMap()
+	podutils.SetHTTPSettings(cm.Data)
+	SSH = podutils.NewSSHClient(cm.Data["resourceURL"], CREDS_DIR)
+	POLL, _ = strconv.Atoi(cm.Data["updateInterval"])
+	S3 = cm.Data["s3.secret"]
+	var err error
+	JobProp, err = parseJobProperties(cm.Data["jobproperties"])
+	if err != nil {
+		klog.Info("Error in JobProperties provided ", err)
+	}
+
+	// Check access to the login node
+	if err := SSH.Connect(); err != nil {
+		klog.Exit("Failed to connect to PBS login node ", SSH.Address, "; err ", err)
+	}
+
+	// Get ID from config map
+	id := cm.Data["id"]
+
+	// create info for keeping track of execution parameters
+	info := make(map[string]string)
+	info["status.startTime"] = cm.Data["status.startTime"]
+	info["status.endTime"] = ""
+	info["status.message"] = ""
+
+	// If an ID is present in the config map it means that that we have already started a job
+	if len(id) == 0 {
+		klog.Info("PBS Job with name ", JOB_NAME, " does not exist. Submitting new job.")
+
+		var msg string
+		id, msg = submit(cm.Data)
+		info["status.message"] = msg
+
+		if len(id) == 0 {
+			// Failed to submit a job
+			info["status.jobStatus"] = FAILED
+			info["status.endTime"] = time.Now().Format(TIME)
+		} else {
+			info["id"] = id
+			info["status.jobStatus"] = SUBMITTED
+			info["status.startTime"] = time.Now().Format(TIME)
+			info["status.submitTime"] = info["status.startTime"]
+		}
+
+		podutils.UpdateConfigMap(cm, info)
+
+		// Start monitoring or exit
+		if len(id) != 0 {
+			monitor(info)
+		} else {
+			klog.Exit("Failed to start PBS job")
+		}
+	} else {
+		// Job is already running
+		klog.Info("PBS Job has associated ID in ConfigMap. Handling state.")
+		info["id"] = id
+		monitor(info)
+	}
+}
@@ -0,0 +1,263 @@
+//=============================================================================
+// PBS commands
+// Jobs are submitted by qsub, with the script on stdin unless it is on the login node, queried by
+// qstat in JSON format (PBS Pro 18 or later, OpenPBS), including finished jobs kept in history, and deleted by qdel.
+// Job properties are mapped to qsub options:
+//		Queue                       -q
+//		pbsJobName                  -N, job name by default
+//		NodesNumber, CpusPerNode,
+//		Tasks, GpusPerNode, Memory  -l select=<nodes>:ncpus=<cpus>:mpiprocs=<tasks per node>:ngpus=<gpus>:mem=<memory>
+//		select                      -l select, given as is instead of the above
+//		place                       -l place
+//		RunLimitHour, RunLimitMinute -l walltime
+//		OutputFileName, ErrorFileName -o, -e
+//		array                       -J
+//		account                     -A
+//		directWrite                 -k oed, output is written directly to its final location (for tailing)
+//		currentWorkingDir           directory the job is submitted from
+//=============================================================================
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ibm/bridge-operator/podutils"
+)
+
+const (
+	PBS_TIME = "Mon Jan _2 15:04:05 2006" // Time format of qstat
+)
+
+// Job as reported by qstat -f -F json
+type Job struct {
+	ID         string
+	Name       string `json:"Job_Name"`
+	State      string `json:"job_state"`
+	Queue      string `json:"queue"`
+	ExitStatus *int   `json:"Exit_status"`
+	Comment    string `json:"comment"`
+	StartTime  string `json:"stime"`
+	ObitTime   string `json:"obittime"`
+	ModifyTime string `json:"mtime"`
+	OutputPath string `json:"Output_Path"`
+	ErrorPath  string `json:"Error_Path"`
+	JoinPath   string `json:"Join_Path"`
+}
+
+// qstat -F json output
+type QstatResponse struct {
+	Jobs map[string]Job `json:"Jobs"`
+}
+
+// Mapping of PBS job states to operator states. Finished jobs (F) are mapped by exit status
+var STATES = map[string]string{
+	"Q": PENDING,
+	"W": PENDING,
+	"T": PENDING,
+	"M": PENDING,
+	"H": SUSPENDED,
+	"S": SUSPENDED,
+	"U": SUSPENDED,
+	"R": RUNNING,
+	"E": RUNNING,
+	"B": RUNNING,
+	"X": DONE,
+}
+
+// Build qsub command from job properties. Script is read from stdin if path is empty
+func qsubCommand(props map[string]string, path string) string {
+	args := []string{"qsub"}
+	option := func(name string, value string) {
+		if len(value) > 0 {
+			args = append(args, name, podutils.ShellQuote(value))
+		}
+	}
+	name := props["pbsJobName"]
+	if len(name) == 0 {
+		name = JOB_NAME
+	}
+	option("-N", name)
+	option("-q", props["Queue"])
+	option("-A", props["account"])
+	option("-l", "select="+selectStatement(props))
+	option("-l", placeStatement(props))
+	option("-l", walltime(props))
+	option("-o", props["OutputFileName"])
+	option("-e", props["ErrorFileName"])
+	option("-J", props["array"])
+	if props["directWrite"] == "true" {
+		// Output is written to its final location while the job runs, so that it can be tailed
+		option("-k", "oed")
+	}
+	if len(path) > 0 {
+		// Script operand, so that its #PBS directives are applied
+		args = append(args, podutils.ShellQuote(path))
+	} else {
+		args = append(args, "-")
+	}
+	command := strings.Join(args, " ")
+	if dir := props["currentWorkingDir"]; len(dir) > 0 {
+		command = "cd " + podutils.ShellQuote(dir) + " && " + command
+	}
+	return command
+}
+
+// Build select statement of the job, one chunk per node
+func selectStatement(props map[string]string) string {
+	if len(props["select"]) > 0 {
+		return props["select"]
+	}
+	nodes, _ := strconv.Atoi(props["NodesNumber"])
+	if nodes <= 0 {
+		nodes = 1
+	}
+	chunk := []string{strconv.Itoa(nodes)}
+	tasks, _ := strconv.Atoi(props["Tasks"])
+	perNode := 0
+	if tasks > 0 {
+		perNode = (tasks + nodes - 1) / nodes
+	}
+	cpus, _ := strconv.Atoi(props["CpusPerNode"])
+	if cpus < perNode {
+		cpus = perNode
+	}
+	if cpus > 0 {
+		chunk = append(chunk, "ncpus="+strconv.Itoa(cpus))
+	}
+	if perNode > 0 {
+		chunk = append(chunk, "mpiprocs="+strconv.Itoa(perNode))
+	}
+	if len(props["GpusPerNode"]) > 0 {
+		chunk = append(chunk, "ngpus="+props["GpusPerNode"])
+	}
+	if len(props["Memory"]) > 0 {
+		chunk = append(chunk, "mem="+props["Memory"])
+	}
+	return strings.Join(chunk, ":")
+}
+
+// Build place statement of the job
+func placeStatement(props map[string]string) string {
+	if len(props["place"]) == 0 {
+		return ""
+	}
+	return "place=" + props["place"]
+}
+
+// Build walltime of the job from run limit
+func walltime(props map[string]string) string {
+	hours, _ := strconv.Atoi(props["RunLimitHour"])
+	minutes, _ := strconv.Atoi(props["RunLimitMinute"])
+	if hours <= 0 && minutes <= 0 {
+		return ""
+	}
+	hours += minutes / 60
+	return fmt.Sprintf("walltime=%02d:%02d:00", hours, minutes%60)
+}
+
+// Parse job ID from qsub output
+func parseJobID(output []byte) (string, error) {
+	fields := strings.Fields(string(output))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("qsub returned no job ID")
+	}
+	return fields[len(fields)-1], nil
+}
+
+// Parse qstat output of the job. Returns nil if the job is not reported
+func parseQstat(output []byte, id string) (*Job, error) {
+	response := QstatResponse{}
+	if err := json.Unmarshal(output, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse qstat output; err %s", err.Error())
+	}
+	for jobID, job := range response.Jobs {
+		if jobID == id || strings.SplitN(jobID, ".", 2)[0] == strings.SplitN(id, ".", 2)[0] {
+			job.ID = jobID
+			return &job, nil
+		}
+	}
+	return nil, nil
+}
+
+// Get job state. Finished jobs are killed if kill was requested and they did not complete,
+// done with exit status 0, failed otherwise. Jobs deleted or rejected before they ran have no exit status
+func jobState(job *Job, killRequested bool) string {
+	if job.State != "F" {
+		if state, ok := STATES[job.State]; ok {
+			return state
+		}
+		return UNKNOWN
+	}
+	completed := job.ExitStatus != nil && *job.ExitStatus == 0
+	if killRequested && !completed {
+		return KILL
+	}
+	if completed {
+		return DONE
+	}
+	return FAILED
+}
+
+// Describe exit status of finished job
+func exitMessage(job *Job) string {
+	if job.ExitStatus == nil {
+		msg := "Job deleted or rejected by PBS before it ran"
+		if len(job.Comment) > 0 {
+			msg += ": " + job.Comment
+		}
+		return msg
+	}
+	if *job.ExitStatus == 0 {
+		return ""
+	}
+	status := *job.ExitStatus
+	msg := fmt.Sprintf("Job exited with status %d", status)
+	if status > 256 {
+		msg = fmt.Sprintf("Job killed by signal %d", status-256)
+	} else if status < 0 {
+		msg = fmt.Sprintf("Job could not be run by PBS (exit status %d)", status)
+	}
+	if len(job.Comment) > 0 {
+		msg += ": " + job.Comment
+	}
+	return msg
+}
+
+// Convert qstat time to operator time
+func formatTime(t string) string {
+	if len(t) == 0 {
+		return ""
+	}
+	parsed, err := time.ParseInLocation(PBS_TIME, t, time.Local)
+	if err != nil {
+		return ""
+	}
+	return parsed.UTC().Format(TIME)
+}
+
+// Get path of output file (host:path in qstat)
+func outputPath(path string) string {
+	if i := strings.Index(path, ":"); i >= 0 {
+		return path[i+1:]
+	}
+	return path
+}
+
+// Output files of the job, stdout and stderr unless joined
+func outputFiles(job *Job) []string {
+	files := []string{}
+	for _, f := range []string{job.OutputPath, job.ErrorPath} {
+		if f = outputPath(f); len(f) > 0 {
+			files = append(files, f)
+		}
+		if job.JoinPath == "oe" || job.JoinPath == "eo" {
+			break
+		}
+	}
+	return files
+}
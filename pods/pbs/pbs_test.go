@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+)
+
+const qstatOutput = `{
+  "timestamp": 1697712000,
+  "pbs_version": "22.05.11",
+  "pbs_server": "pbs01",
+  "Jobs": {
+    "1234.pbs01": {
+      "Job_Name": "pbsjob",
+      "job_state": "F",
+      "queue": "workq",
+      "Exit_status": 271,
+      "comment": "Job run at Thu Oct 19 at 10:00 on (node1:ncpus=4) and finished",
+      "stime": "Thu Oct 19 10:00:00 2023",
+      "obittime": "Thu Oct 19 10:05:00 2023",
+      "Output_Path": "login01:/home/user/pbsjob.o1234",
+      "Error_Path": "login01:/home/user/pbsjob.e1234",
+      "Join_Path": "oe"
+    }
+  }
+}`
+
+// Typed resources are mapped to select and walltime, script is read from stdin in the working directory
+func TestQsubCommand(t *testing.T) {
+	JOB_NAME = "pbsjob"
+	props := map[string]string{
+		"Queue":             "workq",
+		"NodesNumber":       "2",
+		"Tasks":             "6",
+		"GpusPerNode":       "1",
+		"RunLimitHour":      "1",
+		"RunLimitMinute":    "90",
+		"directWrite":       "true",
+		"currentWorkingDir": "/scratch/run 1",
+	}
+	expected := "cd '/scratch/run 1' && qsub -N 'pbsjob' -q 'workq' -l 'select=2:ncpus=3:mpiprocs=3:ngpus=1' " +
+		"-l 'walltime=02:30:00' -k 'oed' -"
+	if command := qsubCommand(props, ""); command != expected {
+		t.Errorf("unexpected command %s", command)
+	}
+	expected = "qsub -N 'train' -l 'select=1:ncpus=8:mem=16gb' -l 'place=scatter' '/home/user/train.sh'"
+	props = map[string]string{"pbsJobName": "train", "select": "1:ncpus=8:mem=16gb", "place": "scatter"}
+	if command := qsubCommand(props, "/home/user/train.sh"); command != expected {
+		t.Errorf("unexpected command %s", command)
+	}
+}
+
+// CPUs per node are raised to fit the tasks on each node
+func TestSelectStatement(t *testing.T) {
+	tests := map[string]map[string]string{
+		"1":                             {},
+		"4:ncpus=2:mpiprocs=2":          {"NodesNumber": "4", "Tasks": "7"},
+		"2:ncpus=16:mpiprocs=4:mem=4gb": {"NodesNumber": "2", "Tasks": "8", "CpusPerNode": "16", "Memory": "4gb"},
+	}
+	for expected, props := range tests {
+		if statement := selectStatement(props); statement != expected {
+			t.Errorf("expected %s, got %s", expected, statement)
+		}
+	}
+}
+
+func TestParseQstat(t *testing.T) {
+	job, err := parseQstat([]byte(qstatOutput), "1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job == nil || job.ID != "1234.pbs01" || job.ExitStatus == nil || *job.ExitStatus != 271 {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	if files := outputFiles(job); len(files) != 1 || files[0] != "/home/user/pbsjob.o1234" {
+		t.Errorf("unexpected output files %v", files)
+	}
+	if msg := exitMessage(job); msg != "Job killed by signal 15: "+job.Comment {
+		t.Errorf("unexpected message %s", msg)
+	}
+	if job, _ := parseQstat([]byte(qstatOutput), "99.pbs01"); job != nil {
+		t.Error("unexpected job found")
+	}
+}
+
+// Finished jobs are mapped by exit status and kill request
+func TestJobState(t *testing.T) {
+	zero, failed := 0, 1
+	tests := []struct {
+		job   Job
+		kill  bool
+		state string
+	}{
+		{Job{State: "Q"}, false, PENDING},
+		{Job{State: "H"}, false, SUSPENDED},
+		{Job{State: "E"}, true, RUNNING},
+		{Job{State: "F", ExitStatus: &zero}, false, DONE},
+		{Job{State: "F", ExitStatus: &zero}, true, DONE},
+		{Job{State: "F", ExitStatus: &failed}, false, FAILED},
+		{Job{State: "F", ExitStatus: &failed}, true, KILL},
+		{Job{State: "F"}, true, KILL},
+		{Job{State: "F"}, false, FAILED},
+		{Job{State: "Z"}, false, UNKNOWN},
+	}
+	for _, test := range tests {
+		if state := jobState(&test.job, test.kill); state != test.state {
+			t.Errorf("job %+v, kill %t: expected %s, got %s", test.job, test.kill, test.state, state)
+		}
+	}
+}
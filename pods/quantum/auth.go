@@ -0,0 +1,63 @@
+//=============================================================================
+// Quantum service credentials
+// Credentials are read from the resource secret, the client exchanges them for IAM bearer tokens:
+//		apikey  - API key exchanged for the token (password is accepted for compatibility)
+//		profile - trusted profile (ID or name), the compute resource token of the pod's service account
+//		          (projected volume) is exchanged for the token, used if there is no API key
+//		iamurl  - IAM token endpoint, https://iam.cloud.ibm.com/identity/token by default
+// The service instance is given by crn (username is accepted for compatibility), instance (hub/group/project)
+// is the default instance for backend selection
+//=============================================================================
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ibm/bridge-operator/quantum-pod/client"
+)
+
+var credsDir = CREDS_DIR // Directory of the mounted resource secret
+
+// Read credentials from the resource secret. Called on every login, so that rotated secrets are picked up.
+// All keys are optional, required combinations are checked by Credentials.Validate
+func readCredentials() (client.Credentials, error) {
+	creds := client.Credentials{}
+	fields := []struct {
+		value *string
+		keys  []string
+	}{
+		{&creds.CRN, []string{"crn", "username"}},
+		{&creds.Instance, []string{"instance"}},
+		{&creds.APIKey, []string{"apikey", "password"}},
+		{&creds.Profile, []string{"profile"}},
+		{&creds.IAMURL, []string{"iamurl"}},
+	}
+	for _, field := range fields {
+		value, err := readCred(field.keys...)
+		if err != nil {
+			return creds, err
+		}
+		*field.value = value
+	}
+	return creds, nil
+}
+
+// Read credential, the first of keys present. Returns "" if none of them is in the secret
+func readCred(keys ...string) (string, error) {
+	for _, key := range keys {
+		content, err := os.ReadFile(credsDir + key)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("reading credential %s failed; err %s", key, err.Error())
+		}
+		if value := strings.TrimSpace(string(content)); len(value) > 0 {
+			return value, nil
+		}
+	}
+	return "", nil
+}
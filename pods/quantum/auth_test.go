@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ibm/bridge-operator/quantum-pod/client"
+)
+
+// Current keys take precedence over the ones accepted for compatibility, empty values are skipped
+func TestReadCredentials(t *testing.T) {
+	tests := []struct {
+		secret map[string]string
+		creds  client.Credentials
+	}{
+		{map[string]string{}, client.Credentials{}},
+		{map[string]string{"username": "crn:v1:old\n", "password": " old-key "},
+			client.Credentials{CRN: "crn:v1:old", APIKey: "old-key"}},
+		{map[string]string{"crn": "crn:v1:new", "username": "crn:v1:old", "apikey": "new-key", "password": "old-key"},
+			client.Credentials{CRN: "crn:v1:new", APIKey: "new-key"}},
+		{map[string]string{"crn": "\n", "username": "crn:v1:old", "apikey": "", "password": "old-key"},
+			client.Credentials{CRN: "crn:v1:old", APIKey: "old-key"}},
+		{map[string]string{"instance": "ibm-q/open/main", "profile": "Profile-1234", "iamurl": "https://iam.test.cloud.ibm.com/identity/token"},
+			client.Credentials{Instance: "ibm-q/open/main", Profile: "Profile-1234", IAMURL: "https://iam.test.cloud.ibm.com/identity/token"}},
+	}
+	saved := credsDir
+	defer func() { credsDir = saved }()
+	for _, test := range tests {
+		credsDir = t.TempDir() + "/"
+		for key, value := range test.secret {
+			if err := os.WriteFile(filepath.Join(credsDir, key), []byte(value), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		creds, err := readCredentials()
+		if err != nil {
+			t.Errorf("%v: %v", test.secret, err)
+		} else if creds != test.creds {
+			t.Errorf("%v: got %+v, expected %+v", test.secret, creds, test.creds)
+		}
+	}
+
+	// Unreadable credential is reported
+	credsDir = t.TempDir() + "/"
+	if err := os.Mkdir(filepath.Join(credsDir, "crn"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readCredentials(); err == nil {
+		t.Error("unreadable credential not reported")
+	}
+}
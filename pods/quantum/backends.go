@@ -0,0 +1,97 @@
+//=============================================================================
+// Backend selection
+// Backend is given by name, or selected from the backends available to the service instance
+// by number of qubits, simulator or hardware and instance (hub/group/project). With the
+// least-busy policy the operational backend with the fewest pending jobs is chosen
+//=============================================================================
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/klog"
+)
+
+const (
+	POLICY_LEAST_BUSY = "least-busy"
+)
+
+// Backend selector (backendSelector job property)
+type BackendSelector struct {
+	MinQubits int    `json:"minQubits"` // Minimum number of qubits
+	Simulator *bool  `json:"simulator"` // Simulator or hardware, any if not set
+	Instance  string `json:"instance"`  // Instance (hub/group/project) providing the backend
+}
+
+// Get backend for the job. Empty backend is returned for programs if neither backend nor selector is given,
+// the service chooses one then. Backend may be a comma separated list of candidates for the least-busy policy
+func selectBackend() (string, error) {
+	candidates := []string{}
+	for _, name := range strings.Split(PROPS.Backend, ",") {
+		if name = strings.TrimSpace(name); len(name) > 0 {
+			candidates = append(candidates, name)
+		}
+	}
+	leastBusy := PROPS.BackendPolicy == POLICY_LEAST_BUSY
+	if len(PROPS.BackendPolicy) > 0 && !leastBusy {
+		return "", fmt.Errorf("unknown backend policy %s, expected %s", PROPS.BackendPolicy, POLICY_LEAST_BUSY)
+	}
+	if len(candidates) == 1 && !leastBusy {
+		return candidates[0], nil
+	}
+	if len(candidates) == 0 && PROPS.BackendSelector == nil && !leastBusy {
+		return "", nil
+	}
+
+	// Get available backends
+	selector := PROPS.BackendSelector
+	if selector == nil {
+		selector = &BackendSelector{}
+	}
+	if len(candidates) == 0 {
+		var err error
+		if candidates, err = CLIENT.ListBackends(selector.Instance); err != nil {
+			return "", err
+		}
+	}
+	sort.Strings(candidates)
+
+	// Filter them and pick the first or the least busy one
+	chosen, queue := "", 0
+	for _, name := range candidates {
+		if selector.MinQubits > 0 || selector.Simulator != nil {
+			config, err := CLIENT.GetBackendConfiguration(name)
+			if err != nil {
+				klog.Info("Skipping backend ", name, "; err ", err)
+				continue
+			}
+			if config.NumQubits < selector.MinQubits || selector.Simulator != nil && config.Simulator != *selector.Simulator {
+				continue
+			}
+		}
+		status, err := CLIENT.GetBackendStatus(name)
+		if err != nil {
+			klog.Info("Skipping backend ", name, "; err ", err)
+			continue
+		}
+		if !status.State || len(status.Status) > 0 && !strings.EqualFold(status.Status, "active") {
+			klog.Info("Skipping backend ", name, " in status ", status.Status, " ", status.Message)
+			continue
+		}
+		klog.Info("Backend ", name, " matches, pending jobs ", status.LengthQueue)
+		if len(chosen) == 0 || leastBusy && status.LengthQueue < queue {
+			chosen, queue = name, status.LengthQueue
+		}
+		if !leastBusy {
+			break
+		}
+	}
+	if len(chosen) == 0 {
+		return "", fmt.Errorf("no operational backend matches the selection (%d candidates)", len(candidates))
+	}
+	klog.Info("Selected backend ", chosen, " with ", queue, " pending jobs")
+	return chosen, nil
+}
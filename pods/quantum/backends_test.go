@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ibm/bridge-operator/quantum-pod/client"
+)
+
+// Fake backend of the quantum service
+type fakeBackend struct {
+	instance string
+	config   client.BackendConfiguration
+	status   client.BackendStatus
+}
+
+// Serve backends, their configuration and status. Backends of other instances are not listed
+func serveBackends(backends map[string]fakeBackend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		var result interface{}
+		switch {
+		case len(path) == 1 && path[0] == "backends":
+			devices := []string{}
+			for name, backend := range backends {
+				if provider := r.URL.Query().Get("provider"); len(provider) == 0 || provider == backend.instance {
+					devices = append(devices, name)
+				}
+			}
+			result = client.BackendsResponse{Devices: devices}
+		case len(path) == 3 && path[2] == "configuration" && len(backends[path[1]].config.Name) > 0:
+			result = backends[path[1]].config
+		case len(path) == 3 && path[2] == "status" && len(backends[path[1]].status.Name) > 0:
+			result = backends[path[1]].status
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+func TestSelectBackend(t *testing.T) {
+	backend := func(instance, name string, qubits int, simulator bool, status string, queue int) fakeBackend {
+		return fakeBackend{instance: instance,
+			config: client.BackendConfiguration{Name: name, NumQubits: qubits, Simulator: simulator},
+			status: client.BackendStatus{Name: name, State: status == "active", Status: status, LengthQueue: queue}}
+	}
+	fakeService(t, serveBackends(map[string]fakeBackend{
+		"ibm_brisbane":   backend("ibm-q/open/main", "ibm_brisbane", 127, false, "active", 40),
+		"ibm_kyiv":       backend("ibm-q/open/main", "ibm_kyiv", 127, false, "active", 5),
+		"ibm_sherbrooke": backend("ibm-q/open/main", "ibm_sherbrooke", 127, false, "active", 2),
+		"ibm_torino":     backend("ibm-q/premium/main", "ibm_torino", 133, false, "active", 0),
+		"ibm_nazca":      backend("ibm-q/open/main", "ibm_nazca", 127, false, "maintenance", 0),
+		"ibm_small":      backend("ibm-q/open/main", "ibm_small", 5, false, "active", 0),
+		"simulator_mps":  backend("ibm-q/open/main", "simulator_mps", 100, true, "active", 1),
+		"ibm_unknown":    {instance: "ibm-q/open/main"},
+	}))
+	yes, no := true, false
+	tests := []struct {
+		backend  string
+		policy   string
+		selector *BackendSelector
+		selected string
+		err      string
+	}{
+		{"", "", nil, "", ""},
+		{"ibm_kyiv", "", nil, "ibm_kyiv", ""},
+		{"ibm_missing", "", nil, "ibm_missing", ""},
+		{"ibm_brisbane, ibm_kyiv", "", nil, "ibm_brisbane", ""},
+		{"ibm_nazca, ibm_kyiv", "", nil, "ibm_kyiv", ""},
+		{"ibm_brisbane,ibm_kyiv,ibm_sherbrooke", POLICY_LEAST_BUSY, nil, "ibm_sherbrooke", ""},
+		{"ibm_kyiv", POLICY_LEAST_BUSY, nil, "ibm_kyiv", ""},
+		{"ibm_nazca", POLICY_LEAST_BUSY, nil, "", "no operational backend"},
+		{"", POLICY_LEAST_BUSY, &BackendSelector{Simulator: &no, Instance: "ibm-q/open/main"}, "ibm_small", ""},
+		{"", POLICY_LEAST_BUSY, &BackendSelector{MinQubits: 100, Simulator: &no, Instance: "ibm-q/open/main"}, "ibm_sherbrooke", ""},
+		{"", POLICY_LEAST_BUSY, &BackendSelector{MinQubits: 100, Simulator: &no}, "ibm_torino", ""},
+		{"", "", &BackendSelector{Simulator: &yes}, "simulator_mps", ""},
+		{"", "", &BackendSelector{MinQubits: 100, Simulator: &no}, "ibm_brisbane", ""},
+		{"ibm_small,ibm_torino", "", &BackendSelector{MinQubits: 100}, "ibm_torino", ""},
+		{"", "", &BackendSelector{MinQubits: 200}, "", "no operational backend matches the selection (8 candidates)"},
+		{"", "", &BackendSelector{Instance: "ibm-q/none/main"}, "", "no operational backend matches the selection (0 candidates)"},
+		{"ibm_kyiv", "random", nil, "", "unknown backend policy random"},
+	}
+	saved := PROPS
+	defer func() { PROPS = saved }()
+	for _, test := range tests {
+		PROPS = QuantumProperties{Backend: test.backend, BackendPolicy: test.policy, BackendSelector: test.selector}
+		selected, err := selectBackend()
+		if len(test.err) == 0 && err != nil {
+			t.Errorf("%s %s %+v: %v", test.backend, test.policy, test.selector, err)
+		} else if len(test.err) > 0 && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s %s %+v: got error %v, expected %s", test.backend, test.policy, test.selector, err, test.err)
+		}
+		if selected != test.selected {
+			t.Errorf("%s %s %+v: got %s, expected %s", test.backend, test.policy, test.selector, selected, test.selected)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+//=============================================================================
+// Authentication to Qiskit Runtime
+// Requests carry an IBM Cloud IAM bearer token, obtained either from an API key, or from
+// a compute resource token (e.g. projected service account token) of a trusted profile
+//=============================================================================
+
+package client
+
+import (
+	"encoding/json"
+	e "errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ibm/bridge-operator/podutils"
+)
+
+const (
+	IAM_URL  = "https://iam.cloud.ibm.com/identity/token"
+	CR_TOKEN = "/var/run/secrets/tokens/sa-token" // Projected service account token used as compute resource token
+)
+
+// Credentials of the service
+type Credentials struct {
+	CRN         string // Service instance CRN, sent as Service-CRN
+	Instance    string // Instance (hub/group/project)
+	APIKey      string // API key exchanged for the token
+	Profile     string // Trusted profile ID (Profile-...) or name, used if there is no API key
+	IAMURL      string // IAM token endpoint, IAM_URL if not set
+	CRTokenFile string // Compute resource token of the trusted profile, CR_TOKEN if not set
+}
+
+// Validate credentials
+func (c *Credentials) Validate() error {
+	if len(c.CRN) == 0 && len(c.Instance) == 0 {
+		return e.New("service CRN or instance missing in credentials")
+	}
+	if len(c.APIKey) == 0 && len(c.Profile) == 0 {
+		return e.New("API key or trusted profile missing in credentials")
+	}
+	return nil
+}
+
+// Exchange API key or compute resource token for IAM token. Returns token and its expiry
+func IAMToken(creds Credentials) (string, time.Time, error) {
+	iamURL := creds.IAMURL
+	if len(iamURL) == 0 {
+		iamURL = IAM_URL
+	}
+	form := url.Values{}
+	if len(creds.APIKey) > 0 {
+		form.Set("grant_type", "urn:ibm:params:oauth:grant-type:apikey")
+		form.Set("apikey", creds.APIKey)
+	} else {
+		tokenFile := creds.CRTokenFile
+		if len(tokenFile) == 0 {
+			tokenFile = CR_TOKEN
+		}
+		crToken, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("failed to read compute resource token; err %s", err.Error())
+		}
+		form.Set("grant_type", "urn:ibm:params:oauth:grant-type:cr-token")
+		form.Set("cr_token", strings.TrimSpace(string(crToken)))
+		if strings.HasPrefix(creds.Profile, "Profile-") {
+			form.Set("profile_id", creds.Profile)
+		} else {
+			form.Set("profile_name", creds.Profile)
+		}
+	}
+
+	req, err := http.NewRequest("POST", iamURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	respBody, statusCode := podutils.SendReq(req)
+	if statusCode != 200 {
+		return "", time.Time{}, fmt.Errorf("IAM token request not successful, status code %d", statusCode)
+	}
+	response := IAMTokenResponse{}
+	if err := json.Unmarshal(respBody, &response); err != nil || len(response.AccessToken) == 0 {
+		return "", time.Time{}, e.New("IAM token endpoint returned no token")
+	}
+	expiry := time.Time{}
+	if response.Expiration > 0 {
+		expiry = time.Unix(response.Expiration, 0)
+	} else if response.ExpiresIn > 0 {
+		expiry = time.Now().Add(time.Duration(response.ExpiresIn) * time.Second)
+	}
+	return response.AccessToken, expiry, nil
+}
@@ -0,0 +1,182 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		creds Credentials
+		err   string
+	}{
+		{Credentials{CRN: "crn:v1", APIKey: "key"}, ""},
+		{Credentials{Instance: "ibm-q/open/main", Profile: "Profile-1"}, ""},
+		{Credentials{CRN: "crn:v1", Instance: "ibm-q/open/main", APIKey: "key", Profile: "bridge"}, ""},
+		{Credentials{APIKey: "key"}, "service CRN or instance missing"},
+		{Credentials{CRN: "crn:v1"}, "API key or trusted profile missing"},
+		{Credentials{}, "service CRN or instance missing"},
+	}
+	for _, test := range tests {
+		err := test.creds.Validate()
+		if len(test.err) == 0 && err != nil {
+			t.Errorf("%+v: %v", test.creds, err)
+		} else if len(test.err) > 0 && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%+v: got error %v, expected %s", test.creds, err, test.err)
+		}
+	}
+}
+
+// Fake IAM token endpoint, records token request forms
+type fakeIAM struct {
+	lock     sync.Mutex
+	forms    []map[string]string
+	response func(n int) (int, string) // Status code and body of n-th token request
+}
+
+func (f *fakeIAM) serve(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	form := map[string]string{}
+	for key := range r.PostForm {
+		form[key] = r.PostForm.Get(key)
+	}
+	f.lock.Lock()
+	f.forms = append(f.forms, form)
+	n := len(f.forms)
+	f.lock.Unlock()
+	code, body := f.response(n)
+	w.WriteHeader(code)
+	w.Write([]byte(body))
+}
+
+func TestIAMToken(t *testing.T) {
+	crToken := filepath.Join(t.TempDir(), "sa-token")
+	if err := os.WriteFile(crToken, []byte("cr-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	expiration := time.Now().Add(time.Hour).Unix()
+	tests := []struct {
+		creds  Credentials
+		code   int
+		body   string
+		form   map[string]string
+		expiry func(expiry time.Time) bool
+		err    string
+	}{
+		{Credentials{APIKey: "key", Profile: "ignored"}, 200, fmt.Sprintf(`{"access_token": "t", "expiration": %d}`, expiration),
+			map[string]string{"grant_type": "urn:ibm:params:oauth:grant-type:apikey", "apikey": "key"},
+			func(expiry time.Time) bool { return expiry.Unix() == expiration }, ""},
+		{Credentials{Profile: "Profile-1234", CRTokenFile: crToken}, 200, `{"access_token": "t", "expires_in": 3600}`,
+			map[string]string{"grant_type": "urn:ibm:params:oauth:grant-type:cr-token", "cr_token": "cr-token", "profile_id": "Profile-1234"},
+			func(expiry time.Time) bool {
+				return time.Until(expiry) > 59*time.Minute && time.Until(expiry) <= time.Hour
+			}, ""},
+		{Credentials{Profile: "bridge", CRTokenFile: crToken}, 200, `{"access_token": "t"}`,
+			map[string]string{"grant_type": "urn:ibm:params:oauth:grant-type:cr-token", "cr_token": "cr-token", "profile_name": "bridge"},
+			func(expiry time.Time) bool { return expiry.IsZero() }, ""},
+		{Credentials{Profile: "bridge", CRTokenFile: crToken + ".missing"}, 200, `{"access_token": "t"}`,
+			nil, nil, "failed to read compute resource token"},
+		{Credentials{APIKey: "key"}, 400, `{"errorMessage": "invalid key"}`,
+			map[string]string{"grant_type": "urn:ibm:params:oauth:grant-type:apikey", "apikey": "key"}, nil, "status code 400"},
+		{Credentials{APIKey: "key"}, 200, `{"expires_in": 3600}`,
+			map[string]string{"grant_type": "urn:ibm:params:oauth:grant-type:apikey", "apikey": "key"}, nil, "returned no token"},
+	}
+	for _, test := range tests {
+		iam := &fakeIAM{response: func(int) (int, string) { return test.code, test.body }}
+		server := httptest.NewServer(http.HandlerFunc(iam.serve))
+		test.creds.IAMURL = server.URL
+		token, expiry, err := IAMToken(test.creds)
+		server.Close()
+
+		if len(test.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%+v: got error %v, expected %s", test.creds, err, test.err)
+			}
+		} else if err != nil || token != "t" || !test.expiry(expiry) {
+			t.Errorf("%+v: got token %s expiry %v error %v", test.creds, token, expiry, err)
+		}
+		if test.form == nil && len(iam.forms) > 0 {
+			t.Errorf("%+v: unexpected token request %v", test.creds, iam.forms)
+		} else if test.form != nil && (len(iam.forms) != 1 || !reflect.DeepEqual(iam.forms[0], test.form)) {
+			t.Errorf("%+v: got token requests %v, expected %v", test.creds, iam.forms, test.form)
+		}
+	}
+}
+
+// Tokens are reused until they are about to expire or rejected, every login reads the current credentials
+func TestClientTokenRefresh(t *testing.T) {
+	iam := &fakeIAM{}
+	expiresIn := 3600
+	iam.response = func(n int) (int, string) {
+		return 200, fmt.Sprintf(`{"access_token": "t%d", "expires_in": %d}`, n, expiresIn)
+	}
+	iamServer := httptest.NewServer(http.HandlerFunc(iam.serve))
+	defer iamServer.Close()
+
+	requests := []string{}
+	rejected := map[string]bool{}
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		requests = append(requests, token+" "+r.Header.Get("Service-CRN"))
+		if rejected[token] {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"programs": []}`))
+	}))
+	defer service.Close()
+
+	creds := Credentials{CRN: "crn-1", APIKey: "key-1", IAMURL: iamServer.URL}
+	c := New(service.URL, func() (Credentials, error) { return creds, nil })
+	steps := []struct {
+		update   func()
+		requests []string
+		apikey   string
+	}{
+		{func() {}, []string{"t1 crn-1"}, "key-1"},
+		{func() {}, []string{"t1 crn-1"}, ""},
+		// Rotated credentials are used once the token is rejected
+		{func() {
+			creds = Credentials{CRN: "crn-2", APIKey: "key-2", IAMURL: iamServer.URL}
+			rejected["t1"] = true
+		}, []string{"t1 crn-1", "t2 crn-2"}, "key-2"},
+		{func() { expiresIn = 30 }, []string{"t2 crn-2"}, ""},
+		// Token expiring within the margin is renewed before the next request
+		{func() { c.Token.Invalidate() }, []string{"t3 crn-2"}, "key-2"},
+		{func() {}, []string{"t4 crn-2"}, "key-2"},
+	}
+	for i, step := range steps {
+		step.update()
+		requests = nil
+		logins := len(iam.forms)
+		if _, err := c.ListPrograms(""); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(requests, step.requests) {
+			t.Errorf("step %d: got requests %v, expected %v", i, requests, step.requests)
+		}
+		login := len(iam.forms) > logins
+		if login != (len(step.apikey) > 0) || login && iam.forms[len(iam.forms)-1]["apikey"] != step.apikey {
+			t.Errorf("step %d: unexpected token requests %v", i, iam.forms[logins:])
+		}
+	}
+
+	// Invalid credentials are not sent to the IAM endpoint
+	creds = Credentials{APIKey: "key-3", IAMURL: iamServer.URL}
+	c.Token.Invalidate()
+	logins := len(iam.forms)
+	if _, err := c.ListPrograms(""); err == nil {
+		t.Error("request without service CRN succeeded")
+	}
+	if len(iam.forms) != logins {
+		t.Errorf("token requested for invalid credentials: %v", iam.forms[logins:])
+	}
+}
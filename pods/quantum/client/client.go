@@ -0,0 +1,273 @@
+//=============================================================================
+// Qiskit Runtime client
+// Client of the quantum service used by the quantum pod and the bridge-quantum CLI.
+// Programs API (programs, jobs of programs) and Qiskit Runtime API (sessions, primitive jobs, backends),
+// requests of the latter carry the IBM-API-Version header
+//=============================================================================
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ibm/bridge-operator/podutils"
+)
+
+const (
+	RUNTIME_API = "2024-01-01" // Qiskit Runtime API version
+)
+
+// Quantum service client
+type Client struct {
+	URL   string                 // Service URL
+	Token podutils.TokenProvider // IAM token provider
+
+	creds func() (Credentials, error) // Credentials, read on every login so that rotated secrets are picked up
+	lock  sync.Mutex
+	crn   string // Service CRN of the current credentials
+}
+
+// Create client for the service URL
+func New(serviceURL string, creds func() (Credentials, error)) *Client {
+	if !strings.HasSuffix(serviceURL, "/") {
+		serviceURL += "/"
+	}
+	c := &Client{URL: serviceURL, creds: creds}
+	c.Token = podutils.NewTokenProvider(c.login)
+	return c
+}
+
+// Get IAM token for the current credentials
+func (c *Client) login() (string, time.Time, error) {
+	creds, err := c.creds()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if err := creds.Validate(); err != nil {
+		return "", time.Time{}, err
+	}
+	c.lock.Lock()
+	c.crn = creds.CRN
+	c.lock.Unlock()
+	return IAMToken(creds)
+}
+
+// Send request authenticated by IAM token
+func (c *Client) send(method, path string, body interface{}, runtime bool) ([]byte, int, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return nil, 0, err
+		}
+	}
+	req, err := http.NewRequest(method, c.URL+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, err
+	}
+	if runtime {
+		req.Header.Set("IBM-API-Version", RUNTIME_API)
+	}
+	respBody, statusCode := podutils.SendAuthReq(req, c.Token, func(req *http.Request, token string) {
+		req.Header.Set("Content-Type", "application/json")
+		c.lock.Lock()
+		if len(c.crn) > 0 {
+			req.Header.Set("Service-CRN", c.crn)
+		}
+		c.lock.Unlock()
+		req.Header.Set("Authorization", "Bearer "+token)
+	})
+	return respBody, statusCode, nil
+}
+
+// Send request and check its status code
+func (c *Client) call(method, path string, body interface{}, runtime bool, what string, codes ...int) ([]byte, error) {
+	respBody, statusCode, err := c.send(method, path, body, runtime)
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s request; err %s", what, err.Error())
+	}
+	for _, code := range codes {
+		if statusCode == code {
+			return respBody, nil
+		}
+	}
+	return respBody, fmt.Errorf("%s not successful, status code %d %s", what, statusCode, strings.TrimSpace(string(respBody)))
+}
+
+// List programs, with the given name if not empty
+func (c *Client) ListPrograms(name string) ([]Program, error) {
+	path := "programs"
+	if len(name) > 0 {
+		path += "?name=" + url.QueryEscape(name)
+	}
+	respBody, err := c.call("GET", path, nil, false, "retrieving programs", 200)
+	if err != nil {
+		return nil, err
+	}
+	programs := PaginatedProgramsResponse{}
+	if err := json.Unmarshal(respBody, &programs); err != nil {
+		return nil, err
+	}
+	return programs.Programs, nil
+}
+
+// Add program
+func (c *Client) AddProgram(request ProgramSubmissionRequest) (*Program, error) {
+	respBody, err := c.call("POST", "programs", request, false, "creating program", 201)
+	if err != nil {
+		return nil, err
+	}
+	program := Program{}
+	if err := json.Unmarshal(respBody, &program); err != nil {
+		return nil, err
+	}
+	return &program, nil
+}
+
+// Delete program
+func (c *Client) DeleteProgram(programID string) error {
+	_, err := c.call("DELETE", "programs/"+programID, nil, false, "deleting program", 204)
+	return err
+}
+
+// Submit job of program
+func (c *Client) SubmitJob(request JobRunParams) (string, error) {
+	return c.submit(request, false)
+}
+
+// Submit primitive job
+func (c *Client) SubmitPrimitive(request PrimitiveJobRequest) (string, error) {
+	return c.submit(request, true)
+}
+
+// Submit job request, returns job ID
+func (c *Client) submit(request interface{}, runtime bool) (string, error) {
+	respBody, err := c.call("POST", "jobs", request, runtime, "submitting job", 200, 201)
+	if err != nil {
+		return "", err
+	}
+	res := JobSubmitResult{}
+	if err := json.Unmarshal(respBody, &res); err != nil || len(res.ID) == 0 {
+		return "", fmt.Errorf("failed to parse job submission response %s", string(respBody))
+	}
+	return res.ID, nil
+}
+
+// Get job status
+func (c *Client) GetJob(jobID string) (*JobStatusResult, error) {
+	respBody, err := c.call("GET", "jobs/"+jobID, nil, false, "retrieving job", 200)
+	if err != nil {
+		return nil, err
+	}
+	job := JobStatusResult{}
+	if err := json.Unmarshal(respBody, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Get job results
+func (c *Client) JobResults(jobID string) ([]byte, error) {
+	return c.call("GET", "jobs/"+jobID+"/results", nil, false, "retrieving job results", 200)
+}
+
+// Get job interim results, empty if none were published yet
+func (c *Client) JobInterimResults(jobID string) ([]byte, error) {
+	respBody, statusCode, err := c.send("GET", "jobs/"+jobID+"/interim_results", nil, false)
+	if err != nil {
+		return nil, err
+	}
+	switch statusCode {
+	case 200:
+		return respBody, nil
+	case 204, 404:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("retrieving job interim results not successful, status code %d", statusCode)
+}
+
+// Get job logs
+func (c *Client) JobLogs(jobID string) ([]byte, error) {
+	return c.call("GET", "jobs/"+jobID+"/logs", nil, false, "retrieving job logs", 200)
+}
+
+// Cancel job
+func (c *Client) CancelJob(jobID string) error {
+	_, err := c.call("POST", "jobs/"+jobID+"/cancel", nil, false, "cancelling job", 204)
+	return err
+}
+
+// Delete job
+func (c *Client) DeleteJob(jobID string) error {
+	_, err := c.call("DELETE", "jobs/"+jobID, nil, false, "deleting job", 204)
+	return err
+}
+
+// Open session (mode dedicated) or batch, returns session ID
+func (c *Client) OpenSession(mode, backend string, maxTTL int) (string, error) {
+	respBody, err := c.call("POST", "sessions", SessionRequest{Mode: mode, Backend: backend, MaxTTL: maxTTL}, true,
+		"opening "+mode, 200, 201)
+	if err != nil {
+		return "", err
+	}
+	session := SessionResponse{}
+	if err := json.Unmarshal(respBody, &session); err != nil || len(session.ID) == 0 {
+		return "", fmt.Errorf("failed to parse session response %s", string(respBody))
+	}
+	return session.ID, nil
+}
+
+// Close session, so that it does not accept new jobs. Submitted jobs still run
+func (c *Client) CloseSession(sessionID string) error {
+	_, err := c.call("PATCH", "sessions/"+sessionID, map[string]bool{"accepting_jobs": false}, true, "closing session", 200, 204)
+	return err
+}
+
+// Cancel session, queued jobs of the session are cancelled
+func (c *Client) CancelSession(sessionID string) error {
+	_, err := c.call("DELETE", "sessions/"+sessionID+"/close", nil, true, "cancelling session", 200, 204)
+	return err
+}
+
+// List backends available to the service instance, provided by the instance (hub/group/project) if not empty
+func (c *Client) ListBackends(instance string) ([]string, error) {
+	path := "backends"
+	if len(instance) > 0 {
+		path += "?provider=" + url.QueryEscape(instance)
+	}
+	backends := BackendsResponse{}
+	if err := c.getJSON(path, "retrieving backends", &backends); err != nil {
+		return nil, err
+	}
+	return backends.Devices, nil
+}
+
+// Get backend configuration
+func (c *Client) GetBackendConfiguration(name string) (*BackendConfiguration, error) {
+	config := BackendConfiguration{}
+	err := c.getJSON("backends/"+name+"/configuration", "retrieving backend configuration", &config)
+	return &config, err
+}
+
+// Get backend status, including the number of pending jobs
+func (c *Client) GetBackendStatus(name string) (*BackendStatus, error) {
+	status := BackendStatus{}
+	err := c.getJSON("backends/"+name+"/status", "retrieving backend status", &status)
+	return &status, err
+}
+
+// Get Qiskit Runtime resource
+func (c *Client) getJSON(path, what string, result interface{}) error {
+	respBody, err := c.call("GET", path, nil, true, what, 200)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(respBody, result)
+}
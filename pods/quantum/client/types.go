@@ -0,0 +1,166 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Structures for JSON conversion
+
+// Program definition
+type Program struct {
+	ID           string      `json:"id" program:"id" job:"id"`
+	Name         string      `json:"name" program:"name,omitempty" job:"-" binding:"required"`
+	Cost         int         `json:"cost" program:"cost,omitempty" job:"-" db:"cost"`
+	Description  string      `json:"description,omitempty" program:"description,omitempty" job:"-" db:"description"`
+	Spec         ProgramSpec `json:"spec,omitempty" program:"spec,omitempty" job:"-" db:"spec"`
+	Data         []byte      `json:"data,omitempty" program:"-" job:"-" db:"data"`
+	CreationDate time.Time   `json:"creation_date,omitempty" program:"creation_date,omitempty" job:"-" db:"created_time"`
+	UpdateDate   time.Time   `json:"update_date,omitempty" program:"update_date,omitempty" job:"-" db:"updated_time"`
+	IsPublic     bool        `json:"is_public,omitempty" program:"is_public,omitempty" job:"-" db:"is_public"`
+}
+
+// Parameter definition used in Program spec
+type Parameter struct {
+	Description string `json:"description,omitempty"`
+	Type        string `json:"type,omitempty"`
+	Minimum     string `json:"minimum,omitempty"`
+	Maximum     string `json:"maximum,omitempty"`
+	Default     string `json:"default,omitempty"`
+}
+
+// List of parameters used in program spec
+type ParameterList struct {
+	Properties map[string]Parameter `json:"properties"`
+	Schema     string               `json:"$schema"`
+	Required   []string             `json:"required,omitempty"`
+}
+
+// Program sumission request
+type ProgramSubmissionRequest struct {
+	Name        string      `json:"name"`
+	Data        []byte      `json:"data"`
+	Cost        int         `json:"cost" program:"cost"`
+	Description string      `json:"description,omitempty"`
+	Spec        ProgramSpec `json:"spec"`
+	IsPublic    bool        `json:"is_public,omitempty"`
+}
+
+// Program metadata definition
+type ProgramMetadataDefinition struct {
+	Name        string      `json:"name"`
+	Cost        int         `json:"cost" program:"cost"`
+	Description string      `json:"description,omitempty"`
+	Spec        ProgramSpec `json:"spec"`
+	IsPublic    bool        `json:"is_public,omitempty"`
+}
+
+// Parameters definition
+type ParameterDefinition struct {
+	Params map[string]interface{} `json:"params,omitempty" `
+}
+
+// ProgramSpec defines fields in a program that are not used for execution. The fields
+// here are meant to contain a JSON object for the various inputs and outputs that a running
+// program can handle. Parameters, ReturnValues, InterimResults should be JSON schemas.
+type ProgramSpec struct {
+	BackendRequirements map[string]string `json:"backend_requirements,omitempty"`
+	Parameters          ParameterList     `json:"parameters,omitempty"`
+	ReturnValues        ParameterList     `json:"return_values,omitempty"`
+	InterimResults      ParameterList     `json:"interim_results,omitempty"`
+}
+
+// List programs response
+type PaginatedProgramsResponse struct {
+	Programs []Program `json:"programs"`
+	Limit    int       `json:"limit"`
+	Offset   int       `json:"offset"`
+}
+
+// Job submission request
+type JobRunParams struct {
+	ProgramID string                 `json:"program_id"`
+	Backend   string                 `json:"backend"`
+	Params    map[string]interface{} `json:"params,omitempty" `
+}
+
+// Job submission result
+type JobSubmitResult struct {
+	ID string `json:"id"`
+}
+
+// Job state details
+type JobState struct {
+	Status     string `json:"status"`
+	Reason     string `json:"reason,omitempty"`
+	ReasonCode int    `json:"reason_code,omitempty"`
+}
+
+// Job status result
+type JobStatusResult struct {
+	ID        string                 `json:"id"`
+	Backend   string                 `json:"backend"`
+	Status    string                 `json:"status"`
+	State     *JobState              `json:"state,omitempty"`
+	SessionID string                 `json:"session_id,omitempty"`
+	Params    map[string]interface{} `json:"params"`
+	Program   JobSubmitResult        `json:"program"`
+	Created   string                 `json:"created"`
+	Runtime   string                 `json:"runtime"`
+}
+
+// Session creation request
+type SessionRequest struct {
+	Mode    string `json:"mode"`
+	Backend string `json:"backend,omitempty"`
+	MaxTTL  int    `json:"max_ttl,omitempty"`
+}
+
+// Session creation response
+type SessionResponse struct {
+	ID string `json:"id"`
+}
+
+// Primitive job parameters
+type PrimitiveParams struct {
+	Pubs    []json.RawMessage      `json:"pubs"`
+	Options map[string]interface{} `json:"options,omitempty"`
+	Version int                    `json:"version"`
+}
+
+// Primitive job submission request
+type PrimitiveJobRequest struct {
+	ProgramID string          `json:"program_id"`
+	Backend   string          `json:"backend,omitempty"`
+	SessionID string          `json:"session_id,omitempty"`
+	Params    PrimitiveParams `json:"params"`
+	Tags      []string        `json:"tags,omitempty"`
+}
+
+// List of backends
+type BackendsResponse struct {
+	Devices []string `json:"devices"`
+}
+
+// Backend configuration
+type BackendConfiguration struct {
+	Name      string `json:"backend_name"`
+	NumQubits int    `json:"n_qubits"`
+	Simulator bool   `json:"simulator"`
+}
+
+// Backend status
+type BackendStatus struct {
+	Name        string `json:"backend_name"`
+	State       bool   `json:"state"`
+	Status      string `json:"status"`
+	Message     string `json:"message"`
+	LengthQueue int    `json:"length_queue"`
+}
+
+// IAM token response
+type IAMTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	Expiration  int64  `json:"expiration"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
@@ -0,0 +1,384 @@
+//=============================================================================
+// bridge-quantum
+// Diagnostics CLI for the quantum service, built on the client used by the quantum pod.
+// Credentials are taken from flags, environment (QUANTUM_*) or a Kubernetes secret with
+// the same keys as the BridgeJob resource secret, in this order
+//=============================================================================
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	e "errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/ibm/bridge-operator/quantum-pod/client"
+)
+
+const usage = `Usage: bridge-quantum [global flags] <command> [flags] [args]
+
+Commands:
+  check                                   check credentials and access to the service
+  programs list [-name name]              list programs
+  programs upload -data file [-metadata file] [-name name]
+                                          upload program
+  programs delete id...                   delete programs
+  submit -program id|name [-params file] [-backend name] [-watch]
+                                          submit job of program
+  watch [-interval sec] job               watch job until it finishes
+  results [-interim] job                  get job results or interim results
+  logs job                                get job logs
+
+Global flags:
+`
+
+// Final job states of the service
+var finalStates = map[string]bool{
+	"COMPLETED":                true,
+	"DONE":                     true,
+	"CANCELLED":                true,
+	"CANCELLED - RAN TOO LONG": true,
+	"FAILED":                   true,
+	"ERROR":                    true,
+}
+
+// Global flags
+var (
+	serviceURL = flag.String("url", "", "service URL (QUANTUM_URL), e.g. https://us-east.quantum-computing.cloud.ibm.com/")
+	crn        = flag.String("crn", "", "service instance CRN (QUANTUM_CRN)")
+	instance   = flag.String("instance", "", "instance hub/group/project (QUANTUM_INSTANCE)")
+	apiKey     = flag.String("apikey", "", "API key (QUANTUM_APIKEY)")
+	profile    = flag.String("profile", "", "trusted profile ID or name, used with -crtoken (QUANTUM_PROFILE)")
+	crToken    = flag.String("crtoken", "", "file with compute resource token of the trusted profile")
+	iamURL     = flag.String("iamurl", "", "IAM token endpoint (QUANTUM_IAM_URL)")
+	secret     = flag.String("secret", "", "Kubernetes secret with credentials, [namespace/]name")
+	kubeconfig = flag.String("kubeconfig", "", "kubeconfig used to read the secret, default kubeconfig if not set")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	qc, err := newClient()
+	if err != nil {
+		fail(err)
+	}
+	args := flag.Args()
+	switch args[0] {
+	case "check":
+		err = check(qc)
+	case "programs":
+		err = programs(qc, args[1:])
+	case "submit":
+		err = submit(qc, args[1:])
+	case "watch":
+		err = watch(qc, args[1:])
+	case "results":
+		err = results(qc, args[1:])
+	case "logs":
+		err = logs(qc, args[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fail(err)
+	}
+}
+
+// Print error and exit
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "Error:", err)
+	os.Exit(1)
+}
+
+// Create client from flags, environment and secret
+func newClient() (*client.Client, error) {
+	values := map[string]string{}
+	if len(*secret) > 0 {
+		var err error
+		if values, err = secretData(*secret); err != nil {
+			return nil, err
+		}
+	}
+	creds := client.Credentials{
+		CRN:         value(*crn, "QUANTUM_CRN", values, "crn", "username"),
+		Instance:    value(*instance, "QUANTUM_INSTANCE", values, "instance"),
+		APIKey:      value(*apiKey, "QUANTUM_APIKEY", values, "apikey", "password"),
+		Profile:     value(*profile, "QUANTUM_PROFILE", values, "profile"),
+		IAMURL:      value(*iamURL, "QUANTUM_IAM_URL", values, "iamurl"),
+		CRTokenFile: *crToken,
+	}
+	if err := creds.Validate(); err != nil {
+		return nil, err
+	}
+	url := value(*serviceURL, "QUANTUM_URL", values)
+	if len(url) == 0 {
+		return nil, e.New("service URL missing, use -url or QUANTUM_URL")
+	}
+	return client.New(url, func() (client.Credentials, error) { return creds, nil }), nil
+}
+
+// Get value from flag, environment or secret keys, the first one set
+func value(flagValue, env string, values map[string]string, keys ...string) string {
+	if len(flagValue) > 0 {
+		return flagValue
+	}
+	if v := os.Getenv(env); len(v) > 0 {
+		return v
+	}
+	for _, key := range keys {
+		if v := strings.TrimSpace(values[key]); len(v) > 0 {
+			return v
+		}
+	}
+	return ""
+}
+
+// Read secret data, the namespace of the current context is used if not given
+func secretData(ref string) (map[string]string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = *kubeconfig
+	config := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{})
+	namespace, name := "", ref
+	if i := strings.Index(ref, "/"); i >= 0 {
+		namespace, name = ref[:i], ref[i+1:]
+	} else {
+		var err error
+		if namespace, _, err = config.Namespace(); err != nil {
+			return nil, err
+		}
+	}
+	restConfig, err := config.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	s, err := clientset.CoreV1().Secrets(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	for key, v := range s.Data {
+		values[key] = string(v)
+	}
+	return values, nil
+}
+
+// Check credentials and access to the service
+func check(qc *client.Client) error {
+	if _, err := qc.Token.Token(); err != nil {
+		return fmt.Errorf("failed to get IAM token; %s", err.Error())
+	}
+	fmt.Println("IAM token:  OK")
+	programs, err := qc.ListPrograms("")
+	if err != nil {
+		return err
+	}
+	fmt.Println("Programs:  ", len(programs))
+	backends, err := qc.ListBackends(*instance)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Backends:  ", strings.Join(backends, ", "))
+	return nil
+}
+
+// Program commands
+func programs(qc *client.Client, args []string) error {
+	if len(args) == 0 {
+		return e.New("programs command expects list, upload or delete")
+	}
+	switch args[0] {
+	case "list":
+		fs := flag.NewFlagSet("programs list", flag.ExitOnError)
+		name := fs.String("name", "", "program name")
+		fs.Parse(args[1:])
+		programs, err := qc.ListPrograms(*name)
+		if err != nil {
+			return err
+		}
+		for _, p := range programs {
+			fmt.Printf("%-40s %-40s %s\n", p.ID, p.Name, p.CreationDate.Format(time.RFC3339))
+		}
+	case "upload":
+		fs := flag.NewFlagSet("programs upload", flag.ExitOnError)
+		data := fs.String("data", "", "program file")
+		metadata := fs.String("metadata", "", "program metadata file (JSON)")
+		name := fs.String("name", "", "program name, overrides the metadata")
+		fs.Parse(args[1:])
+		if len(*data) == 0 {
+			return e.New("program file missing, use -data")
+		}
+		content, err := os.ReadFile(*data)
+		if err != nil {
+			return err
+		}
+		meta := client.ProgramMetadataDefinition{}
+		if len(*metadata) > 0 {
+			m, err := os.ReadFile(*metadata)
+			if err != nil {
+				return err
+			}
+			if err := json.Unmarshal(m, &meta); err != nil {
+				return fmt.Errorf("failed to parse program metadata; %s", err.Error())
+			}
+		}
+		if len(*name) > 0 {
+			meta.Name = *name
+		}
+		program, err := qc.AddProgram(client.ProgramSubmissionRequest{
+			Name:        meta.Name,
+			Data:        content,
+			Cost:        meta.Cost,
+			Description: meta.Description,
+			Spec:        meta.Spec,
+			IsPublic:    meta.IsPublic,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Println(program.ID)
+	case "delete":
+		for _, id := range args[1:] {
+			if err := qc.DeleteProgram(id); err != nil {
+				return err
+			}
+			fmt.Println("Deleted", id)
+		}
+	default:
+		return fmt.Errorf("unknown programs command %s", args[0])
+	}
+	return nil
+}
+
+// Submit job of program
+func submit(qc *client.Client, args []string) error {
+	fs := flag.NewFlagSet("submit", flag.ExitOnError)
+	program := fs.String("program", "", "program ID or name")
+	params := fs.String("params", "", "job parameters file (JSON with params)")
+	backend := fs.String("backend", "", "backend, chosen by the service if not set")
+	wait := fs.Bool("watch", false, "watch the job until it finishes")
+	fs.Parse(args)
+	if len(*program) == 0 {
+		return e.New("program missing, use -program")
+	}
+
+	// Program can be given by name
+	programID := *program
+	if programs, err := qc.ListPrograms(*program); err == nil && len(programs) == 1 {
+		programID = programs[0].ID
+	}
+	parameters := client.ParameterDefinition{}
+	if len(*params) > 0 {
+		p, err := os.ReadFile(*params)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(p, &parameters); err != nil {
+			return fmt.Errorf("failed to parse job parameters; %s", err.Error())
+		}
+	}
+	id, err := qc.SubmitJob(client.JobRunParams{ProgramID: programID, Backend: *backend, Params: parameters.Params})
+	if err != nil {
+		return err
+	}
+	fmt.Println(id)
+	if *wait {
+		return watch(qc, []string{id})
+	}
+	return nil
+}
+
+// Watch job until it finishes, printing state changes. Fails if the job does not complete successfully
+func watch(qc *client.Client, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	interval := fs.Int("interval", 10, "polling interval (sec)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return e.New("watch expects job ID")
+	}
+	id := fs.Arg(0)
+	last := ""
+	for {
+		job, err := qc.GetJob(id)
+		if err != nil {
+			return err
+		}
+		status := job.Status
+		if job.State != nil && len(job.State.Status) > 0 {
+			status = job.State.Status
+		}
+		if status != last {
+			line := fmt.Sprintf("%s %s %s", time.Now().Format(time.RFC3339), id, status)
+			if len(job.Backend) > 0 {
+				line += " on " + job.Backend
+			}
+			if job.State != nil && len(job.State.Reason) > 0 {
+				line += ": " + job.State.Reason
+			}
+			fmt.Println(line)
+			last = status
+		}
+		upper := strings.ToUpper(status)
+		if finalStates[upper] {
+			if upper != "COMPLETED" && upper != "DONE" {
+				return fmt.Errorf("job %s finished in state %s", id, status)
+			}
+			return nil
+		}
+		time.Sleep(time.Duration(*interval) * time.Second)
+	}
+}
+
+// Print job results
+func results(qc *client.Client, args []string) error {
+	fs := flag.NewFlagSet("results", flag.ExitOnError)
+	interim := fs.Bool("interim", false, "get interim results")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return e.New("results expects job ID")
+	}
+	get := qc.JobResults
+	if *interim {
+		get = qc.JobInterimResults
+	}
+	output, err := get(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(output))
+	return nil
+}
+
+// Print job logs
+func logs(qc *client.Client, args []string) error {
+	if len(args) != 1 {
+		return e.New("logs expects job ID")
+	}
+	output, err := qc.JobLogs(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(output))
+	return nil
+}
@@ -0,0 +1,118 @@
+//=============================================================================
+// Interim results
+// Programs publish interim results while they run (e.g. iteration and energy of VQE), returned by
+// the service as newline separated JSON. While jobs run, new interim results are uploaded as timestamped
+// objects under the job's S3 prefix and the latest one is summarized in status.interimResults
+//=============================================================================
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/ibm/bridge-operator/podutils"
+	"github.com/ibm/bridge-operator/quantum-pod/client"
+)
+
+// Number of interim results already published per job
+var interimCounts = map[string]int{}
+
+// Restore number of published interim results (status.interimCount, comma separated in the order of jobs)
+func restoreInterimCounts(ids []string, info map[string]string) {
+	counts := strings.Split(info["status.interimCount"], ",")
+	for i, id := range ids {
+		if i < len(counts) {
+			interimCounts[id], _ = strconv.Atoi(counts[i])
+		}
+	}
+}
+
+// Publish interim results of jobs not published yet
+func streamInterimResults(jobs []*client.JobStatusResult, data map[string]string, info map[string]string) {
+	objects := []podutils.UploadFile{}
+	summaries := []string{}
+	counts := []string{}
+	now := time.Now().UTC()
+	for _, job := range jobs {
+		prefix := ""
+		if len(jobs) > 1 {
+			prefix = job.ID + "/"
+		}
+		results := interimLines(jobOutput(job.ID, CLIENT.JobInterimResults))
+		published := interimCounts[job.ID]
+		if len(results) < published {
+			// Interim results were reset, e.g. the job was restarted
+			published = 0
+		}
+		for i := published; i < len(results); i++ {
+			objects = append(objects, podutils.UploadFile{
+				Name:    fmt.Sprintf("%sinterim/%05d-%s.json", prefix, i, now.Format("20060102T150405Z")),
+				Content: results[i],
+			})
+		}
+		if len(results) > published {
+			klog.Info("Job ", job.ID, " published ", len(results)-published, " new interim results")
+			summary := interimSummary(results[len(results)-1])
+			if len(jobs) > 1 {
+				summary = "job " + job.ID + ": " + summary
+			}
+			summaries = append(summaries, summary)
+		}
+		interimCounts[job.ID] = len(results)
+		counts = append(counts, strconv.Itoa(len(results)))
+	}
+	info["status.interimCount"] = strings.Join(counts, ",")
+	if len(summaries) > 0 {
+		summary := strings.Join(summaries, " | ")
+		if len(summary) > SUMMARY_LENGTH {
+			summary = summary[:SUMMARY_LENGTH-3] + "..."
+		}
+		info["status.interimResults"] = summary
+		info["status.interimTime"] = now.Format(TIME)
+	}
+	if len(objects) > 0 && len(S3) > 0 && len(data["s3upload.bucket"]) > 0 {
+		podutils.UploadS3Data(data, info, objects)
+	}
+}
+
+// Split interim results into single results
+func interimLines(results string) []string {
+	lines := []string{}
+	for _, line := range strings.Split(results, "\n") {
+		if line = strings.TrimSpace(line); len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// Summary of interim result. Scalar fields of JSON objects are listed, e.g. "energy -1.857, iteration 12",
+// other results are compacted
+func interimSummary(result string) string {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(result), &fields); err != nil {
+		return compact(json.RawMessage(result))
+	}
+	names := []string{}
+	for name, value := range fields {
+		if v := strings.TrimSpace(string(value)); len(v) > 0 && v[0] != '{' && v[0] != '[' {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return compact(json.RawMessage(result))
+	}
+	sort.Strings(names)
+	parts := []string{}
+	for _, name := range names {
+		parts = append(parts, name+" "+string(fields[name]))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ibm/bridge-operator/quantum-pod/client"
+)
+
+func TestInterimLines(t *testing.T) {
+	tests := []struct {
+		results string
+		lines   []string
+	}{
+		{"", []string{}},
+		{"\n  \n", []string{}},
+		{`{"iteration": 1}`, []string{`{"iteration": 1}`}},
+		{"{\"iteration\": 1}\n{\"iteration\": 2}\n", []string{`{"iteration": 1}`, `{"iteration": 2}`}},
+		{"{\"iteration\": 1}\r\n\n  {\"iteration\": 2}  ", []string{`{"iteration": 1}`, `{"iteration": 2}`}},
+	}
+	for _, test := range tests {
+		if lines := interimLines(test.results); !reflect.DeepEqual(lines, test.lines) {
+			t.Errorf("%q: got %q, expected %q", test.results, lines, test.lines)
+		}
+	}
+}
+
+// Scalar fields are listed by name, other results are compacted
+func TestInterimSummary(t *testing.T) {
+	tests := []struct {
+		result  string
+		summary string
+	}{
+		{`{"iteration": 12, "energy": -1.857}`, "energy -1.857, iteration 12"},
+		{`{"iteration": 3, "params": [0.1, 0.2], "state": "optimizing", "meta": {"a": 1}}`, `iteration 3, state "optimizing"`},
+		{`{"params": [0.1, 0.2],  "meta": {"a": 1}}`, `{"params":[0.1,0.2],"meta":{"a":1}}`},
+		{`[1, 2,  3]`, "[1,2,3]"},
+		{`"converged"`, `"converged"`},
+		{`not json`, "not json"},
+	}
+	for _, test := range tests {
+		if summary := interimSummary(test.result); summary != test.summary {
+			t.Errorf("%s: got %q, expected %q", test.result, summary, test.summary)
+		}
+	}
+}
+
+func TestRestoreInterimCounts(t *testing.T) {
+	tests := []struct {
+		ids    []string
+		count  string
+		counts map[string]int
+	}{
+		{[]string{"j1"}, "", map[string]int{"j1": 0}},
+		{[]string{"j1"}, "4", map[string]int{"j1": 4}},
+		{[]string{"j1", "j2", "j3"}, "4,0,7", map[string]int{"j1": 4, "j2": 0, "j3": 7}},
+		{[]string{"j1", "j2"}, "4", map[string]int{"j1": 4}},
+		{[]string{"j1", "j2"}, "x,2", map[string]int{"j1": 0, "j2": 2}},
+	}
+	saved := interimCounts
+	defer func() { interimCounts = saved }()
+	for _, test := range tests {
+		interimCounts = map[string]int{}
+		restoreInterimCounts(test.ids, map[string]string{"status.interimCount": test.count})
+		if !reflect.DeepEqual(interimCounts, test.counts) {
+			t.Errorf("%v %q: got %v, expected %v", test.ids, test.count, interimCounts, test.counts)
+		}
+	}
+}
+
+// Only new interim results are summarized, counts follow the results of the service across polls
+func TestStreamInterimResults(t *testing.T) {
+	results := map[string]string{}
+	fakeService(t, func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/interim_results")
+		w.Write([]byte(results[id]))
+	})
+	saved, savedS3 := interimCounts, S3
+	defer func() { interimCounts, S3 = saved, savedS3 }()
+	interimCounts, S3 = map[string]int{}, ""
+
+	jobs := []*client.JobStatusResult{{ID: "j1"}, {ID: "j2"}}
+	steps := []struct {
+		j1, j2  string
+		count   string
+		summary string
+	}{
+		{"", "", "0,0", ""},
+		{`{"iteration": 1}`, "", "1,0", "job j1: iteration 1"},
+		{"{\"iteration\": 1}\n{\"iteration\": 2}", `{"energy": -1.5}`, "2,1", "job j1: iteration 2 | job j2: energy -1.5"},
+		{"{\"iteration\": 1}\n{\"iteration\": 2}", `{"energy": -1.5}`, "2,1", ""},
+		{`{"iteration": 1}`, `{"energy": -1.5}`, "1,1", "job j1: iteration 1"},
+	}
+	for i, step := range steps {
+		results["j1"], results["j2"] = step.j1, step.j2
+		info := map[string]string{}
+		streamInterimResults(jobs, map[string]string{}, info)
+		if info["status.interimCount"] != step.count || info["status.interimResults"] != step.summary {
+			t.Errorf("step %d: got count %q summary %q, expected %q %q", i, info["status.interimCount"],
+				info["status.interimResults"], step.count, step.summary)
+		}
+		if (len(info["status.interimTime"]) > 0) != (len(step.summary) > 0) {
+			t.Errorf("step %d: unexpected time %q", i, info["status.interimTime"])
+		}
+	}
+}
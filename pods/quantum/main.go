@@ -1,9 +1,8 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
-	"net/http"
+	"fmt"
 	"os"
 	"strconv"
 	"strings"
@@ -12,369 +11,203 @@ import (
 	"k8s.io/klog"
 
 	"github.com/ibm/bridge-operator/podutils"
+	"github.com/ibm/bridge-operator/quantum-pod/client"
 )
 
 const (
 	CREDS_DIR  = "/credentials/"
 	SCRIPT_DIR = "/script/script"
 	TIME       = "2006-01-02T15:04:05Z"
-)
-
-var CLOUD_URL string   // Cloud URL
-var JOB_NAME string    // Job name
-var NAMESPACE string   // Namespace
-var POLL int           // Poll interval
-var S3 string          // S3 secret - used to check whether we need S3 upload
-var SERVICE_CRN string // Service CRN from secret
-var API_KEY string     // API key from secret
-
-// Structures for JSON conversion
-
-// Program definition
-type Program struct {
-	ID           string      `json:"id" program:"id" job:"id"`
-	Name         string      `json:"name" program:"name,omitempty" job:"-" binding:"required"`
-	Cost         int         `json:"cost" program:"cost,omitempty" job:"-" db:"cost"`
-	Description  string      `json:"description,omitempty" program:"description,omitempty" job:"-" db:"description"`
-	Spec         ProgramSpec `json:"spec,omitempty" program:"spec,omitempty" job:"-" db:"spec"`
-	Data         []byte      `json:"data,omitempty" program:"-" job:"-" db:"data"`
-	CreationDate time.Time   `json:"creation_date,omitempty" program:"creation_date,omitempty" job:"-" db:"created_time"`
-	UpdateDate   time.Time   `json:"update_date,omitempty" program:"update_date,omitempty" job:"-" db:"updated_time"`
-	IsPublic     bool        `json:"is_public,omitempty" program:"is_public,omitempty" job:"-" db:"is_public"`
-}
-
-// Parameter definition used in Program spec
-type Parameter struct {
-	Description string `json:"description,omitempty"`
-	Type        string `json:"type,omitempty"`
-	Minimum     string `json:"minimum,omitempty"`
-	Maximum     string `json:"maximum,omitempty"`
-	Default     string `json:"default,omitempty"`
-}
-
-// List of parameters used in program spec
-type ParameterList struct {
-	Properties map[string]Parameter `json:"properties"`
-	Schema     string               `json:"$schema"`
-	Required   []string             `json:"required,omitempty"`
-}
-
-// Program sumission request
-type ProgramSubmissionRequest struct {
-	Name        string      `json:"name"`
-	Data        []byte      `json:"data"`
-	Cost        int         `json:"cost" program:"cost"`
-	Description string      `json:"description,omitempty"`
-	Spec        ProgramSpec `json:"spec"`
-	IsPublic    bool        `json:"is_public,omitempty"`
-}
-
-// Program metadata definition
-type ProgramMetadataDefinition struct {
-	Name        string      `json:"name"`
-	Cost        int         `json:"cost" program:"cost"`
-	Description string      `json:"description,omitempty"`
-	Spec        ProgramSpec `json:"spec"`
-	IsPublic    bool        `json:"is_public,omitempty"`
-}
-
-// Parameters definition
-type ParameterDefinition struct {
-	Params map[string]interface{} `json:"params,omitempty" `
-}
-
-// ProgramSpec defines fields in a program that are not used for execution. The fields
-// here are meant to contain a JSON object for the various inputs and outputs that a running
-// program can handle. Parameters, ReturnValues, InterimResults should be JSON schemas.
-type ProgramSpec struct {
-	BackendRequirements map[string]string `json:"backend_requirements,omitempty"`
-	Parameters          ParameterList     `json:"parameters,omitempty"`
-	ReturnValues        ParameterList     `json:"return_values,omitempty"`
-	InterimResults      ParameterList     `json:"interim_results,omitempty"`
-}
-
-// List programs response
-type PaginatedProgramsResponse struct {
-	Programs []Program `json:"programs"`
-	Limit    int       `json:"limit"`
-	Offset   int       `json:"offset"`
-}
-
-// Job submission request
-type JobRunParams struct {
-	ProgramID string                 `json:"program_id"`
-	Backend   string                 `json:"backend"`
-	Params    map[string]interface{} `json:"params,omitempty" `
-}
-
-// Job submission result
-type JobSubmitResult struct {
-	ID string `json:"id"`
-}
 
-// Job status result
-type JobStatusResult struct {
-	ID      string                 `json:"id"`
-	Backend string                 `json:"backend"`
-	Status  string                 `json:"status"`
-	Params  map[string]interface{} `json:"params"`
-	Program JobSubmitResult        `json:"program"`
-	Created string                 `json:"created"`
-	Runtime string                 `json:"runtime"`
-}
+	// Job states reported to the operator
+	SUBMITTED = "SUBMITTED"
+	PENDING   = "PENDING"
+	RUNNING   = "RUNNING"
+	SUCCEEDED = "SUCCEEDED"
+	KILL      = "KILL"
+	FAILED    = "FAILED"
+	UNKNOWN   = "UNKNOWN"
+)
 
-// Set request headers
-func setHeaders(req *http.Request) *http.Request {
-	// Set headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Service-CRN", SERVICE_CRN)
-	req.Header.Set("Authorization", "apikey "+API_KEY)
-	return req
+var CLIENT *client.Client   // Quantum service client
+var JOB_NAME string         // Job name
+var NAMESPACE string        // Namespace
+var POLL int                // Poll interval
+var S3 string               // S3 secret - used to check whether we need S3 upload
+var PROPS QuantumProperties // Job properties
+
+// Mapping of quantum job states (legacy and primitive jobs) to operator states
+var STATES = map[string]string{
+	"QUEUED":                   PENDING,
+	"INITIALIZING":             PENDING,
+	"VALIDATING":               PENDING,
+	"RUNNING":                  RUNNING,
+	"COMPLETED":                SUCCEEDED,
+	"DONE":                     SUCCEEDED,
+	"CANCELLED":                KILL,
+	"CANCELLED - RAN TOO LONG": FAILED,
+	"FAILED":                   FAILED,
+	"ERROR":                    FAILED,
 }
 
-// Get program(s) info
-func getProgram(name string) *PaginatedProgramsResponse {
-	// Build URL
-	url := CLOUD_URL + "programs"
-	if len(name) > 0 {
-		url = url + "?name=" + name
-	}
-	// Create request
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		klog.Error("Error creating Get program request; err ", err)
-		return nil
+// Add additional information from quantum jobs
+func getAdditionalInfo(jobs []*client.JobStatusResult, info map[string]string) {
+	info["status.submitTime"] = jobs[0].Created
+	info["status.endTime"] = time.Now().Format(TIME)
+	reasons := []string{}
+	for _, job := range jobs {
+		if job.State != nil && len(job.State.Reason) > 0 {
+			reasons = append(reasons, fmt.Sprintf("job %s %s: %s", job.ID, job.Status, job.State.Reason))
+		} else if strings.EqualFold(job.Status, "Cancelled - Ran too long") {
+			reasons = append(reasons, fmt.Sprintf("job %s execution takes too long, aborted by runtime", job.ID))
+		}
 	}
-	// Execute
-	respBody, statusCode := podutils.SendReq(setHeaders(req))
-	if statusCode != 200 {
-		klog.Error("Retrieving program not successful, status code ", statusCode)
-		return nil
+	if len(reasons) > 0 {
+		info["status.message"] = strings.Join(reasons, "; ")
 	}
-	// Unmarshal result
-	pi := PaginatedProgramsResponse{}
-	json.Unmarshal(respBody, &pi)
-	return &pi
 }
 
-// Submit job
-func submitJob(request JobRunParams) *JobSubmitResult {
-	// Build URL
-	url := CLOUD_URL + "jobs"
-	// Marshall input data
-	data, err := json.Marshal(request)
-	if err != nil {
-		klog.Error("Error marshalling job request; err ", err)
-		return nil
-	}
-	// Build request
-	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
-	if err != nil {
-		klog.Error("Error creating submit job request; err ", err)
-		return nil
+// Kill the jobs, and the session opened by the pod
+func killJob(jobs []*client.JobStatusResult, info map[string]string) {
+	killed := true
+	for _, job := range jobs {
+		state := jobState(job)
+		// Only kill jobs that are queued or running
+		if state != PENDING && state != RUNNING {
+			klog.Info("Job ", job.ID, " is already in finished state ", job.Status)
+			continue
+		}
+		if err := CLIENT.CancelJob(job.ID); err == nil {
+			klog.Info("Job ", job.ID, " killed successfully.")
+		} else {
+			killed = false
+			klog.Info("Job ", job.ID, " is not killed; err ", err, ". Continue in monitoring, will try to kill again.")
+		}
 	}
-	// execute
-	respBody, statusCode := podutils.SendReq(setHeaders(req))
-	if statusCode != 200 {
-		klog.Error("Submitting not successful, status code ", statusCode)
-		return nil
+	if killed && len(info["status.sessionId"]) > 0 && len(PROPS.SessionID) == 0 {
+		if err := CLIENT.CancelSession(info["status.sessionId"]); err != nil {
+			klog.Error("Session ", info["status.sessionId"], ": ", err)
+		}
 	}
-	// Unmarshal result
-	res := JobSubmitResult{}
-	json.Unmarshal(respBody, &res)
-	return &res
 }
 
-// Get job status
-func getJobState(jobID string) *JobStatusResult {
-	// Build URL
-	url := CLOUD_URL + "jobs/" + jobID
-	// Build request
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		klog.Error("Error creating Get job request; err ", err)
-		return nil
+// Get job state reported to the operator
+func jobState(job *client.JobStatusResult) string {
+	status := job.Status
+	if job.State != nil && len(job.State.Status) > 0 {
+		status = job.State.Status
 	}
-	// Execute
-	respBody, statusCode := podutils.SendReq(setHeaders(req))
-	if statusCode != 200 {
-		klog.Error("Retrieving job not successful, status code ", statusCode)
-		return nil
+	if state, ok := STATES[strings.ToUpper(status)]; ok {
+		return state
 	}
-	// Unmarshal result
-	result := JobStatusResult{}
-	json.Unmarshal(respBody, &result)
-	return &result
+	return UNKNOWN
 }
 
-// Get job results
-func getJobResults(jobID string) string {
-	// Build URL
-	url := CLOUD_URL + "jobs/" + jobID + "/results"
-	// Create request
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		klog.Error("Error creating Get job result request; err ", err)
-		return ""
+// Get state of all jobs. They are finished once all jobs are finished,
+// failed or killed if any of them failed or was killed
+func aggregateState(jobs []*client.JobStatusResult) string {
+	states := map[string]bool{}
+	for _, job := range jobs {
+		states[jobState(job)] = true
 	}
-	// Execute
-	respBody, statusCode := podutils.SendReq(setHeaders(req))
-	if statusCode != 200 {
-		klog.Error("Retrieving job results is not successful, status code ", statusCode)
-		return ""
+	switch {
+	case states[RUNNING]:
+		return RUNNING
+	case states[PENDING]:
+		return PENDING
+	case states[UNKNOWN]:
+		return UNKNOWN
+	case states[FAILED]:
+		return FAILED
+	case states[KILL]:
+		return KILL
 	}
-	// Return results
-	return string(respBody)
+	return SUCCEEDED
 }
 
-// Get job results
-func getJobInterimResults(jobID string) string {
-	// Build URL
-	url := CLOUD_URL + "jobs/" + jobID + "/interim_results"
-	// Create request
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		klog.Error("Error creating Get job interim result request; err ", err)
-		return ""
-	}
-	// Execute
-	respBody, statusCode := podutils.SendReq(setHeaders(req))
-	if statusCode != 200 {
-		klog.Error("Retrieving job interim results is not successful, status code ", statusCode)
-		return ""
-	}
-	// Return result
-	return string(respBody)
+// Check if the state is final
+func finished(state string) bool {
+	return state == SUCCEEDED || state == FAILED || state == KILL
 }
 
-// Get job results
-func getJobLogs(jobID string) string {
-	// Build URL
-	url := CLOUD_URL + "jobs/" + jobID + "/logs"
-	// Create request
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		klog.Error("Error creating Get job logs request; err ", err)
-		return ""
-	}
-	// Execute
-	respBody, statusCode := podutils.SendReq(setHeaders(req))
-	if statusCode != 200 {
-		klog.Error("Retrieving job logs is not successful, status code ", statusCode)
-		return ""
+// Upload results, interim results and logs of all jobs to S3, results of primitives also per PUB.
+// Results summary of primitives is reported in status
+func uploadResults(jobs []*client.JobStatusResult, data map[string]string, info map[string]string) {
+	objects := []podutils.UploadFile{}
+	summaries := []string{}
+	for _, job := range jobs {
+		prefix := ""
+		if len(jobs) > 1 {
+			prefix = job.ID + "/"
+		}
+		results := jobOutput(job.ID, CLIENT.JobResults)
+		objects = append(objects,
+			podutils.UploadFile{Name: prefix + "results", Content: results},
+			podutils.UploadFile{Name: prefix + "intermediateresults", Content: jobOutput(job.ID, CLIENT.JobInterimResults)},
+			podutils.UploadFile{Name: prefix + "logs", Content: jobOutput(job.ID, CLIENT.JobLogs)},
+		)
+		if len(PROPS.Primitive) == 0 {
+			continue
+		}
+		for i, pub := range pubObjects(results) {
+			objects = append(objects, podutils.UploadFile{Name: fmt.Sprintf("%spubs/%d.json", prefix, i), Content: pub})
+		}
+		if summary := resultSummary(job.ID, results); len(summary) > 0 {
+			summaries = append(summaries, summary)
+		}
 	}
-	// Return result
-	return string(respBody)
-}
-
-// Delete job
-func deleteJob(jobID string) {
-	// Build URL
-	url := CLOUD_URL + "jobs/" + jobID
-	// Create request
-	req, err := http.NewRequest("DELETE", url, nil)
-	if err != nil {
-		klog.Error("Error creating delete job request; err ", err)
-		return
+	if len(summaries) > 0 {
+		summary := strings.Join(summaries, " | ")
+		if len(summary) > SUMMARY_LENGTH {
+			summary = summary[:SUMMARY_LENGTH-3] + "..."
+		}
+		info["status.results"] = summary
 	}
-	// Execute
-	_, statusCode := podutils.SendReq(setHeaders(req))
-	if statusCode != 204 {
-		klog.Error("Deleting job not successful, status code ", statusCode)
-		return
+	if len(S3) > 0 && len(data["s3upload.bucket"]) > 0 {
+		podutils.UploadS3Data(data, info, objects)
 	}
 }
 
-// Delete program
-func deleteProgram(programID string) {
-	// Build URL
-	url := CLOUD_URL + "programs/" + programID
-	// Create request
-	req, err := http.NewRequest("DELETE", url, nil)
+// Get job output (results, interim results, logs), empty if it can not be retrieved
+func jobOutput(jobID string, get func(string) ([]byte, error)) string {
+	output, err := get(jobID)
 	if err != nil {
-		klog.Error("Error creating delete program request; err ", err)
-		return
-	}
-	// Execute
-	_, statusCode := podutils.SendReq(setHeaders(req))
-	if statusCode != 204 {
-		klog.Error("Deleting program not successful, status code ", statusCode)
-		return
+		klog.Error("Job ", jobID, ": ", err)
+		return ""
 	}
+	return string(output)
 }
 
-// Add program
-func addProgram(request ProgramSubmissionRequest) *Program {
-	// Build URL
-	url := CLOUD_URL + "programs"
-	// Marshall data
-	data, err := json.Marshal(request)
-	if err != nil {
-		klog.Error("Error marshalling program request; err ", err)
-		return nil
-	}
-	// Create request
-	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
-	if err != nil {
-		klog.Error("Error creating create program request; err ", err)
-		return nil
-	}
-	// Execute
-	respBody, statusCode := podutils.SendReq(setHeaders(req))
-	if statusCode != 201 {
-		klog.Error("Creating program was not successful, status code ", statusCode)
-		return nil
+// Submit job for execution. Returns job IDs and session ID
+func submit(data map[string]string, info map[string]string) ([]string, string) {
+	// Get parameters
+	var params_string string
+	if data["jobdata.scriptExtraLocation"] == "inline" {
+		params_string = data["jobdata.jobParameters"]
+	} else {
+		bucketobj := strings.Split(data["jobdata.jobParameters"], ":")
+		params_string = podutils.DownloadS3Data(bucketobj[0], bucketobj[1], data)
 	}
-	// Unmarshal result
-	res := Program{}
-	json.Unmarshal(respBody, &res)
-	return &res
-}
 
-// Kill job
-func CancelJob(jobID string) bool {
-	// Create URL
-	url := CLOUD_URL + "jobs/" + jobID + "/cancel"
-	// Build request
-	req, err := http.NewRequest("POST", url, nil)
-	if err != nil {
-		klog.Error("Error creating kill job request; err ", err)
-		return false
-	}
-	// Execute
-	_, statusCode := podutils.SendReq(setHeaders(req))
-	if statusCode != 204 {
-		klog.Error("Killing job not successful, status code ", statusCode)
-		return false
+	// Primitives
+	if len(PROPS.Primitive) > 0 {
+		ids, session, err := submitPrimitives(params_string)
+		if err != nil {
+			klog.Info("Failed to submit primitive jobs; err ", err)
+			return nil, ""
+		}
+		return ids, session
 	}
-	return true
-}
 
-// Add additional information from quqntum job
-func getAdditionalInfo(job *JobStatusResult, info map[string]string) {
-
-	info["status.submitTime"] = job.Created
-	info["status.endTime"] = time.Now().Format(TIME)
-}
-
-// Kill the job
-func killJob(state string, info map[string]string) {
-	// Check if the job is queued or running
-	if state == "Queued" || state == "Running" {
-		// Only kill jobs that are queued or running
-		res := CancelJob(info["id"])
-		if res {
-			klog.Info("Job ", info["id"], " killed successfully.")
-		} else {
-			klog.Info("Job ", info["id"], " is not killed; msg: ", res, ". Continue in monitoring, will try to kill again.")
-		}
-	} else {
-		klog.Info("Job ", info["id"], " is already in finished state ", state)
+	id := submitProgram(data, params_string, info)
+	if len(id) == 0 {
+		return nil, ""
 	}
+	return []string{id}, ""
 }
 
-// Submit job for execution
-func submit(data map[string]string) string {
+// Submit job of uploaded or existing program (legacy programs API)
+func submitProgram(data map[string]string, params_string string, info map[string]string) string {
 
 	var programID string
 	script_location := data["jobdata.scriptLocation"]
@@ -382,12 +215,12 @@ func submit(data map[string]string) string {
 
 	if script_location == "remote" {
 		// We have an uploaded program
-		program := getProgram(data["jobdata.jobScript"])
-		if program == nil || len(program.Programs) != 1 {
-			klog.Info("Failed to find program ", data["jobdata.jobScript"])
+		programs, err := CLIENT.ListPrograms(data["jobdata.jobScript"])
+		if err != nil || len(programs) != 1 {
+			klog.Info("Failed to find program ", data["jobdata.jobScript"], "; err ", err)
 			return ""
 		}
-		programID = program.Programs[0].ID
+		programID = programs[0].ID
 	} else {
 		// Upload our program itself
 		var program_data string
@@ -409,56 +242,54 @@ func submit(data map[string]string) string {
 			program_metadata = podutils.DownloadS3Data(bucketobj[0], bucketobj[1], data)
 		}
 
-		programMetadata := ProgramMetadataDefinition{}
+		programMetadata := client.ProgramMetadataDefinition{}
 		_ = json.Unmarshal([]byte(program_metadata), &programMetadata)
 
-		submissionRequest := ProgramSubmissionRequest{
-			Name:        programMetadata.Name,
-			Data:        []byte(program_data),
-			Cost:        programMetadata.Cost,
-			Description: programMetadata.Description,
-			Spec:        programMetadata.Spec,
-			IsPublic:    programMetadata.IsPublic,
-		}
-		program := addProgram(submissionRequest)
-		if program == nil {
+		var uploaded bool
+		programID, uploaded = findOrAddProgram(program_data, programMetadata, data["jobdata.scriptCleanup"] == CLEANUP_DELETE)
+		if len(programID) == 0 {
 			klog.Info("Failed to upload program ")
 			return ""
 		}
-		programID = program.ID
-	}
-
-	// Get parameters
-	var params_string string
-	if script_extlocation == "inline" {
-		params_string = data["jobdata.jobParameters"]
-	} else {
-		bucketobj := strings.Split(data["jobdata.jobParameters"], ":")
-		params_string = podutils.DownloadS3Data(bucketobj[0], bucketobj[1], data)
+		info["status.programUploaded"] = strconv.FormatBool(uploaded)
 	}
+	info["status.programId"] = programID
 
-	parameters := ParameterDefinition{}
+	parameters := client.ParameterDefinition{}
 	_ = json.Unmarshal([]byte(params_string), &parameters)
 
 	// Submit job
-	jobRequest := JobRunParams{
+	jobRequest := client.JobRunParams{
 		ProgramID: programID,
-		Backend:   "",
+		Backend:   PROPS.Backend,
 		Params:    parameters.Params,
 	}
-	submissionResult := submitJob(jobRequest)
-	if submissionResult == nil {
-		klog.Info("Failed to submit program ")
+	id, err := CLIENT.SubmitJob(jobRequest)
+	if err != nil {
+		klog.Info("Failed to submit program; err ", err)
 		return ""
 	}
 
-	return submissionResult.ID
+	return id
 }
 
 // Monitoring job execution
-// Method that runs constantly monitoring quantum job
+// Method that runs constantly monitoring quantum jobs
 func monitor(info map[string]string) {
-	id := info["id"]
+	ids := strings.Split(info["id"], ",")
+	streams := []podutils.LogStream{}
+	for _, id := range ids {
+		jobID := id
+		name := "logs"
+		if len(ids) > 1 {
+			name = jobID + " logs"
+		}
+		streams = append(streams, podutils.LogStream{Name: name, Fetch: func() ([]byte, error) {
+			return CLIENT.JobLogs(jobID)
+		}})
+	}
+	podutils.TailLogs(podutils.GetConfigMap().Data, streams...)
+	restoreInterimCounts(ids, info)
 	// Run forever
 	for {
 		// Sleep before next run
@@ -469,33 +300,48 @@ func monitor(info map[string]string) {
 
 		// Get current execution status and update config map
 		var state = ""
-		job := getJobState(id)
-		if job != nil {
-			state = job.Status
-			info["status.jobStatus"] = strings.ToUpper(state)
-			if state == "Completed" || state == "Cancelled" || state == "Cancelled - Ran too long" || state == "Failed" {
-				// Upload outputs to S3
-
-				podutils.UploadS3Data(cm.Data, info, []podutils.UploadFile{
-					podutils.UploadFile{Name: "results", Content: getJobResults(id)},
-					podutils.UploadFile{Name: "intermediateresults", Content: getJobInterimResults(id)},
-					podutils.UploadFile{Name: "logs", Content: getJobLogs(id)},
-				})
-				// Get additional info from Quantum and upload it
-				getAdditionalInfo(job, info)
-				// Adjust status
-				if state == "Cancelled - Ran too long" {
-					info["status.jobStatus"] = "FAILED"
-					info["status.message"] = "Job execution takes too long, aborted by runtime"
-				} else if state == "Completed" {
-					info["status.jobStatus"] = "SUCCEEDED"
-				} else if state == "Cancelled" {
-					info["status.jobStatus"] = "KILL"
+		jobs := []*client.JobStatusResult{}
+		for _, id := range ids {
+			job, err := CLIENT.GetJob(id)
+			if err != nil {
+				klog.Error("Job ", id, ": ", err)
+				jobs = nil
+				break
+			}
+			jobs = append(jobs, job)
+		}
+		if jobs != nil {
+			state = aggregateState(jobs)
+			info["status.jobStatus"] = state
+			if len(info["status.backend"]) == 0 {
+				// Backend chosen by the service
+				info["status.backend"] = jobs[0].Backend
+			}
+			if len(jobs) == 1 {
+				info["status.quantumState"] = jobs[0].Status
+			} else {
+				statuses := []string{}
+				for _, job := range jobs {
+					statuses = append(statuses, job.ID+":"+job.Status)
+				}
+				info["status.quantumState"] = strings.Join(statuses, ",")
+			}
+			if state == RUNNING || finished(state) {
+				// Publish interim results while running, and the last ones when finished
+				streamInterimResults(jobs, cm.Data, info)
+			}
+			if finished(state) {
+				// Get additional info from Quantum and upload outputs to S3
+				getAdditionalInfo(jobs, info)
+				uploadResults(jobs, cm.Data, info)
+				cleanupProgram(cm.Data, info)
+				if state == FAILED && len(info["status.message"]) == 0 {
+					info["status.message"] = "Job execution failed or took too long, aborted by runtime"
 				}
 			} else {
 				// Check for kill flag
 				if cm.Data["kill"] == "true" {
-					killJob(state, info)
+					killJob(jobs, info)
 				}
 			}
 
@@ -503,10 +349,13 @@ func monitor(info map[string]string) {
 		}
 
 		// Terminate if we are done
-		if state == "Completed" {
+		if finished(state) {
+			podutils.FlushLogs()
+		}
+		if state == SUCCEEDED {
 			os.Exit(0)
 		}
-		if state == "Cancelled" || state == "Cancelled - Ran too long" || state == "Failed" {
+		if state == KILL || state == FAILED {
 			os.Exit(1)
 		}
 	}
@@ -524,11 +373,23 @@ func main() {
 
 	// Get config map and its parameters
 	cm := podutils.GetConfigMap()
+	podutils.SetHTTPSettings(cm.Data)
 	S3 = cm.Data["s3.secret"]
 	POLL, _ = strconv.Atoi(cm.Data["updateInterval"])
-	CLOUD_URL = cm.Data["resourceURL"]
-	SERVICE_CRN = podutils.ReadMountedFileContent(CREDS_DIR + "username")
-	API_KEY = podutils.ReadMountedFileContent(CREDS_DIR + "password")
+	if len(cm.Data["jobproperties"]) > 0 {
+		if err := json.Unmarshal([]byte(cm.Data["jobproperties"]), &PROPS); err != nil {
+			klog.Info("Error in JobProperties provided ", err)
+		}
+	}
+	CLIENT = client.New(cm.Data["resourceURL"], readCredentials)
+	if _, err := CLIENT.Token.Token(); err != nil {
+		klog.Exit("Failed to get quantum service credentials; err ", err)
+	}
+	// Default instance of backend selection, the credentials were read successfully by the login above
+	if PROPS.BackendSelector != nil && len(PROPS.BackendSelector.Instance) == 0 {
+		PROPS.BackendSelector.Instance, _ = readCred("instance")
+	}
+	podutils.WatchCredentials(time.Duration(POLL)*time.Second, CLIENT.Token)
 
 	// Get ID from config map
 	id := cm.Data["id"]
@@ -544,21 +405,35 @@ func main() {
 	if len(id) == 0 {
 		klog.Info("Quantum Job with name ", JOB_NAME, " does not exist. Submitting new job.")
 		// Trying to submit a job. Here we are trying several times to successfully submit a job
-		id := submit(cm.Data)
+		var ids []string
+		var session string
+		backend, err := selectBackend()
+		if err != nil {
+			klog.Error("Failed to select backend; err ", err)
+			info["status.message"] = "Failed to select backend: " + err.Error()
+		} else {
+			PROPS.Backend = backend
+			info["status.backend"] = backend
+			ids, session = submit(cm.Data, info)
+		}
 
 		// Update execution state in config map
-		if len(id) == 0 {
+		if len(ids) == 0 {
 			// Failed to submit a job
-			info["status.jobStatus"] = "FAILED"
-			info["message"] = "Failed to submit a job to Quantum"
+			info["status.jobStatus"] = FAILED
+			if len(info["status.message"]) == 0 {
+				info["status.message"] = "Failed to submit a job to Quantum"
+			}
+			cleanupProgram(cm.Data, info)
 		} else {
-			info["id"] = id
-			info["status.jobStatus"] = "SUBMITTED"
+			info["id"] = strings.Join(ids, ",")
+			info["status.sessionId"] = session
+			info["status.jobStatus"] = SUBMITTED
 			info["status.startTime"] = time.Now().Format(TIME)
 		}
 		podutils.UpdateConfigMap(cm, info)
 		// Start monitoring or exit
-		if len(id) != 0 {
+		if len(ids) != 0 {
 			monitor(info)
 		} else {
 			klog.Exit("Failed to start quantum job")
@@ -567,6 +442,11 @@ func main() {
 		// Job is already running
 		klog.Info("Quantom Job with name ", JOB_NAME, " has associated ID in ConfigMap. Handling state.")
 		info["id"] = id
+		info["status.sessionId"] = cm.Data["status.sessionId"]
+		info["status.backend"] = cm.Data["status.backend"]
+		info["status.programId"] = cm.Data["status.programId"]
+		info["status.programUploaded"] = cm.Data["status.programUploaded"]
+		info["status.interimCount"] = cm.Data["status.interimCount"]
 		monitor(info)
 	}
 }
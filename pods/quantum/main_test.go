@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ibm/bridge-operator/podutils"
+	"github.com/ibm/bridge-operator/quantum-pod/client"
+)
+
+// Set CLIENT to a client of a fake quantum service
+func fakeService(t *testing.T, handler http.HandlerFunc) {
+	server := httptest.NewServer(handler)
+	saved := CLIENT
+	CLIENT = client.New(server.URL, func() (client.Credentials, error) { return client.Credentials{}, nil })
+	CLIENT.Token = podutils.NewTokenProvider(func() (string, time.Time, error) { return "token", time.Time{}, nil })
+	t.Cleanup(func() {
+		server.Close()
+		CLIENT = saved
+	})
+}
+
+// Detailed state of primitive jobs takes precedence over the legacy status
+func TestJobState(t *testing.T) {
+	tests := []struct {
+		job   client.JobStatusResult
+		state string
+	}{
+		{client.JobStatusResult{Status: "Queued"}, PENDING},
+		{client.JobStatusResult{Status: "RUNNING"}, RUNNING},
+		{client.JobStatusResult{Status: "Completed"}, SUCCEEDED},
+		{client.JobStatusResult{Status: "Cancelled - Ran too long"}, FAILED},
+		{client.JobStatusResult{Status: "Cancelled"}, KILL},
+		{client.JobStatusResult{Status: "Queued", State: &client.JobState{Status: "Running"}}, RUNNING},
+		{client.JobStatusResult{Status: "Completed", State: &client.JobState{Status: "ERROR", Reason: "Bad PUB"}}, FAILED},
+		{client.JobStatusResult{Status: "Queued", State: &client.JobState{}}, PENDING},
+		{client.JobStatusResult{Status: "Paused"}, UNKNOWN},
+	}
+	for _, test := range tests {
+		if state := jobState(&test.job); state != test.state {
+			t.Errorf("%+v: got %s, expected %s", test.job, state, test.state)
+		}
+	}
+}
+
+// Jobs run while any runs, failed or killed jobs fail the whole BridgeJob
+func TestAggregateState(t *testing.T) {
+	job := func(status string) *client.JobStatusResult {
+		return &client.JobStatusResult{Status: status}
+	}
+	tests := []struct {
+		jobs  []*client.JobStatusResult
+		state string
+	}{
+		{[]*client.JobStatusResult{job("Completed")}, SUCCEEDED},
+		{[]*client.JobStatusResult{job("Completed"), job("Completed")}, SUCCEEDED},
+		{[]*client.JobStatusResult{job("Completed"), job("Running"), job("Queued")}, RUNNING},
+		{[]*client.JobStatusResult{job("Completed"), job("Queued")}, PENDING},
+		{[]*client.JobStatusResult{job("Failed"), job("Queued")}, PENDING},
+		{[]*client.JobStatusResult{job("Completed"), job("Paused")}, UNKNOWN},
+		{[]*client.JobStatusResult{job("Cancelled"), job("Failed")}, FAILED},
+		{[]*client.JobStatusResult{job("Completed"), job("Cancelled")}, KILL},
+	}
+	for _, test := range tests {
+		state := aggregateState(test.jobs)
+		if state != test.state {
+			t.Errorf("%d jobs: got %s, expected %s", len(test.jobs), state, test.state)
+		}
+		if finished(state) != (state == SUCCEEDED || state == FAILED || state == KILL) {
+			t.Errorf("%s: unexpected finished %v", state, finished(state))
+		}
+	}
+}
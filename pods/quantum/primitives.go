@@ -0,0 +1,230 @@
+//=============================================================================
+// Qiskit Runtime primitives
+// Sampler and Estimator jobs are submitted with PUBs (primitive unified blocs) from job parameters.
+// Jobs run alone, or in a session or batch opened by the pod (or an existing session) which
+// spans all jobs of the BridgeJob. Sessions opened by the pod are closed once all jobs are submitted
+//=============================================================================
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	e "errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/klog"
+
+	"github.com/ibm/bridge-operator/quantum-pod/client"
+)
+
+const (
+	PRIMITIVE_SAMPLER   = "sampler"
+	PRIMITIVE_ESTIMATOR = "estimator"
+
+	MODE_JOB     = "job"
+	MODE_SESSION = "session"
+	MODE_BATCH   = "batch"
+
+	PRIMITIVE_VERSION = 2    // Version of primitive inputs and results
+	SUMMARY_LENGTH    = 1024 // Maximum length of the results summary in status
+)
+
+// Quantum job properties (jobproperties)
+type QuantumProperties struct {
+	Primitive string `json:"primitive"` // sampler or estimator, legacy programs API is used if not set
+	Backend   string `json:"backend"`   // Backend to run on, or candidate backends (comma separated)
+	Mode      string `json:"mode"`      // Execution mode: job (default), session or batch
+	MaxTime   int    `json:"maxTime"`   // Maximum time of the session/batch, or of the job execution (sec)
+	SessionID string `json:"sessionId"` // Existing session or batch to run in, it is not closed by the pod
+
+	BackendSelector *BackendSelector `json:"backendSelector"` // Select backend by its properties
+	BackendPolicy   string           `json:"backendPolicy"`   // Backend selection policy: least-busy
+}
+
+// Primitive job input (jobparameters). Either a single job (pubs and options),
+// or a list of jobs submitted in the session or batch
+type PrimitiveInput struct {
+	Pubs    []json.RawMessage      `json:"pubs,omitempty"`
+	Options map[string]interface{} `json:"options,omitempty"`
+	Jobs    []PrimitiveInput       `json:"jobs,omitempty"`
+}
+
+// Primitive job result
+type PrimitiveResult struct {
+	Results  []PubResult            `json:"results"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// Result of a single PUB
+type PubResult struct {
+	Data     map[string]json.RawMessage `json:"data"`
+	Metadata map[string]interface{}     `json:"metadata,omitempty"`
+}
+
+// Get the list of primitive jobs from job parameters
+func (p *PrimitiveInput) jobs() []PrimitiveInput {
+	if len(p.Jobs) > 0 {
+		return p.Jobs
+	}
+	return []PrimitiveInput{*p}
+}
+
+// Session mode of the API
+func sessionMode(mode string) string {
+	if mode == MODE_SESSION {
+		return "dedicated"
+	}
+	return mode
+}
+
+// Submit primitive jobs, in a session or batch if requested. Returns job IDs and session ID
+func submitPrimitives(params string) ([]string, string, error) {
+	primitive := strings.ToLower(PROPS.Primitive)
+	if primitive != PRIMITIVE_SAMPLER && primitive != PRIMITIVE_ESTIMATOR {
+		return nil, "", fmt.Errorf("unknown primitive %s, expected sampler or estimator", PROPS.Primitive)
+	}
+	if len(PROPS.Backend) == 0 {
+		return nil, "", e.New("backend or backend selector is required for primitive jobs")
+	}
+	input := PrimitiveInput{}
+	if err := json.Unmarshal([]byte(params), &input); err != nil {
+		return nil, "", fmt.Errorf("failed to parse primitive job parameters; err %s", err.Error())
+	}
+	jobs := input.jobs()
+	for i, job := range jobs {
+		if len(job.Pubs) == 0 {
+			return nil, "", fmt.Errorf("no PUBs in primitive job %d", i)
+		}
+	}
+
+	// Open session or batch
+	mode := PROPS.Mode
+	if len(mode) == 0 {
+		mode = MODE_JOB
+	}
+	session := PROPS.SessionID
+	opened := false
+	switch {
+	case len(session) > 0:
+		klog.Info("Running in existing session ", session)
+	case mode == MODE_SESSION || mode == MODE_BATCH:
+		var err error
+		if session, err = CLIENT.OpenSession(sessionMode(mode), PROPS.Backend, PROPS.MaxTime); err != nil {
+			return nil, "", err
+		}
+		klog.Info("Opened ", mode, " ", session)
+		opened = true
+	case mode != MODE_JOB:
+		return nil, "", fmt.Errorf("unknown execution mode %s, expected job, session or batch", mode)
+	case len(jobs) > 1:
+		return nil, "", e.New("multiple primitive jobs require session or batch mode")
+	}
+
+	ids := []string{}
+	var err error
+	for _, job := range jobs {
+		options := job.Options
+		if options == nil {
+			options = input.Options
+		}
+		if len(session) == 0 && PROPS.MaxTime > 0 {
+			// Without session, maximum time limits the job execution
+			if options == nil {
+				options = map[string]interface{}{}
+			}
+			if _, ok := options["max_execution_time"]; !ok {
+				options["max_execution_time"] = PROPS.MaxTime
+			}
+		}
+		var id string
+		id, err = CLIENT.SubmitPrimitive(client.PrimitiveJobRequest{
+			ProgramID: primitive,
+			Backend:   PROPS.Backend,
+			SessionID: session,
+			Params:    client.PrimitiveParams{Pubs: job.Pubs, Options: options, Version: PRIMITIVE_VERSION},
+			Tags:      []string{JOB_NAME},
+		})
+		if err != nil {
+			break
+		}
+		klog.Info("Submitted ", primitive, " job ", id)
+		ids = append(ids, id)
+	}
+	if opened {
+		if err := CLIENT.CloseSession(session); err != nil {
+			klog.Error("Session ", session, ": ", err)
+		} else {
+			klog.Info("Closed session ", session)
+		}
+	}
+	if err != nil && len(ids) == 0 {
+		return nil, session, err
+	}
+	if err != nil {
+		// Already submitted jobs are monitored
+		klog.Error("Not all primitive jobs submitted; err ", err)
+	}
+	return ids, session, nil
+}
+
+// Summary of primitive results for status, e.g. number of PUBs, expectation values of estimator
+func resultSummary(id string, results string) string {
+	result := PrimitiveResult{}
+	if err := json.Unmarshal([]byte(results), &result); err != nil || len(result.Results) == 0 {
+		return ""
+	}
+	parts := []string{}
+	for i, pub := range result.Results {
+		fields := []string{}
+		if evs, ok := pub.Data["evs"]; ok {
+			fields = append(fields, "evs "+compact(evs))
+		}
+		if stds, ok := pub.Data["stds"]; ok {
+			fields = append(fields, "stds "+compact(stds))
+		}
+		if len(fields) == 0 {
+			// Sampler results are registers with counts
+			names := []string{}
+			for name := range pub.Data {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			fields = append(fields, "registers "+strings.Join(names, ","))
+		}
+		parts = append(parts, fmt.Sprintf("pub %d: %s", i, strings.Join(fields, ", ")))
+	}
+	summary := fmt.Sprintf("job %s: %d PUB results; %s", id, len(result.Results), strings.Join(parts, "; "))
+	if len(summary) > SUMMARY_LENGTH {
+		summary = summary[:SUMMARY_LENGTH-3] + "..."
+	}
+	return summary
+}
+
+// Split primitive results into objects per PUB
+func pubObjects(results string) []string {
+	result := PrimitiveResult{}
+	if err := json.Unmarshal([]byte(results), &result); err != nil {
+		return nil
+	}
+	objects := []string{}
+	for _, pub := range result.Results {
+		content, err := json.Marshal(pub)
+		if err != nil {
+			return nil
+		}
+		objects = append(objects, string(content))
+	}
+	return objects
+}
+
+// Compact JSON value
+func compact(value json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, value); err != nil {
+		return string(value)
+	}
+	return buf.String()
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Invalid primitive jobs are rejected before anything is submitted
+func TestSubmitPrimitivesValidation(t *testing.T) {
+	pubs := `{"pubs": [["circuit", [[0.1]]]]}`
+	tests := []struct {
+		props  QuantumProperties
+		params string
+		err    string
+	}{
+		{QuantumProperties{Primitive: "optimizer", Backend: "ibm_kyiv"}, pubs, "unknown primitive optimizer"},
+		{QuantumProperties{Primitive: "sampler"}, pubs, "backend or backend selector is required"},
+		{QuantumProperties{Primitive: "Sampler", Backend: "ibm_kyiv"}, `{"pubs": `, "failed to parse primitive job parameters"},
+		{QuantumProperties{Primitive: "estimator", Backend: "ibm_kyiv"}, `{"options": {"default_shots": 100}}`, "no PUBs in primitive job 0"},
+		{QuantumProperties{Primitive: "estimator", Backend: "ibm_kyiv", Mode: MODE_BATCH}, `{"jobs": [` + pubs + `, {}]}`, "no PUBs in primitive job 1"},
+		{QuantumProperties{Primitive: "estimator", Backend: "ibm_kyiv", Mode: "parallel"}, pubs, "unknown execution mode parallel"},
+		{QuantumProperties{Primitive: "estimator", Backend: "ibm_kyiv"}, `{"jobs": [` + pubs + `, ` + pubs + `]}`, "multiple primitive jobs require session or batch mode"},
+	}
+	saved := PROPS
+	defer func() { PROPS = saved }()
+	for _, test := range tests {
+		PROPS = test.props
+		ids, _, err := submitPrimitives(test.params)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%+v %s: got error %v, expected %s", test.props, test.params, err, test.err)
+		}
+		if len(ids) > 0 {
+			t.Errorf("%+v %s: submitted %v", test.props, test.params, ids)
+		}
+	}
+}
+
+// Jobs of a batch are submitted with their options, or the common ones, and the batch is closed
+func TestSubmitPrimitivesBatch(t *testing.T) {
+	requests := []string{}
+	submitted := []map[string]interface{}{}
+	fakeService(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.Method + " " + r.URL.Path {
+		case "POST /sessions":
+			w.Write([]byte(`{"id": "batch-1"}`))
+		case "POST /jobs":
+			body, _ := io.ReadAll(r.Body)
+			request := map[string]interface{}{}
+			json.Unmarshal(body, &request)
+			submitted = append(submitted, request)
+			fmt.Fprintf(w, `{"id": "job-%d"}`, len(submitted))
+		case "PATCH /sessions/batch-1":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	saved := PROPS
+	defer func() { PROPS = saved }()
+	PROPS = QuantumProperties{Primitive: "Estimator", Backend: "ibm_kyiv", Mode: MODE_BATCH, MaxTime: 600}
+
+	ids, session, err := submitPrimitives(`{"options": {"default_shots": 100},
+		"jobs": [{"pubs": [["c1", "ZZ"]]}, {"pubs": [["c2", "XX"]], "options": {"default_shots": 10}}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, []string{"job-1", "job-2"}) || session != "batch-1" {
+		t.Errorf("got jobs %v in session %s", ids, session)
+	}
+	expected := []string{"POST /sessions", "POST /jobs", "POST /jobs", "PATCH /sessions/batch-1"}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Errorf("got requests %v, expected %v", requests, expected)
+	}
+	for i, shots := range []float64{100, 10} {
+		request := submitted[i]
+		params := request["params"].(map[string]interface{})
+		options := params["options"].(map[string]interface{})
+		if request["program_id"] != "estimator" || request["session_id"] != "batch-1" || options["default_shots"] != shots {
+			t.Errorf("job %d: unexpected request %v", i, request)
+		}
+		if _, ok := options["max_execution_time"]; ok {
+			t.Errorf("job %d: maximum time of the batch set as job execution time", i)
+		}
+	}
+}
+
+func TestResultSummary(t *testing.T) {
+	tests := []struct {
+		results string
+		summary string
+	}{
+		{`{"results": [{"data": {"evs": [0.5, -0.25], "stds": [0.01, 0.02]}, "metadata": {"shots": 4096}}]}`,
+			"job j1: 1 PUB results; pub 0: evs [0.5,-0.25], stds [0.01,0.02]"},
+		{`{"results": [{"data": {"meas": {"num_bits": 2}, "c": {"num_bits": 1}}}, {"data": {"meas": {}}}]}`,
+			"job j1: 2 PUB results; pub 0: registers c,meas; pub 1: registers meas"},
+		{`{"results": []}`, ""},
+		{`not json`, ""},
+	}
+	for _, test := range tests {
+		if summary := resultSummary("j1", test.results); summary != test.summary {
+			t.Errorf("%s: got %q, expected %q", test.results, summary, test.summary)
+		}
+	}
+
+	evs := make([]string, 400)
+	for i := range evs {
+		evs[i] = "0.125"
+	}
+	summary := resultSummary("j1", `{"results": [{"data": {"evs": [`+strings.Join(evs, ",")+`]}}]}`)
+	if len(summary) != SUMMARY_LENGTH || !strings.HasSuffix(summary, "...") {
+		t.Errorf("summary of %d characters not bounded: %s", len(summary), summary)
+	}
+}
+
+// Results are split per PUB, each object keeps the PUB data and metadata
+func TestPubObjects(t *testing.T) {
+	objects := pubObjects(`{"results": [{"data": {"evs": 0.5}, "metadata": {"shots": 10}}, {"data": {"evs": -1}}],
+		"metadata": {"version": 2}}`)
+	expected := []string{`{"data":{"evs":0.5},"metadata":{"shots":10}}`, `{"data":{"evs":-1}}`}
+	if !reflect.DeepEqual(objects, expected) {
+		t.Errorf("got %v, expected %v", objects, expected)
+	}
+	if objects := pubObjects(`[1, 2]`); objects != nil {
+		t.Errorf("got objects %v of invalid results", objects)
+	}
+}
@@ -0,0 +1,96 @@
+//=============================================================================
+// Program lifecycle
+// Inline and S3 programs are content addressed: the program name is suffixed with the hash of
+// program data and metadata, so that a program uploaded by an earlier job with the same content
+// is reused instead of uploading it again. Programs to be deleted after the job finishes
+// (jobdata.scriptCleanup) are private to the job, they are uploaded under the job name and never reused
+//=============================================================================
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"k8s.io/klog"
+
+	"github.com/ibm/bridge-operator/quantum-pod/client"
+)
+
+const (
+	CLEANUP_KEEP   = "keep"
+	CLEANUP_DELETE = "delete"
+
+	HASH_LENGTH = 12 // Length of the hash suffix of program names
+)
+
+// Hash of program data and metadata. Metadata is normalized, so that formatting does not change the hash
+func programHash(data string, metadata client.ProgramMetadataDefinition) string {
+	normalized, _ := json.Marshal(metadata)
+	h := sha256.New()
+	h.Write([]byte(data))
+	h.Write([]byte{0})
+	h.Write(normalized)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get program with the same content, or upload it. Returns program ID and whether it was uploaded.
+// Private programs are always uploaded, without the hash suffix, so that other jobs do not reuse them
+func findOrAddProgram(data string, metadata client.ProgramMetadataDefinition, private bool) (string, bool) {
+	name := metadata.Name
+	switch {
+	case len(name) == 0:
+		name = JOB_NAME
+	case private:
+		name = name + "-" + JOB_NAME
+	}
+
+	if !private {
+		name = name + "-" + programHash(data, metadata)[:HASH_LENGTH]
+
+		// Reuse existing program
+		programs, err := CLIENT.ListPrograms(name)
+		if err != nil {
+			klog.Info("Failed to look up program ", name, "; err ", err)
+		}
+		for _, program := range programs {
+			if program.Name == name {
+				klog.Info("Reusing program ", name, " with ID ", program.ID)
+				return program.ID, false
+			}
+		}
+	}
+
+	program, err := CLIENT.AddProgram(client.ProgramSubmissionRequest{
+		Name:        name,
+		Data:        []byte(data),
+		Cost:        metadata.Cost,
+		Description: metadata.Description,
+		Spec:        metadata.Spec,
+		IsPublic:    metadata.IsPublic,
+	})
+	if err != nil || len(program.ID) == 0 {
+		klog.Info("Failed to upload program ", name, "; err ", err)
+		return "", false
+	}
+	klog.Info("Uploaded program ", name, " with ID ", program.ID)
+	return program.ID, true
+}
+
+// Delete program uploaded by the pod, if requested by the cleanup policy. Such programs are private
+// to the job, reused programs are kept
+func cleanupProgram(data map[string]string, info map[string]string) {
+	if data["jobdata.scriptCleanup"] != CLEANUP_DELETE || info["status.programUploaded"] != "true" {
+		return
+	}
+	id := info["status.programId"]
+	if len(id) == 0 {
+		return
+	}
+	if err := CLIENT.DeleteProgram(id); err != nil {
+		klog.Error("Failed to delete program ", id, "; err ", err)
+		return
+	}
+	klog.Info("Deleted program ", id)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ibm/bridge-operator/quantum-pod/client"
+)
+
+// Hash depends on program data and metadata, not on the formatting of metadata
+func TestProgramHash(t *testing.T) {
+	metadata := func(text string) client.ProgramMetadataDefinition {
+		result := client.ProgramMetadataDefinition{}
+		if err := json.Unmarshal([]byte(text), &result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	base := metadata(`{"name": "sample-vqe", "cost": 600, "spec": {"backend_requirements": {"min_num_qubits": "5"}}}`)
+	hash := programHash("print(1)", base)
+	if len(hash) < HASH_LENGTH {
+		t.Fatalf("hash %s shorter than %d", hash, HASH_LENGTH)
+	}
+	tests := []struct {
+		data     string
+		metadata string
+		same     bool
+	}{
+		{"print(1)", `{"cost":600,"name":"sample-vqe","spec":{"backend_requirements":{"min_num_qubits":"5"}}}`, true},
+		{"print(1)", `{
+			"name": "sample-vqe",
+			"cost": 600,
+			"spec": {"backend_requirements": {"min_num_qubits": "5"}},
+			"unknown": "ignored"
+		}`, true},
+		{"print(2)", `{"name": "sample-vqe", "cost": 600, "spec": {"backend_requirements": {"min_num_qubits": "5"}}}`, false},
+		{"print(1)", `{"name": "sample-vqe", "cost": 300, "spec": {"backend_requirements": {"min_num_qubits": "5"}}}`, false},
+		{"print(1)", `{"name": "sample-qaoa", "cost": 600, "spec": {"backend_requirements": {"min_num_qubits": "5"}}}`, false},
+		{"print(1)", `{"name": "sample-vqe", "cost": 600}`, false},
+	}
+	for _, test := range tests {
+		if same := programHash(test.data, metadata(test.metadata)) == hash; same != test.same {
+			t.Errorf("%s %s: same hash %v, expected %v", test.data, test.metadata, same, test.same)
+		}
+	}
+}
+
+// Fake program store of the quantum service, records requests
+type fakePrograms struct {
+	programs map[string]string // program name to ID
+	requests []string
+}
+
+func (p *fakePrograms) serve(w http.ResponseWriter, r *http.Request) {
+	p.requests = append(p.requests, r.Method+" "+r.URL.Path)
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/programs":
+		programs := client.PaginatedProgramsResponse{}
+		for name, id := range p.programs {
+			if name == r.URL.Query().Get("name") {
+				programs.Programs = append(programs.Programs, client.Program{ID: id, Name: name})
+			}
+		}
+		json.NewEncoder(w).Encode(programs)
+	case r.Method == "POST" && r.URL.Path == "/programs":
+		body, _ := io.ReadAll(r.Body)
+		request := client.ProgramSubmissionRequest{}
+		json.Unmarshal(body, &request)
+		id := fmt.Sprintf("prog-%d", len(p.programs)+1)
+		p.programs[request.Name] = id
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(client.Program{ID: id, Name: request.Name})
+	case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/programs/"):
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// Shared programs are reused by content, private programs are uploaded per job and deleted after it
+func TestFindOrAddProgram(t *testing.T) {
+	store := &fakePrograms{programs: map[string]string{}}
+	fakeService(t, store.serve)
+	savedName := JOB_NAME
+	defer func() { JOB_NAME = savedName }()
+
+	metadata := client.ProgramMetadataDefinition{Name: "sample-vqe", Cost: 600}
+	hashed := "sample-vqe-" + programHash("print(1)", metadata)[:HASH_LENGTH]
+	tests := []struct {
+		job      string
+		data     string
+		metadata client.ProgramMetadataDefinition
+		private  bool
+		id       string
+		uploaded bool
+		name     string
+	}{
+		{"job1", "print(1)", metadata, false, "prog-1", true, hashed},
+		{"job2", "print(1)", metadata, false, "prog-1", false, hashed},
+		{"job3", "print(1)", metadata, true, "prog-2", true, "sample-vqe-job3"},
+		{"job4", "print(1)", metadata, true, "prog-3", true, "sample-vqe-job4"},
+		{"job5", "print(2)", client.ProgramMetadataDefinition{}, true, "prog-4", true, "job5"},
+	}
+	for _, test := range tests {
+		JOB_NAME = test.job
+		id, uploaded := findOrAddProgram(test.data, test.metadata, test.private)
+		if id != test.id || uploaded != test.uploaded {
+			t.Errorf("%s: got program %s uploaded %v, expected %s uploaded %v", test.job, id, uploaded, test.id, test.uploaded)
+		}
+		if store.programs[test.name] != test.id {
+			t.Errorf("%s: program %s not stored as %s: %v", test.job, test.name, test.id, store.programs)
+		}
+	}
+
+	// Only programs uploaded by the job are deleted
+	store.requests = nil
+	deleted := map[string]string{"jobdata.scriptCleanup": CLEANUP_DELETE}
+	cleanupProgram(deleted, map[string]string{"status.programId": "prog-1", "status.programUploaded": "false"})
+	cleanupProgram(map[string]string{"jobdata.scriptCleanup": CLEANUP_KEEP}, map[string]string{"status.programId": "prog-2", "status.programUploaded": "true"})
+	cleanupProgram(deleted, map[string]string{"status.programId": "prog-3", "status.programUploaded": "true"})
+	if expected := []string{"DELETE /programs/prog-3"}; !reflect.DeepEqual(store.requests, expected) {
+		t.Errorf("got requests %v, expected %v", store.requests, expected)
+	}
+}
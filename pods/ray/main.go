@@ -0,0 +1,261 @@
+//=============================================================================
+// Code for managing jobs deployed on Ray clusters
+//=============================================================================
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ibm/bridge-operator/podutils"
+
+	"k8s.io/klog"
+)
+
+const (
+	TIME = "2006-01-02T15:04:05Z"
+
+	// Job states reported to the operator
+	SUBMITTED = "SUBMITTED"
+	PENDING   = "PENDING"
+	RUNNING   = "RUNNING"
+	SUCCEEDED = "SUCCEEDED"
+	KILL      = "KILL"
+	FAILED    = "FAILED"
+	UNKNOWN   = "UNKNOWN"
+
+	MAX_MISSES = 10 // Number of polls the job can be missing in the cluster
+
+	CREDS_DIR   = "/credentials/"
+	FILES_DIR   = "/downloads/"
+	SCRIPT_NAME = "script.py"
+)
+
+var RAYURL string
+var JOB_NAME string
+var NAMESPACE string
+var POLL int
+var S3 string
+var TOKEN podutils.TokenProvider
+
+// Mapping of Ray job states to operator states
+var STATES = map[string]string{
+	"PENDING":   PENDING,
+	"RUNNING":   RUNNING,
+	"SUCCEEDED": SUCCEEDED,
+	"STOPPED":   KILL,
+	"FAILED":    FAILED,
+}
+
+// Submit job, returns its ID and message
+func submit(data map[string]string) (string, string) {
+	request, err := buildRequest(data)
+	if err != nil {
+		klog.Error("Failed to build job submission request; err ", err)
+		return "", "Failed to build job submission request: " + err.Error()
+	}
+	klog.Info("Submitting Ray job, entrypoint ", request.Entrypoint, " pip ", request.RuntimeEnv.Pip)
+	id, err := submitJob(*request)
+	if err != nil {
+		klog.Error("Failed to submit job; err ", err)
+		return "", "Failed to submit a job to Ray: " + err.Error()
+	}
+	klog.Info("Successfully submitted a job with job id ", id)
+	return id, ""
+}
+
+// Map Ray job state to operator state
+func jobState(job *JobDetails) string {
+	if state, ok := STATES[job.Status]; ok {
+		return state
+	}
+	return UNKNOWN
+}
+
+func finished(state string) bool {
+	return state == SUCCEEDED || state == KILL || state == FAILED
+}
+
+// Format Ray time (ms since epoch)
+func formatTime(ms int64) string {
+	if ms <= 0 {
+		return ""
+	}
+	return time.UnixMilli(ms).UTC().Format(TIME)
+}
+
+// Kill the job
+func killJob(id string, state string) {
+	if finished(state) {
+		klog.Info("Job ", id, " is already in finished state ", state)
+		return
+	}
+	if err := stopJob(id); err != nil {
+		klog.Info("Job ", id, " is not killed; err ", err, ". Continue in monitoring, will try to kill again.")
+		return
+	}
+	// The job is reported as STOPPED by the cluster once it terminates
+	klog.Info("Job ", id, " stop requested")
+}
+
+// Upload job log to S3 once the job finished
+func uploadLogs(id string, data map[string]string, info map[string]string) {
+	if len(S3) == 0 || len(data["s3upload.bucket"]) == 0 {
+		return
+	}
+	logs, err := jobLogs(id)
+	if err != nil {
+		klog.Info("Failed to get job log; err ", err)
+		info["status.message"] = "Failed to upload log"
+		return
+	}
+	if len(logs) == 0 {
+		info["status.message"] = "Log for current job is empty"
+		return
+	}
+	info["status.message"] = "Execution log can be found at S3 location specified"
+	podutils.UploadS3Data(data, info, []podutils.UploadFile{{Name: "logs", Content: string(logs)}})
+}
+
+// Monitoring job execution
+// Method that runs constantly monitoring Ray job
+func monitor(info map[string]string) {
+	id := info["id"]
+	misses := 0
+	tailing := false
+	// Run forever
+	for {
+		// Sleep before next run
+		time.Sleep(time.Duration(POLL) * time.Second)
+
+		// Get current config map
+		cm := podutils.GetConfigMap()
+
+		// Get current execution status and update config map
+		var state = ""
+		job, err := getJob(id)
+		if err != nil {
+			klog.Info("Failed to get job ", id, "; err ", err)
+			continue
+		}
+		if job != nil {
+			misses = 0
+			if !tailing {
+				podutils.TailLogs(cm.Data, podutils.LogStream{Name: "logs", Fetch: func() ([]byte, error) {
+					return jobLogs(id)
+				}})
+				tailing = true
+			}
+			state = jobState(job)
+			info["status.jobStatus"] = state
+			info["status.rayState"] = job.Status
+			if t := formatTime(job.StartTime); len(t) > 0 {
+				info["status.startTime"] = t
+			}
+			if finished(state) {
+				info["status.endTime"] = formatTime(job.EndTime)
+				if len(info["status.endTime"]) == 0 {
+					info["status.endTime"] = time.Now().Format(TIME)
+				}
+				if state != SUCCEEDED && len(job.Message) > 0 {
+					info["status.message"] = job.Message
+				}
+				uploadLogs(id, cm.Data, info)
+			} else if cm.Data["kill"] == "true" {
+				killJob(id, state)
+			}
+			podutils.UpdateConfigMap(cm, info)
+		} else {
+			misses++
+			if misses >= MAX_MISSES {
+				state = UNKNOWN
+				info["status.jobStatus"] = UNKNOWN
+				info["status.endTime"] = time.Now().Format(TIME)
+				info["status.message"] = fmt.Sprintf("Ray job %s not found in the cluster", id)
+				podutils.UpdateConfigMap(cm, info)
+				os.Exit(1)
+			}
+		}
+		// Terminate if we are done
+		if finished(state) {
+			podutils.FlushLogs()
+		}
+		if state == SUCCEEDED {
+			os.Exit(0)
+		}
+		if state == KILL || state == FAILED {
+			os.Exit(1)
+		}
+	}
+}
+
+// Main method
+func main() {
+
+	// Get namespace and job name from environment
+	NAMESPACE = os.Getenv("NAMESPACE")
+	JOB_NAME = os.Getenv("JOBNAME")
+
+	// Initialize utils
+	podutils.InitUtils(JOB_NAME, NAMESPACE)
+
+	// Get config map and its parameters
+	cm := podutils.GetConfigMap()
+	podutils.SetHTTPSettings(cm.Data)
+	RAYURL = strings.TrimSuffix(cm.Data["resourceURL"], "/")
+	POLL, _ = strconv.Atoi(cm.Data["updateInterval"])
+	S3 = cm.Data["s3.secret"]
+
+	// Dashboard token is optional, Ray jobs API is not authenticated by itself
+	if hasToken() {
+		TOKEN = podutils.NewTokenProvider(getToken)
+		podutils.WatchCredentials(time.Duration(POLL)*time.Second, TOKEN)
+	}
+
+	// Get ID from config map
+	id := cm.Data["id"]
+
+	// create info for keeping track of execution parameters
+	info := make(map[string]string)
+	info["status.startTime"] = cm.Data["status.startTime"]
+	info["status.endTime"] = ""
+	info["status.message"] = ""
+
+	// If an ID is present in the config map it means that that we have already started a job
+	if len(id) == 0 {
+		klog.Info("Ray Job with name ", JOB_NAME, " does not exist. Submitting new job.")
+
+		var msg string
+		id, msg = submit(cm.Data)
+		info["status.message"] = msg
+
+		if len(id) == 0 {
+			// Failed to submit a job
+			info["status.jobStatus"] = FAILED
+			info["status.endTime"] = time.Now().Format(TIME)
+		} else {
+			info["id"] = id
+			info["status.jobStatus"] = SUBMITTED
+			info["status.startTime"] = time.Now().Format(TIME)
+			info["status.submitTime"] = info["status.startTime"]
+		}
+
+		podutils.UpdateConfigMap(cm, info)
+
+		// Start monitoring or exit
+		if len(id) != 0 {
+			monitor(info)
+		} else {
+			klog.Exit("Failed to start Ray job")
+		}
+	} else {
+		// Job is already running
+		klog.Info("Ray Job has associated ID in ConfigMap. Handling state.")
+		info["id"] = id
+		monitor(info)
+	}
+}
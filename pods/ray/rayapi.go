@@ -0,0 +1,185 @@
+//=============================================================================
+// Ray Jobs REST API
+// Jobs are submitted to the dashboard of the Ray head node (port 8265). The working directory
+// of the job is uploaded as a package to the GCS of the cluster and referenced by runtime_env
+//=============================================================================
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ibm/bridge-operator/podutils"
+)
+
+// Job submission request
+type JobSubmitRequest struct {
+	Entrypoint string            `json:"entrypoint"`
+	RuntimeEnv *RuntimeEnv       `json:"runtime_env,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+}
+
+// Runtime environment of the job
+type RuntimeEnv struct {
+	WorkingDir string            `json:"working_dir,omitempty"`
+	Pip        []string          `json:"pip,omitempty"`
+	EnvVars    map[string]string `json:"env_vars,omitempty"`
+}
+
+// Job submission response
+type JobSubmitResponse struct {
+	JobID        string `json:"job_id"`
+	SubmissionID string `json:"submission_id"`
+}
+
+// Job details
+type JobDetails struct {
+	SubmissionID string `json:"submission_id"`
+	Status       string `json:"status"`
+	Message      string `json:"message"`
+	StartTime    int64  `json:"start_time"` // ms since epoch
+	EndTime      int64  `json:"end_time"`   // ms since epoch
+	ErrorType    string `json:"error_type"`
+}
+
+// Job logs response
+type JobLogsResponse struct {
+	Logs string `json:"logs"`
+}
+
+// Send request to the Ray dashboard. If the resource secret has a token (e.g. the dashboard is behind
+// an authenticating proxy), it is sent as bearer token
+func sendRayReq(method string, path string, body []byte, contentType string) ([]byte, int, error) {
+	req, err := http.NewRequest(method, RAYURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+	if TOKEN == nil {
+		respBody, statusCode := podutils.SendReq(req)
+		return respBody, statusCode, nil
+	}
+	respBody, statusCode := podutils.SendAuthReq(req, TOKEN, func(req *http.Request, token string) {
+		req.Header.Set("Authorization", "Bearer "+token)
+	})
+	return respBody, statusCode, nil
+}
+
+// Send JSON request and check its status code
+func callRay(method string, path string, request interface{}, what string) ([]byte, error) {
+	var body []byte
+	if request != nil {
+		var err error
+		if body, err = json.Marshal(request); err != nil {
+			return nil, err
+		}
+	}
+	respBody, statusCode, err := sendRayReq(method, path, body, "application/json")
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s request; err %s", what, err.Error())
+	}
+	if statusCode != 200 {
+		return respBody, fmt.Errorf("%s not successful, status code %d %s", what, statusCode, strings.TrimSpace(string(respBody)))
+	}
+	return respBody, nil
+}
+
+// Read the dashboard token from the resource secret
+func getToken() (string, time.Time, error) {
+	return strings.TrimSpace(podutils.ReadMountedFileContent(CREDS_DIR + "token")), time.Time{}, nil
+}
+
+// Check whether the resource secret has a dashboard token
+func hasToken() bool {
+	_, err := os.Stat(CREDS_DIR + "token")
+	return err == nil
+}
+
+// Submit job, returns submission ID
+func submitJob(request JobSubmitRequest) (string, error) {
+	respBody, err := callRay("POST", "/api/jobs/", request, "submitting job")
+	if err != nil {
+		return "", err
+	}
+	response := JobSubmitResponse{}
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return "", fmt.Errorf("failed to parse job submission response %s", string(respBody))
+	}
+	if len(response.SubmissionID) > 0 {
+		return response.SubmissionID, nil
+	}
+	if len(response.JobID) > 0 {
+		return response.JobID, nil
+	}
+	return "", fmt.Errorf("job submission response without ID %s", string(respBody))
+}
+
+// Get job details. Returns nil if the job is not known to the cluster
+func getJob(id string) (*JobDetails, error) {
+	respBody, statusCode, err := sendRayReq("GET", "/api/jobs/"+id, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	if statusCode == 404 {
+		return nil, nil
+	}
+	if statusCode != 200 {
+		return nil, fmt.Errorf("retrieving job not successful, status code %d %s", statusCode, strings.TrimSpace(string(respBody)))
+	}
+	job := JobDetails{}
+	if err := json.Unmarshal(respBody, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Get job logs
+func jobLogs(id string) ([]byte, error) {
+	respBody, err := callRay("GET", "/api/jobs/"+id+"/logs", nil, "retrieving job logs")
+	if err != nil {
+		return nil, err
+	}
+	logs := JobLogsResponse{}
+	if err := json.Unmarshal(respBody, &logs); err != nil {
+		return nil, err
+	}
+	return []byte(logs.Logs), nil
+}
+
+// Stop job
+func stopJob(id string) error {
+	_, err := callRay("POST", "/api/jobs/"+id+"/stop", nil, "stopping job")
+	return err
+}
+
+// Upload package to the GCS of the cluster, unless a package of the same name (content hash) is there
+func uploadPackage(name string, content []byte) error {
+	path := "/api/packages/gcs/" + name
+	respBody, statusCode, err := sendRayReq("GET", path, nil, "")
+	if err != nil {
+		return err
+	}
+	if statusCode == 200 {
+		return nil
+	}
+	if statusCode != 404 {
+		return fmt.Errorf("checking package not successful, status code %d %s", statusCode, strings.TrimSpace(string(respBody)))
+	}
+	respBody, statusCode, err = sendRayReq("PUT", path, content, "application/octet-stream")
+	if err != nil {
+		return err
+	}
+	if statusCode != 200 {
+		return fmt.Errorf("uploading package not successful, status code %d %s", statusCode, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
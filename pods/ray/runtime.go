@@ -0,0 +1,270 @@
+//=============================================================================
+// Job working directory and runtime environment
+// The script and additional data are staged from the config map or S3 into the working directory,
+// which is shipped to the cluster as a package. Script metadata gives pip requirements and environment
+// variables, parameters are passed to the script as --kwargs key=value
+//=============================================================================
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	e "errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ibm/bridge-operator/podutils"
+
+	"k8s.io/klog"
+)
+
+// Script metadata
+type ScriptMetadata struct {
+	Pip json.RawMessage   `json:"pip"` // Requirements, either {"name": "version"} or ["requirement"]
+	Env map[string]string `json:"env"` // Environment variables
+}
+
+// Get content of job data item, given inline or as bucket:object in S3
+func jobData(location string, value string, data map[string]string) (string, error) {
+	switch location {
+	case "", "inline":
+		return value, nil
+	case "s3":
+		bucket, object, ok := splitS3Location(value)
+		if !ok {
+			return "", fmt.Errorf("invalid S3 location %s, expected bucket:object", value)
+		}
+		content := podutils.DownloadS3Data(bucket, object, data)
+		if len(content) == 0 {
+			return "", fmt.Errorf("failed to download %s from S3", value)
+		}
+		return content, nil
+	}
+	return "", fmt.Errorf("unknown location %s", location)
+}
+
+// Split bucket:object location
+func splitS3Location(location string) (string, string, bool) {
+	pair := strings.SplitN(location, ":", 2)
+	if len(pair) != 2 || len(pair[0]) == 0 || len(pair[1]) == 0 {
+		return "", "", false
+	}
+	return pair[0], pair[1], true
+}
+
+// Stage script and additional data (comma separated bucket:object list) into the working directory
+func stageWorkingDir(dir string, data map[string]string) error {
+	script, err := jobData(data["jobdata.scriptLocation"], data["jobdata.jobScript"], data)
+	if err != nil {
+		return fmt.Errorf("script: %s", err.Error())
+	}
+	if len(strings.TrimSpace(script)) == 0 {
+		return e.New("script is empty")
+	}
+	if err := os.WriteFile(filepath.Join(dir, SCRIPT_NAME), []byte(script), 0644); err != nil {
+		return err
+	}
+	for _, f := range strings.Split(data["jobdata.additionalData"], ",") {
+		f = strings.TrimSpace(f)
+		if len(f) == 0 {
+			continue
+		}
+		bucket, object, ok := splitS3Location(f)
+		if !ok {
+			return fmt.Errorf("invalid additional data location %s, expected bucket:object", f)
+		}
+		if err := podutils.DownloadS3DataDisk(bucket, object, filepath.Join(dir, path.Base(object)), data); err != nil {
+			return fmt.Errorf("failed to download additional data %s; err %s", f, err.Error())
+		}
+	}
+	return nil
+}
+
+// Zip the working directory. Entries are sorted and carry no timestamps, so that the same content
+// gives the same package name
+func zipWorkingDir(dir string) ([]byte, string, error) {
+	files := []string{}
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	sort.Strings(files)
+
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for _, f := range files {
+		rel, err := filepath.Rel(dir, f)
+		if err != nil {
+			return nil, "", err
+		}
+		content, err := os.ReadFile(f)
+		if err != nil {
+			return nil, "", err
+		}
+		fw, err := w.CreateHeader(&zip.FileHeader{Name: filepath.ToSlash(rel), Method: zip.Deflate})
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := fw.Write(content); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	hash := sha1.Sum(buf.Bytes())
+	return buf.Bytes(), "_ray_pkg_" + hex.EncodeToString(hash[:]) + ".zip", nil
+}
+
+// Parse script metadata
+func parseMetadata(content string) (*ScriptMetadata, error) {
+	metadata := ScriptMetadata{}
+	if len(strings.TrimSpace(content)) == 0 {
+		return &metadata, nil
+	}
+	if err := json.Unmarshal([]byte(content), &metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse script metadata; err %s", err.Error())
+	}
+	return &metadata, nil
+}
+
+// Get pip requirements from metadata, versions given as a map are pinned
+func (m *ScriptMetadata) requirements() ([]string, error) {
+	if len(m.Pip) == 0 || string(m.Pip) == "null" {
+		return nil, nil
+	}
+	list := []string{}
+	if err := json.Unmarshal(m.Pip, &list); err == nil {
+		return list, nil
+	}
+	pinned := map[string]string{}
+	if err := json.Unmarshal(m.Pip, &pinned); err != nil {
+		return nil, e.New("pip in script metadata has to be a list of requirements or a map of versions")
+	}
+	for name, version := range pinned {
+		if len(version) > 0 {
+			list = append(list, name+"=="+version)
+		} else {
+			list = append(list, name)
+		}
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// Parse job parameters, a JSON object of values passed to the script
+func parseParameters(content string) (map[string]string, error) {
+	params := map[string]interface{}{}
+	if len(strings.TrimSpace(content)) > 0 {
+		if err := json.Unmarshal([]byte(content), &params); err != nil {
+			return nil, fmt.Errorf("failed to parse job parameters; err %s", err.Error())
+		}
+	}
+	result := map[string]string{}
+	for key, value := range params {
+		switch v := value.(type) {
+		case string:
+			result[key] = v
+		default:
+			encoded, _ := json.Marshal(v)
+			result[key] = string(encoded)
+		}
+	}
+	return result, nil
+}
+
+// Build entrypoint of the job. S3 parameters go first when S3 is configured, followed by the job
+// parameters in key order, each as a separate shell quoted key=value argument
+func buildEntrypoint(params map[string]string, data map[string]string) string {
+	kwargs := []string{}
+	if len(S3) > 0 {
+		secure := data["s3.secure"]
+		if len(secure) == 0 {
+			secure = "false"
+		}
+		kwargs = append(kwargs,
+			"s3_secret="+S3,
+			"s3_bucket="+data["s3upload.bucket"],
+			"s3_prefix="+JOB_NAME+"/",
+			"s3_secure="+secure)
+	}
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		kwargs = append(kwargs, key+"="+params[key])
+	}
+	entrypoint := "python " + SCRIPT_NAME
+	if len(kwargs) > 0 {
+		entrypoint += " --kwargs"
+		for _, arg := range kwargs {
+			entrypoint += " " + podutils.ShellQuote(arg)
+		}
+	}
+	return entrypoint
+}
+
+// Build job submission request: stage and upload the working directory, read metadata and parameters
+func buildRequest(data map[string]string) (*JobSubmitRequest, error) {
+	if err := stageWorkingDir(FILES_DIR, data); err != nil {
+		return nil, err
+	}
+	content, name, err := zipWorkingDir(FILES_DIR)
+	if err != nil {
+		return nil, fmt.Errorf("failed to package working directory; err %s", err.Error())
+	}
+	if err := uploadPackage(name, content); err != nil {
+		return nil, err
+	}
+	klog.Info("Working directory uploaded as ", name, ", ", len(content), " bytes")
+
+	extra := data["jobdata.scriptExtraLocation"]
+	metaContent, err := jobData(extra, data["jobdata.scriptMetadata"], data)
+	if err != nil {
+		return nil, fmt.Errorf("script metadata: %s", err.Error())
+	}
+	metadata, err := parseMetadata(metaContent)
+	if err != nil {
+		return nil, err
+	}
+	pip, err := metadata.requirements()
+	if err != nil {
+		return nil, err
+	}
+	paramContent, err := jobData(extra, data["jobdata.jobParameters"], data)
+	if err != nil {
+		return nil, fmt.Errorf("job parameters: %s", err.Error())
+	}
+	params, err := parseParameters(paramContent)
+	if err != nil {
+		return nil, err
+	}
+
+	return &JobSubmitRequest{
+		Entrypoint: buildEntrypoint(params, data),
+		RuntimeEnv: &RuntimeEnv{
+			WorkingDir: "gcs://" + name,
+			Pip:        pip,
+			EnvVars:    metadata.Env,
+		},
+		Metadata: map[string]string{"bridgejob": NAMESPACE + "/" + JOB_NAME},
+	}, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Parameters are passed as separate shell quoted arguments, S3 parameters first
+func TestBuildEntrypoint(t *testing.T) {
+	S3, JOB_NAME = "mysecret-s3", "rayjob"
+	defer func() { S3, JOB_NAME = "", "" }()
+	params, err := parseParameters(`{"iterations": 7, "name": "it's"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entrypoint := buildEntrypoint(params, map[string]string{"s3upload.bucket": "mybucket", "s3.secure": "true"})
+	expected := `python script.py --kwargs 's3_secret=mysecret-s3' 's3_bucket=mybucket' 's3_prefix=rayjob/' 's3_secure=true'` +
+		` 'iterations=7' 'name=it'\''s'`
+	if entrypoint != expected {
+		t.Errorf("unexpected entrypoint\ngot:      %s\nexpected: %s", entrypoint, expected)
+	}
+	S3 = ""
+	if entrypoint := buildEntrypoint(nil, nil); entrypoint != "python script.py" {
+		t.Errorf("unexpected entrypoint without parameters %s", entrypoint)
+	}
+}
+
+// Pip requirements are given either as a map of versions or as a list
+func TestRequirements(t *testing.T) {
+	for content, expected := range map[string][]string{
+		`{"pip": {"requests": "2.26.0", "qiskit": "0.34.2", "numpy": ""}}`: {"numpy", "qiskit==0.34.2", "requests==2.26.0"},
+		`{"pip": ["requests>=2.26", "qiskit"]}`:                            {"requests>=2.26", "qiskit"},
+		`{"env": {"MY_VARIABLE1": "foo"}}`:                                 nil,
+		``:                                                                 nil,
+	} {
+		metadata, err := parseMetadata(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pip, err := metadata.requirements()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(pip, expected) {
+			t.Errorf("metadata %s: got %v, expected %v", content, pip, expected)
+		}
+	}
+	metadata, _ := parseMetadata(`{"pip": "requests"}`)
+	if _, err := metadata.requirements(); err == nil {
+		t.Error("invalid pip accepted")
+	}
+}
+
+// Package name depends only on the content of the working directory
+func TestZipWorkingDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "script.py"), []byte("print(1)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	first, name, err := zipWorkingDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(filepath.Join(dir, "script.py"), time.Unix(0, 0), time.Unix(0, 0))
+	second, again, _ := zipWorkingDir(dir)
+	if name != again || !bytes.Equal(first, second) {
+		t.Errorf("package changed with modification time, %s and %s", name, again)
+	}
+	os.WriteFile(filepath.Join(dir, "data.csv"), []byte("a,b\n"), 0644)
+	if _, other, _ := zipWorkingDir(dir); other == name {
+		t.Error("package name did not change with content")
+	}
+}
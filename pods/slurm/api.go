@@ -0,0 +1,505 @@
+//=============================================================================
+// slurmrestd API models and version negotiation
+// The models cover data parser versions v0.0.36 through v0.0.41. Fields that changed
+// representation between versions (job state, times, exit code) accept all encodings
+//=============================================================================
+
+package main
+
+import (
+	"encoding/json"
+	e "errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog"
+)
+
+// API versions supported by the pod, in order of preference
+var SUPPORTED_VERSIONS = []string{"v0.0.41", "v0.0.40", "v0.0.39", "v0.0.38", "v0.0.37", "v0.0.36"}
+
+var versionPath = regexp.MustCompile(`^/slurm/(v\d+\.\d+\.\d+)/`)
+var versionURL = regexp.MustCompile(`^(.*?)/slurm/(v\d+\.\d+\.\d+)/?$`)
+
+var BASEURL string     // slurmrestd URL without API path
+var API_VERSION string // Negotiated API version
+
+// Error or warning returned by slurmrestd
+type APIMessage struct {
+	Error       string `json:"error,omitempty"`
+	Errno       int    `json:"errno,omitempty"`        // v0.0.38 and older
+	ErrorNumber int    `json:"error_number,omitempty"` // v0.0.39+
+	Description string `json:"description,omitempty"`
+	Source      string `json:"source,omitempty"`
+}
+
+// Errors and warnings part of every response
+type APIResponse struct {
+	Errors   []APIMessage `json:"errors,omitempty"`
+	Warnings []APIMessage `json:"warnings,omitempty"`
+}
+
+// Number encoded either as integer (v0.0.38 and older) or as {set, infinite, number} (v0.0.39+)
+type NoValNumber struct {
+	Set      bool  `json:"set"`
+	Infinite bool  `json:"infinite"`
+	Number   int64 `json:"number"`
+}
+
+// Job state, either a string (v0.0.38 and older) or a list of state and flags (v0.0.39+)
+type JobState []string
+
+// Exit code, either integer, NoValNumber (v0.0.39) or verbose exit code (v0.0.40+)
+type ExitCode struct {
+	Status     JobState    `json:"status,omitempty"`
+	ReturnCode NoValNumber `json:"return_code"`
+	Signal     struct {
+		Id   NoValNumber `json:"id"`
+		Name string      `json:"name"`
+	} `json:"signal"`
+}
+
+// Job description for submission
+type JobDescription struct {
+	Name                    string      `json:"name,omitempty"`
+	Partition               string      `json:"partition,omitempty"`
+	Tasks                   int         `json:"tasks,omitempty"`
+	MinimumNodes            int         `json:"minimum_nodes,omitempty"`
+	CurrentWorkingDirectory string      `json:"current_working_directory,omitempty"`
+	StandardOutput          string      `json:"standard_output,omitempty"`
+	StandardError           string      `json:"standard_error,omitempty"`
+	TresPerNode             string      `json:"tres_per_node,omitempty"`
+	Array                   string      `json:"array,omitempty"`
+	Environment             interface{} `json:"environment,omitempty"` // map (v0.0.38 and older) or NAME=value list
+	Script                  string      `json:"script,omitempty"`      // v0.0.40+
+}
+
+// Job submission request
+type SubmitRequest struct {
+	Job    *JobDescription  `json:"job,omitempty"`
+	Jobs   []JobDescription `json:"jobs,omitempty"`   // Heterogeneous job components
+	Script string           `json:"script,omitempty"` // v0.0.39 and older
+}
+
+// Job submission response
+type SubmitResponse struct {
+	APIResponse
+	JobId  int    `json:"job_id"`
+	StepId string `json:"step_id,omitempty"`
+}
+
+// HPC job info
+type Job struct {
+	JobId            int         `json:"job_id"`
+	Name             string      `json:"name"`
+	JobState         JobState    `json:"job_state"`
+	StateReason      string      `json:"state_reason"`
+	StateDescription string      `json:"state_description"`
+	ExitCode         ExitCode    `json:"exit_code"`
+	WorkingDirectory string      `json:"current_working_directory"`
+	StandardOutput   string      `json:"standard_output"`
+	StandardError    string      `json:"standard_error"`
+	ArrayJobId       NoValNumber `json:"array_job_id"`
+	ArrayTaskId      NoValNumber `json:"array_task_id"`
+	ArrayTaskString  string      `json:"array_task_string"`
+	HetJobId         NoValNumber `json:"het_job_id"`
+	HetJobOffset     NoValNumber `json:"het_job_offset"`
+	SubmitTime       NoValNumber `json:"submit_time"`
+	StartTime        NoValNumber `json:"start_time"`
+	EndTime          NoValNumber `json:"end_time"`
+}
+
+// Job info response
+type JobsResponse struct {
+	APIResponse
+	Jobs []Job `json:"jobs"`
+}
+
+// slurmdbd accounting job info
+type AccountingJob struct {
+	JobId            int      `json:"job_id"`
+	Name             string   `json:"name"`
+	ExitCode         ExitCode `json:"exit_code"`
+	WorkingDirectory string   `json:"working_directory"`
+	Array            struct {
+		JobId  NoValNumber `json:"job_id"`
+		TaskId NoValNumber `json:"task_id"`
+		Task   string      `json:"task"`
+	} `json:"array"`
+	Het struct {
+		JobId     NoValNumber `json:"job_id"`
+		JobOffset NoValNumber `json:"job_offset"`
+	} `json:"het"`
+	State struct {
+		Current JobState `json:"current"`
+		Reason  string   `json:"reason"`
+	} `json:"state"`
+	Time struct {
+		Submission NoValNumber `json:"submission"`
+		Start      NoValNumber `json:"start"`
+		End        NoValNumber `json:"end"`
+	} `json:"time"`
+}
+
+// slurmdbd accounting response
+type AccountingResponse struct {
+	APIResponse
+	Jobs []AccountingJob `json:"jobs"`
+}
+
+// OpenAPI document, only paths are of interest
+type OpenAPI struct {
+	Paths map[string]interface{} `json:"paths"`
+}
+
+func (m APIMessage) String() string {
+	msg := m.Description
+	if len(m.Error) > 0 && m.Error != msg {
+		if len(msg) > 0 {
+			msg += ": "
+		}
+		msg += m.Error
+	}
+	if len(m.Source) > 0 {
+		msg = m.Source + ": " + msg
+	}
+	return msg
+}
+
+// Get errors and warnings as a single message, empty if there are none
+func (r *APIResponse) Message() string {
+	messages := []string{}
+	for _, m := range r.Errors {
+		messages = append(messages, "error: "+m.String())
+	}
+	for _, m := range r.Warnings {
+		messages = append(messages, "warning: "+m.String())
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (n *NoValNumber) UnmarshalJSON(data []byte) error {
+	*n = NoValNumber{}
+	if string(data) == "null" {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '{' {
+		type noVal NoValNumber
+		return json.Unmarshal(data, (*noVal)(n))
+	}
+	if err := json.Unmarshal(data, &n.Number); err != nil {
+		return err
+	}
+	n.Set = true
+	return nil
+}
+
+func (s *JobState) UnmarshalJSON(data []byte) error {
+	var state string
+	if json.Unmarshal(data, &state) == nil {
+		*s = JobState{state}
+		return nil
+	}
+	var states []string
+	if err := json.Unmarshal(data, &states); err != nil {
+		return err
+	}
+	*s = states
+	return nil
+}
+
+// Get base job state, flags are ignored
+func (s JobState) Base() string {
+	if len(s) == 0 {
+		return UNKNOWN
+	}
+	return s[0]
+}
+
+func (c *ExitCode) UnmarshalJSON(data []byte) error {
+	*c = ExitCode{}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(data, &fields) == nil && fields["return_code"] != nil {
+		type exitCode ExitCode
+		return json.Unmarshal(data, (*exitCode)(c))
+	}
+	return json.Unmarshal(data, &c.ReturnCode)
+}
+
+// Get return code and signal. Exit codes before v0.0.40 are raw wait statuses
+func (c ExitCode) Code() (int64, int64) {
+	if len(c.Status) > 0 || c.Signal.Id.Set {
+		return c.ReturnCode.Number, c.Signal.Id.Number
+	}
+	status := c.ReturnCode.Number
+	return (status >> 8) & 0xff, status & 0x7f
+}
+
+// Check whether job is the given job, its array task or heterogeneous component
+func (j *Job) belongsTo(id string) bool {
+	return strconv.Itoa(j.JobId) == id ||
+		(j.ArrayJobId.Set && j.ArrayJobId.Number != 0 && strconv.FormatInt(j.ArrayJobId.Number, 10) == id) ||
+		(j.HetJobId.Set && j.HetJobId.Number != 0 && strconv.FormatInt(j.HetJobId.Number, 10) == id)
+}
+
+// Get task name, <array job>_<task> for array tasks, <het job>+<offset> for heterogeneous components
+func (j *Job) taskName() string {
+	if j.ArrayJobId.Set && j.ArrayJobId.Number != 0 {
+		if j.ArrayTaskId.Set && !j.ArrayTaskId.Infinite && len(j.ArrayTaskString) == 0 {
+			return fmt.Sprintf("%d_%d", j.ArrayJobId.Number, j.ArrayTaskId.Number)
+		}
+		return fmt.Sprintf("%d_[%s]", j.ArrayJobId.Number, j.ArrayTaskString)
+	}
+	if j.HetJobId.Set && j.HetJobId.Number != 0 {
+		return fmt.Sprintf("%d+%d", j.HetJobId.Number, j.HetJobOffset.Number)
+	}
+	return strconv.Itoa(j.JobId)
+}
+
+// Convert accounting record to job info
+func (a *AccountingJob) toJob() *Job {
+	return &Job{
+		JobId:            a.JobId,
+		Name:             a.Name,
+		JobState:         a.State.Current,
+		StateReason:      a.State.Reason,
+		ExitCode:         a.ExitCode,
+		WorkingDirectory: a.WorkingDirectory,
+		ArrayJobId:       a.Array.JobId,
+		ArrayTaskId:      a.Array.TaskId,
+		ArrayTaskString:  a.Array.Task,
+		HetJobId:         a.Het.JobId,
+		HetJobOffset:     a.Het.JobOffset,
+		SubmitTime:       a.Time.Submission,
+		StartTime:        a.Time.Start,
+		EndTime:          a.Time.End,
+	}
+}
+
+// Compare API versions, returns negative, zero or positive number
+func compareVersions(a, b string) int {
+	pa := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	pb := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		na, _ := strconv.Atoi(pa[i])
+		nb, _ := strconv.Atoi(pb[i])
+		if na != nb {
+			return na - nb
+		}
+	}
+	return len(pa) - len(pb)
+}
+
+func isSupported(version string) bool {
+	for _, v := range SUPPORTED_VERSIONS {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// Build URL for API path
+func apiURL(path string) string {
+	return BASEURL + "/slurm/" + API_VERSION + path
+}
+
+// Build URL for slurmdbd API path
+func dbURL(path string) string {
+	return BASEURL + "/slurmdb/" + API_VERSION + path
+}
+
+// Get API versions published by slurmrestd in its OpenAPI document
+func getAPIVersions() []string {
+	for _, path := range []string{"/openapi/v3", "/openapi"} {
+		req, err := http.NewRequest("GET", BASEURL+path, nil)
+		if err != nil {
+			klog.Error("Error creating OpenAPI request; err ", err)
+			return nil
+		}
+		req.Header.Set("Accept", "application/json")
+		respBody, statusCode := sendReq(req)
+		if statusCode != 200 {
+			continue
+		}
+		doc := OpenAPI{}
+		if err := json.Unmarshal(respBody, &doc); err != nil {
+			klog.Error("Error parsing OpenAPI document ", path, "; err ", err)
+			continue
+		}
+		found := map[string]bool{}
+		for p := range doc.Paths {
+			if m := versionPath.FindStringSubmatch(p); m != nil {
+				found[m[1]] = true
+			}
+		}
+		versions := []string{}
+		for v := range found {
+			versions = append(versions, v)
+		}
+		sort.Slice(versions, func(i, j int) bool { return compareVersions(versions[i], versions[j]) > 0 })
+		return versions
+	}
+	return nil
+}
+
+// Negotiate API version. Resource URL can either be the slurmrestd URL, or contain /slurm/<version>/
+// to pin the version. Otherwise the newest version published by slurmrestd and supported by us is used
+func negotiateVersion(resourceURL string) error {
+	pinned := ""
+	BASEURL = strings.TrimSuffix(resourceURL, "/")
+	if m := versionURL.FindStringSubmatch(resourceURL); m != nil {
+		BASEURL = m[1]
+		pinned = m[2]
+	}
+
+	versions := getAPIVersions()
+	klog.Info("slurmrestd API versions ", versions)
+	if len(pinned) > 0 {
+		if !isSupported(pinned) {
+			klog.Warning("Requested API version ", pinned, " is not supported, negotiating")
+		} else if len(versions) == 0 || contains(versions, pinned) {
+			API_VERSION = pinned
+			klog.Info("Using requested API version ", API_VERSION)
+			return nil
+		} else {
+			klog.Warning("Requested API version ", pinned, " is not provided by slurmrestd, negotiating")
+		}
+	}
+	for _, v := range versions {
+		if isSupported(v) {
+			API_VERSION = v
+			klog.Info("Using API version ", API_VERSION)
+			return nil
+		}
+	}
+	return e.New(fmt.Sprint("no supported API version found, slurmrestd provides ", versions))
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse job properties. Values are strings, numbers are accepted as well. Heterogeneous job components
+// are given as a list of property maps in "components", each inheriting properties not set in it
+func parseJobProperties(properties string) (map[string]string, []map[string]string, error) {
+	props := map[string]string{}
+	components := []map[string]string{}
+	if len(strings.TrimSpace(properties)) == 0 {
+		return props, components, nil
+	}
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(properties), &raw); err != nil {
+		return props, components, err
+	}
+	for k, v := range raw {
+		if k == "components" {
+			list := []map[string]json.RawMessage{}
+			if err := json.Unmarshal(v, &list); err != nil {
+				return props, components, fmt.Errorf("invalid components; err %s", err.Error())
+			}
+			for _, c := range list {
+				component := map[string]string{}
+				for ck, cv := range c {
+					component[ck] = propertyValue(cv)
+				}
+				components = append(components, component)
+			}
+			continue
+		}
+		props[k] = propertyValue(v)
+	}
+	return props, components, nil
+}
+
+// Get property value as string
+func propertyValue(v json.RawMessage) string {
+	var str string
+	if json.Unmarshal(v, &str) == nil {
+		return str
+	}
+	return strings.TrimSpace(string(v))
+}
+
+// Build job description from properties
+func buildDescription(props map[string]string) JobDescription {
+	job := JobDescription{
+		Name:                    props["slurmJobName"],
+		Partition:               props["Queue"],
+		CurrentWorkingDirectory: props["currentWorkingDir"],
+		StandardOutput:          props["OutputFileName"],
+		StandardError:           props["ErrorFileName"],
+		TresPerNode:             props["Gres"],
+	}
+	job.Tasks, _ = strconv.Atoi(props["Tasks"])
+	job.MinimumNodes, _ = strconv.Atoi(props["NodesNumber"])
+
+	// slurmrestd rejects jobs without environment
+	env := map[string]string{"PATH": props["envPath"], "LD_LIBRARY_PATH": props["envLibPath"]}
+	if len(env["PATH"]) == 0 {
+		env["PATH"] = "/bin:/usr/bin"
+	}
+	if len(env["LD_LIBRARY_PATH"]) == 0 {
+		delete(env, "LD_LIBRARY_PATH")
+	}
+	if compareVersions(API_VERSION, "v0.0.39") < 0 {
+		job.Environment = env
+	} else {
+		list := []string{}
+		for k, v := range env {
+			list = append(list, k+"="+v)
+		}
+		sort.Strings(list)
+		job.Environment = list
+	}
+	return job
+}
+
+// Build job submission request for the negotiated API version. Array range (e.g. 0-15) with
+// optional maximum of concurrently running tasks is taken from "array" and "arrayMaxConcurrent"
+func buildRequest(script string, props map[string]string, components []map[string]string) (SubmitRequest, error) {
+	request := SubmitRequest{}
+	array := props["array"]
+	if len(array) > 0 && len(props["arrayMaxConcurrent"]) > 0 && !strings.Contains(array, "%") {
+		array += "%" + props["arrayMaxConcurrent"]
+	}
+
+	var first *JobDescription
+	if len(components) == 0 {
+		job := buildDescription(props)
+		job.Array = array
+		request.Job = &job
+		first = request.Job
+	} else {
+		if len(array) > 0 {
+			return request, e.New("job arrays can not be heterogeneous")
+		}
+		for _, component := range components {
+			merged := map[string]string{}
+			for k, v := range props {
+				merged[k] = v
+			}
+			for k, v := range component {
+				merged[k] = v
+			}
+			request.Jobs = append(request.Jobs, buildDescription(merged))
+		}
+		first = &request.Jobs[0]
+	}
+
+	if compareVersions(API_VERSION, "v0.0.40") < 0 {
+		request.Script = script
+	} else {
+		first.Script = script
+	}
+	return request, nil
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ibm/bridge-operator/podutils"
+)
+
+// Numbers are accepted both as plain integers and as {set, infinite, number}
+func TestNoValNumber(t *testing.T) {
+	tests := []struct {
+		data   string
+		number NoValNumber
+	}{
+		{`42`, NoValNumber{Set: true, Number: 42}},
+		{`{"set":true,"infinite":false,"number":42}`, NoValNumber{Set: true, Number: 42}},
+		{`{"set":false,"infinite":true,"number":0}`, NoValNumber{Infinite: true}},
+		{`null`, NoValNumber{}},
+	}
+	for _, test := range tests {
+		number := NoValNumber{Set: true, Number: 1}
+		if err := json.Unmarshal([]byte(test.data), &number); err != nil {
+			t.Errorf("%s: %v", test.data, err)
+		} else if number != test.number {
+			t.Errorf("%s: got %+v, expected %+v", test.data, number, test.number)
+		}
+	}
+	if err := json.Unmarshal([]byte(`"42"`), &NoValNumber{}); err == nil {
+		t.Error("string number accepted")
+	}
+}
+
+// Job state is either a string or a list of state and flags
+func TestJobState(t *testing.T) {
+	tests := []struct {
+		data  string
+		state JobState
+		base  string
+	}{
+		{`"RUNNING"`, JobState{"RUNNING"}, "RUNNING"},
+		{`["COMPLETED"]`, JobState{"COMPLETED"}, "COMPLETED"},
+		{`["PENDING","REQUEUED"]`, JobState{"PENDING", "REQUEUED"}, "PENDING"},
+		{`[]`, JobState{}, UNKNOWN},
+	}
+	for _, test := range tests {
+		state := JobState{}
+		if err := json.Unmarshal([]byte(test.data), &state); err != nil {
+			t.Errorf("%s: %v", test.data, err)
+			continue
+		}
+		if !reflect.DeepEqual(state, test.state) {
+			t.Errorf("%s: got %v, expected %v", test.data, state, test.state)
+		}
+		if state.Base() != test.base {
+			t.Errorf("%s: got base %s, expected %s", test.data, state.Base(), test.base)
+		}
+	}
+}
+
+// Exit code is an integer, a NoValNumber or a verbose exit code depending on the version
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		data   string
+		number int64
+		status JobState
+	}{
+		{`256`, 256, nil},
+		{`{"set":true,"infinite":false,"number":256}`, 256, nil},
+		{`{"status":["EXITED"],"return_code":{"set":true,"number":1},"signal":{"id":{"set":false},"name":""}}`, 1, JobState{"EXITED"}},
+	}
+	for _, test := range tests {
+		code := ExitCode{}
+		if err := json.Unmarshal([]byte(test.data), &code); err != nil {
+			t.Errorf("%s: %v", test.data, err)
+			continue
+		}
+		if code.ReturnCode.Number != test.number || !reflect.DeepEqual(code.Status, test.status) {
+			t.Errorf("%s: got %+v", test.data, code)
+		}
+	}
+}
+
+// Errors come before warnings, with source and description
+func TestAPIResponseMessage(t *testing.T) {
+	response := APIResponse{}
+	if response.Message() != "" {
+		t.Errorf("unexpected message %q", response.Message())
+	}
+	data := `{"errors":[{"error":"Invalid job","description":"Unable to submit","source":"slurm_submit_batch_job()"}],
+		"warnings":[{"description":"Partition ignored"}]}`
+	if err := json.Unmarshal([]byte(data), &response); err != nil {
+		t.Fatal(err)
+	}
+	expected := "error: slurm_submit_batch_job(): Unable to submit: Invalid job; warning: Partition ignored"
+	if response.Message() != expected {
+		t.Errorf("got %q, expected %q", response.Message(), expected)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		sign int
+	}{
+		{"v0.0.40", "v0.0.40", 0},
+		{"v0.0.41", "v0.0.40", 1},
+		{"v0.0.9", "v0.0.10", -1},
+		{"v1.0.0", "v0.0.41", 1},
+		{"v0.0", "v0.0.36", -1},
+	}
+	for _, test := range tests {
+		c := compareVersions(test.a, test.b)
+		if (c > 0) != (test.sign > 0) || (c < 0) != (test.sign < 0) {
+			t.Errorf("compareVersions(%s, %s) = %d", test.a, test.b, c)
+		}
+	}
+}
+
+// Pinned version is used if slurmrestd provides it, otherwise the newest supported version is negotiated
+func TestNegotiateVersion(t *testing.T) {
+	TOKEN = podutils.NewTokenProvider(func() (string, time.Time, error) { return "token", time.Time{}, nil })
+	openapi := `{"paths":{"/slurm/v0.0.42/ping":{},"/slurm/v0.0.40/ping":{},"/slurm/v0.0.39/jobs":{},"/slurmdb/v0.0.39/jobs":{}}}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openapi/v3" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(openapi))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		url     string
+		version string
+	}{
+		{server.URL, "v0.0.40"},
+		{server.URL + "/", "v0.0.40"},
+		{server.URL + "/slurm/v0.0.39/", "v0.0.39"},
+		{server.URL + "/slurm/v0.0.38", "v0.0.40"},
+		{server.URL + "/slurm/v0.0.42", "v0.0.40"},
+	}
+	for _, test := range tests {
+		API_VERSION = ""
+		err := negotiateVersion(test.url)
+		if err != nil {
+			t.Errorf("%s: %v", test.url, err)
+			continue
+		}
+		if API_VERSION != test.version || BASEURL != server.URL {
+			t.Errorf("%s: got %s at %s, expected %s at %s", test.url, API_VERSION, BASEURL, test.version, server.URL)
+		}
+	}
+
+	openapi = `{"paths":{"/slurm/v0.0.42/ping":{}}}`
+	if err := negotiateVersion(server.URL); err == nil {
+		t.Errorf("negotiated unsupported version %s", API_VERSION)
+	}
+}
+
+// Heterogeneous components are given as a list of property maps, numbers are accepted as strings
+func TestParseJobProperties(t *testing.T) {
+	props, components, err := parseJobProperties(`{"Queue":"batch","Tasks":4,"array":"0-15",
+		"components":[{"Tasks":1,"NodesNumber":"1"},{"Queue":"gpu","Gres":"gpu:2"}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"Queue": "batch", "Tasks": "4", "array": "0-15"}
+	if !reflect.DeepEqual(props, expected) {
+		t.Errorf("got properties %v, expected %v", props, expected)
+	}
+	expectedComponents := []map[string]string{{"Tasks": "1", "NodesNumber": "1"}, {"Queue": "gpu", "Gres": "gpu:2"}}
+	if !reflect.DeepEqual(components, expectedComponents) {
+		t.Errorf("got components %v, expected %v", components, expectedComponents)
+	}
+
+	for _, properties := range []string{"", "  "} {
+		if props, components, err := parseJobProperties(properties); err != nil || len(props) != 0 || len(components) != 0 {
+			t.Errorf("%q: got %v, %v, %v", properties, props, components, err)
+		}
+	}
+	for _, properties := range []string{`{"Queue":`, `{"components":{"Tasks":1}}`} {
+		if _, _, err := parseJobProperties(properties); err == nil {
+			t.Errorf("%s: invalid properties accepted", properties)
+		}
+	}
+}
+
+// Arrays and heterogeneous components are built for the negotiated API version,
+// the script goes to the request before v0.0.40 and to the first job description since
+func TestBuildRequest(t *testing.T) {
+	props := map[string]string{"slurmJobName": "sim", "Queue": "batch", "Tasks": "4", "envPath": "/opt/bin"}
+	with := func(extra map[string]string) map[string]string {
+		merged := map[string]string{}
+		for k, v := range props {
+			merged[k] = v
+		}
+		for k, v := range extra {
+			merged[k] = v
+		}
+		return merged
+	}
+	tests := []struct {
+		version    string
+		props      map[string]string
+		components []map[string]string
+		request    SubmitRequest
+	}{
+		{"v0.0.38", with(map[string]string{"array": "0-15", "arrayMaxConcurrent": "4"}), nil, SubmitRequest{
+			Job: &JobDescription{Name: "sim", Partition: "batch", Tasks: 4, Array: "0-15%4",
+				Environment: map[string]string{"PATH": "/opt/bin"}},
+			Script: "script",
+		}},
+		{"v0.0.40", with(map[string]string{"array": "1,3,5%2", "arrayMaxConcurrent": "4", "envLibPath": "/opt/lib"}), nil, SubmitRequest{
+			Job: &JobDescription{Name: "sim", Partition: "batch", Tasks: 4, Array: "1,3,5%2",
+				Environment: []string{"LD_LIBRARY_PATH=/opt/lib", "PATH=/opt/bin"}, Script: "script"},
+		}},
+		{"v0.0.39", props, []map[string]string{{"Tasks": "1"}, {"Queue": "gpu", "Gres": "gpu:2"}}, SubmitRequest{
+			Jobs: []JobDescription{
+				{Name: "sim", Partition: "batch", Tasks: 1, Environment: []string{"PATH=/opt/bin"}},
+				{Name: "sim", Partition: "gpu", Tasks: 4, TresPerNode: "gpu:2", Environment: []string{"PATH=/opt/bin"}},
+			},
+			Script: "script",
+		}},
+		{"v0.0.41", map[string]string{}, []map[string]string{{"Tasks": "1"}, {"Tasks": "2"}}, SubmitRequest{
+			Jobs: []JobDescription{
+				{Tasks: 1, Environment: []string{"PATH=/bin:/usr/bin"}, Script: "script"},
+				{Tasks: 2, Environment: []string{"PATH=/bin:/usr/bin"}},
+			},
+		}},
+	}
+	for _, test := range tests {
+		API_VERSION = test.version
+		request, err := buildRequest("script", test.props, test.components)
+		if err != nil {
+			t.Errorf("%s %v: %v", test.version, test.props, err)
+			continue
+		}
+		if !reflect.DeepEqual(request, test.request) {
+			got, _ := json.Marshal(request)
+			expected, _ := json.Marshal(test.request)
+			t.Errorf("%s %v: got %s, expected %s", test.version, test.props, got, expected)
+		}
+	}
+
+	if _, err := buildRequest("script", with(map[string]string{"array": "0-3"}), []map[string]string{{}, {}}); err == nil {
+		t.Error("heterogeneous job array accepted")
+	}
+}
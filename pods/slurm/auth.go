@@ -0,0 +1,146 @@
+//=============================================================================
+// Authentication to slurmrestd
+// Depending on the keys in the resource secret, the token is either:
+//		password - a pre-generated user token (SLURM_JWT), renewed only on rotation of the secret
+//		jwtkey   - the cluster jwt_hs256 key, used to mint short-lived tokens for the user
+//		tokenurl - an endpoint issuing tokens for the user (basic auth with username/password, if present)
+//=============================================================================
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	e "errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ibm/bridge-operator/podutils"
+)
+
+const (
+	JWT_LIFETIME = 1800 // Default lifetime of minted tokens (sec)
+)
+
+// Token issuing endpoint response
+type TokenResponse struct {
+	Token string `json:"token"`
+}
+
+// Get Slurm user token. Credentials are read on every call, so that rotated secrets are picked up
+func getToken() (string, time.Time, error) {
+	username := strings.TrimSpace(podutils.ReadMountedFileContent(CREDS_DIR + "username"))
+	if len(username) == 0 {
+		return "", time.Time{}, e.New("Slurm user name missing in credentials")
+	}
+	USERNAME = username
+
+	if credExists("jwtkey") {
+		// Mint token ourselves
+		key := podutils.ReadMountedFileContent(CREDS_DIR + "jwtkey")
+		lifetime := JWT_LIFETIME
+		if credExists("lifetime") {
+			l, err := strconv.Atoi(strings.TrimSpace(podutils.ReadMountedFileContent(CREDS_DIR + "lifetime")))
+			if err == nil && l > 0 {
+				lifetime = l
+			}
+		}
+		token, expiry := mintToken(username, []byte(key), time.Duration(lifetime)*time.Second)
+		return token, expiry, nil
+	}
+
+	if credExists("tokenurl") {
+		// Get token from issuing endpoint
+		token, err := requestToken(username, strings.TrimSpace(podutils.ReadMountedFileContent(CREDS_DIR+"tokenurl")))
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		return token, jwtExpiry(token), nil
+	}
+
+	// Static user token
+	password := strings.TrimSpace(podutils.ReadMountedFileContent(CREDS_DIR + "password"))
+	if len(password) == 0 {
+		return "", time.Time{}, e.New("Slurm user token missing in credentials")
+	}
+	return password, jwtExpiry(password), nil
+}
+
+// Check whether credentials contain key
+func credExists(key string) bool {
+	_, err := os.Stat(CREDS_DIR + key)
+	return err == nil
+}
+
+// Mint HS256 token for user, the same way as `scontrol token` does
+func mintToken(username string, key []byte, lifetime time.Duration) (string, time.Time) {
+	now := time.Now()
+	expiry := now.Add(lifetime)
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iat": now.Unix(),
+		"exp": expiry.Unix(),
+		"sun": username,
+	})
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), expiry
+}
+
+// Request token from issuing endpoint. The endpoint can return JSON with token field or SLURM_JWT=token
+func requestToken(username, url string) (string, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	if credExists("password") {
+		req.SetBasicAuth(username, strings.TrimSpace(podutils.ReadMountedFileContent(CREDS_DIR+"password")))
+	}
+	respBody, statusCode := podutils.SendReq(req)
+	if statusCode != 200 {
+		return "", e.New("token request not successful, status code " + strconv.Itoa(statusCode))
+	}
+	response := TokenResponse{}
+	if json.Unmarshal(respBody, &response) == nil && len(response.Token) > 0 {
+		return response.Token, nil
+	}
+	token := strings.TrimPrefix(strings.TrimSpace(string(respBody)), "SLURM_JWT=")
+	if len(token) == 0 {
+		return "", e.New("token endpoint returned empty token")
+	}
+	return token, nil
+}
+
+// Get expiry from the (unverified) JWT claims, zero time if unknown
+func jwtExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if json.Unmarshal(payload, &claims) != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
+
+// Send request authenticated by Slurm user token
+func sendReq(req *http.Request) ([]byte, int) {
+	return podutils.SendAuthReq(req, TOKEN, func(req *http.Request, token string) {
+		req.Header.Set("X-SLURM-USER-NAME", USERNAME)
+		req.Header.Set("X-SLURM-USER-TOKEN", token)
+	})
+}
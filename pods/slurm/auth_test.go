@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Minted token is signed by the key and carries the user and expiry, as scontrol token does
+func TestMintToken(t *testing.T) {
+	key := []byte("jwt_hs256 key")
+	token, expiry := mintToken("alice", key, time.Hour)
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("token %s is not a JWT", token)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if parts[2] != base64.RawURLEncoding.EncodeToString(mac.Sum(nil)) {
+		t.Error("token is not signed by the key")
+	}
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	claims := map[string]interface{}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims["sun"] != "alice" {
+		t.Errorf("unexpected user %v", claims["sun"])
+	}
+	if d := time.Until(expiry); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("unexpected expiry %s", expiry)
+	}
+	if !jwtExpiry(token).Equal(time.Unix(expiry.Unix(), 0)) {
+		t.Errorf("expiry %s not in claims", expiry)
+	}
+}
+
+// Expiry is read from the token claims, zero time if unknown
+func TestJwtExpiry(t *testing.T) {
+	claims := func(payload string) string {
+		return "e30." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".sig"
+	}
+	tests := []struct {
+		token  string
+		expiry time.Time
+	}{
+		{claims(`{"exp":1700000000,"sun":"alice"}`), time.Unix(1700000000, 0)},
+		{claims(`{"sun":"alice"}`), time.Time{}},
+		{claims(`not json`), time.Time{}},
+		{"e30.!!!.sig", time.Time{}},
+		{"static-token", time.Time{}},
+	}
+	for _, test := range tests {
+		if expiry := jwtExpiry(test.token); !expiry.Equal(test.expiry) {
+			t.Errorf("%s: expiry %s, expected %s", test.token, expiry, test.expiry)
+		}
+	}
+}
+
+// Token endpoint can answer with JSON or SLURM_JWT=token
+func TestRequestToken(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		token  string
+	}{
+		{200, `{"token": "abc.def.ghi"}`, "abc.def.ghi"},
+		{200, "SLURM_JWT=abc.def.ghi\n", "abc.def.ghi"},
+		{200, "  ", ""},
+		{404, "not found", ""},
+	}
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.status)
+			w.Write([]byte(test.body))
+		}))
+		token, err := requestToken("alice", server.URL)
+		server.Close()
+		if token != test.token || (len(test.token) == 0) != (err != nil) {
+			t.Errorf("%d %q: got token %q, err %v", test.status, test.body, token, err)
+		}
+	}
+}
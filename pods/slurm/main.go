@@ -5,6 +5,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -22,14 +23,17 @@ const (
 	MULTIPLE_ACCEPT_TYPE = "text/plain,application/xml,text/xml,multipart/mixed"
 	TIME                 = "2006-01-02T15:04:05Z"
 
-	SUBMITTED  = "SUBMITTED"
-	PENDING    = "PENDING"
-	RUNNING    = "RUNNING"
-	COMPLETED  = "COMPLETED"
-	COMPLETING = "COMPLETING"
-	CANCELLED  = "CANCELLED"
-	UNKNOWN    = "UNKNOWN"
-	FAILED     = "FAILED"
+	// Job states reported to the operator
+	SUBMITTED = "SUBMITTED"
+	PENDING   = "PENDING"
+	RUNNING   = "RUNNING"
+	SUSPENDED = "SUSPENDED"
+	DONE      = "DONE"
+	KILL      = "KILL"
+	FAILED    = "FAILED"
+	UNKNOWN   = "UNKNOWN"
+
+	MAX_MISSES = 10 // Number of polls the job can be missing in both slurmctld and slurmdbd
 
 	CREDS_DIR  = "/credentials/"
 	SCRIPT_DIR = "/script/script"
@@ -45,8 +49,10 @@ var POLL int
 var S3 string
 var UPLOAD string
 var DOWNLOAD string
-var JobMap map[string]interface{}
 var JobProp map[string]string
+var COMPONENTS []map[string]string
+var USERNAME string
+var TOKEN podutils.TokenProvider
 
 // HPC job resource definitions
 var RESOURCES = map[string]string{
@@ -57,53 +63,127 @@ var RESOURCES = map[string]string{
 	"ErrorFileName":  "ERROR_FILE",
 }
 
-// Job ID
-type JobId struct {
-	Id int `json:"job_id"`
-}
-
-// HPC Job info
-type JobInfo struct {
-	Job []map[string]interface{} `json:"jobs"`
+// Mapping of Slurm job states to operator states
+var STATES = map[string]string{
+	"PENDING":       PENDING,
+	"CONFIGURING":   PENDING,
+	"REQUEUED":      PENDING,
+	"REQUEUE_FED":   PENDING,
+	"REQUEUE_HOLD":  PENDING,
+	"RESV_DEL_HOLD": PENDING,
+	"RUNNING":       RUNNING,
+	"COMPLETING":    RUNNING,
+	"RESIZING":      RUNNING,
+	"SIGNALING":     RUNNING,
+	"STAGE_OUT":     RUNNING,
+	"SUSPENDED":     SUSPENDED,
+	"STOPPED":       SUSPENDED,
+	"COMPLETED":     DONE,
+	"CANCELLED":     KILL,
+	"REVOKED":       KILL,
+	"FAILED":        FAILED,
+	"TIMEOUT":       FAILED,
+	"NODE_FAIL":     FAILED,
+	"PREEMPTED":     FAILED,
+	"OUT_OF_MEMORY": FAILED,
+	"BOOT_FAIL":     FAILED,
+	"DEADLINE":      FAILED,
+	"SPECIAL_EXIT":  FAILED,
 }
 
-// Gets detailed job information for jobs that have the specified job IDs.
-// If job is not return by call to all jobs, returns 404
-func getJobInfo(slurmUsername string, slurmToken string, id string) *JobInfo {
-	url := HPCURL + "/job/" + id
+// Gets detailed job information for job with the specified job ID, including its array tasks
+// and heterogeneous components. Returns nil if the job is not known to HPC
+func getJobInfo(id string, info map[string]string) []Job {
+	url := apiURL("/job/" + id)
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		klog.Error("Error creating Job Info request; err ", err)
 		return nil
 	}
 	req.Header.Set("Accept", "application/json")
-	req.Header.Set("X-SLURM-USER-NAME", slurmUsername)
-	req.Header.Set("X-SLURM-USER-TOKEN", slurmToken)
 
-	respBody, statusCode := podutils.SendReq(req)
+	respBody, statusCode := sendReq(req)
+	jobs := JobsResponse{}
+	if err := json.Unmarshal(respBody, &jobs); err != nil && statusCode == 200 {
+		klog.Error("Error parsing job info; err ", err)
+		return nil
+	}
+	if msg := jobs.Message(); len(msg) > 0 {
+		klog.Info("Job info for ", id, " returned ", msg)
+		info["status.message"] = msg
+	}
 	if statusCode != 200 {
 		klog.Error("Retrieving job info not successful, status code ", statusCode)
 		return nil
 	}
+	result := []Job{}
+	for _, job := range jobs.Jobs {
+		if job.belongsTo(id) {
+			result = append(result, job)
+		}
+	}
+	if len(result) == 0 {
+		klog.Error("Job ", id, " not found in job info")
+		return nil
+	}
+	return result
+}
 
-	job := JobInfo{}
-	err = json.Unmarshal(respBody, &job)
-	JobMap = job.Job[0]
-	return &job
+// Get job from slurmdbd accounting. Used once the job is purged from slurmctld
+func getJobFromAccounting(id string, info map[string]string) []Job {
+	url := dbURL("/job/" + id)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		klog.Error("Error creating accounting request; err ", err)
+		return nil
+	}
+	req.Header.Set("Accept", "application/json")
+
+	respBody, statusCode := sendReq(req)
+	if statusCode != 200 {
+		klog.Error("Retrieving job ", id, " from accounting not successful, status code ", statusCode)
+		return nil
+	}
+	jobs := AccountingResponse{}
+	if err := json.Unmarshal(respBody, &jobs); err != nil {
+		klog.Error("Error parsing accounting job info; err ", err)
+		return nil
+	}
+	if msg := jobs.Message(); len(msg) > 0 {
+		klog.Info("Accounting for ", id, " returned ", msg)
+	}
+	// Requeued jobs have several records, the last one is current
+	result := []Job{}
+	index := map[int]int{}
+	for i := range jobs.Jobs {
+		job := jobs.Jobs[i].toJob()
+		if !job.belongsTo(id) {
+			continue
+		}
+		if n, ok := index[job.JobId]; ok {
+			result[n] = *job
+		} else {
+			index[job.JobId] = len(result)
+			result = append(result, *job)
+		}
+	}
+	if len(result) == 0 {
+		klog.Error("Job ", id, " not found in accounting")
+		return nil
+	}
+	return result
 }
 
-func checkSlurmToken(slurmUsername string, slurmToken string) {
-	url := HPCURL + "/ping"
+func checkSlurmToken() {
+	url := apiURL("/ping")
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		klog.Error("Error creating ping request; err ", err)
 		os.Exit(1)
 	}
 	req.Header.Set("Accept", "application/json")
-	req.Header.Set("X-SLURM-USER-NAME", slurmUsername)
-	req.Header.Set("X-SLURM-USER-TOKEN", slurmToken)
 
-	_, statusCode := podutils.SendReq(req)
+	_, statusCode := sendReq(req)
 	if statusCode != 200 {
 		klog.Error("Ping to HPC cluster not successful, check SLURM Token ", statusCode)
 		os.Exit(1)
@@ -111,17 +191,9 @@ func checkSlurmToken(slurmUsername string, slurmToken string) {
 
 }
 
-// Build body for the HPC job submission
-func buildBody(script string) string {
-	var xmlString string
-	xmlPart := fmt.Sprintf("{\"job\":{\"partition\":\"%s\",\"tasks\":%s,\"name\":\"%s\",\"nodes\":%s,\"current_working_directory\":\"%s\",\"environment\":{\"PATH\":\"%s\",\"LD_LIBRARY_PATH\":\"%s\"}},\"script\":\"", JobProp["Queue"], JobProp["Tasks"], JobProp["slurmJobName"], JobProp["NodesNumber"], JobProp["currentWorkingDir"], JobProp["envPath"], JobProp["envLibPath"])
-	xmlString += fmt.Sprintf("%s%s%s\"} ", xmlString, xmlPart, script)
-	return xmlString
-}
-
-// Submit request for job execution
-func submit(slurmUsername string, slurmToken string, data map[string]string) int {
-	url := HPCURL + "/job/submit"
+// Submit request for job execution. Returns job id (empty on failure) and message from HPC
+func submit(data map[string]string) (string, string) {
+	url := apiURL("/job/submit")
 	jobscript := ""
 	if data["jobdata.scriptLocation"] == "s3" {
 		s3info := strings.Split(data["jobdata.jobScript"], ":")
@@ -130,106 +202,213 @@ func submit(slurmUsername string, slurmToken string, data map[string]string) int
 		jobscript = data["jobdata.jobScript"]
 	}
 
-	paramstr := data["jobproperties"]
-	err := json.Unmarshal([]byte(paramstr), &JobProp)
+	// Stage input data
+	jobscript, err := stageInputs(jobscript, data)
 	if err != nil {
-		klog.Info("Error in JobProperties provided ", err)
+		klog.Error("Failed to stage input data; err ", err)
+		return "", "Failed to stage input data: " + err.Error()
+	}
 
+	request, err := buildRequest(jobscript, JobProp, COMPONENTS)
+	if err != nil {
+		klog.Error("Failed to build job submission request ", err)
+		return "", err.Error()
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		klog.Error("Failed to build job submission request ", err)
+		return "", err.Error()
 	}
-	str_body := buildBody(jobscript)
 
-	req, err := http.NewRequest("POST", url, strings.NewReader(str_body))
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
 	if err != nil {
 		klog.Error("Failed to create http request to connect to HPC cluster ", err)
-		return 0
+		return "", err.Error()
 	}
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-SLURM-USER-NAME", slurmUsername)
-	req.Header.Set("X-SLURM-USER-TOKEN", slurmToken)
 
-	respBody, statusCode := podutils.SendReq(req)
+	respBody, statusCode := sendReq(req)
+	response := SubmitResponse{}
+	json.Unmarshal(respBody, &response)
+	msg := response.Message()
 
 	if statusCode != 200 {
 		klog.Error("Submitting job not successful - status code ", statusCode, " err ", string(respBody))
-		return 0
+		if len(msg) == 0 {
+			msg = fmt.Sprintf("Failed to submit a job to HPC, status code %d", statusCode)
+		}
+		return "", msg
 	}
-
-	var id JobId
-	json.Unmarshal(respBody, &id)
-	if id.Id == 0 {
-		klog.Error("Job submittion failed (id 0)")
-		return 0
+	if response.JobId == 0 {
+		klog.Error("Job submittion failed (id 0) ", msg)
+		if len(msg) == 0 {
+			msg = "Failed to submit a job to HPC"
+		}
+		return "", msg
 	}
-	klog.Info("Successfully submitted a job with job id ", id.Id)
-	return id.Id
+	klog.Info("Successfully submitted a job with job id ", response.JobId)
+	return strconv.Itoa(response.JobId), msg
 }
 
 // Kill HPC Job
-func kill(slurmUsername string, slurmToken string, id string) string {
-	url := HPCURL + "job" + id
+func kill(id string) string {
+	url := apiURL("/job/" + id)
 
 	req, err := http.NewRequest("DELETE", url, nil)
 	if err != nil {
 		return fmt.Sprintf("Failed to create job kill request, err: %s", err)
 	}
 	req.Header.Set("Accept", "application/json")
-	req.Header.Set("X-SLURM-USER-NAME", slurmUsername)
-	req.Header.Set("X-SLURM-USER-TOKEN", slurmToken)
 
-	respBody, statusCode := podutils.SendReq(req)
+	respBody, statusCode := sendReq(req)
 	if statusCode != 200 {
+		response := APIResponse{}
+		if json.Unmarshal(respBody, &response) == nil && len(response.Message()) > 0 {
+			return fmt.Sprintf("Failed to execute job kill request, status %d, %s", statusCode, response.Message())
+		}
 		return fmt.Sprintf("Failed to execute job kill request, status %d, respBody %s", statusCode, string(respBody))
 	}
 	return ""
 }
 
-// Get login token
-func getToken() (string, string) {
-	username := podutils.ReadMountedFileContent(CREDS_DIR + "username")
-	password := podutils.ReadMountedFileContent(CREDS_DIR + "password")
-	return username, password
+// Add additional information from HPC. For job arrays and heterogeneous jobs, the earliest submit
+// and start and the latest end times are used and outcome of every task is reported
+func getAdditionalInfo(jobs []Job, info map[string]string) {
+	var submit, start, end int64
+	for _, job := range jobs {
+		if t := job.SubmitTime; t.Set && t.Number != 0 && (submit == 0 || t.Number < submit) {
+			submit = t.Number
+		}
+		if t := job.StartTime; t.Set && t.Number != 0 && (start == 0 || t.Number < start) {
+			start = t.Number
+		}
+		if t := job.EndTime; t.Set && t.Number > end {
+			end = t.Number
+		}
+	}
+	if submit != 0 {
+		info["status.submitTime"] = time.Unix(submit, 0).UTC().Format(TIME)
+	}
+	if start != 0 {
+		info["status.startTime"] = time.Unix(start, 0).UTC().Format(TIME)
+	}
+	if end != 0 {
+		info["status.endTime"] = time.Unix(end, 0).UTC().Format(TIME)
+	}
+
+	// Exit code and reason, the first non zero exit code is reported for the whole job
+	messages := []string{}
+	var exitCode int64
+	for _, job := range jobs {
+		code, signal := job.ExitCode.Code()
+		if exitCode == 0 {
+			exitCode = code
+		}
+		if len(jobs) > 1 && code == 0 && signal == 0 && jobState(&job) == DONE {
+			continue
+		}
+		msg := fmt.Sprintf("Slurm job %s finished in state %s, exit code %d", job.taskName(), job.JobState.Base(), code)
+		if signal != 0 {
+			msg += fmt.Sprintf(", signal %d", signal)
+		}
+		if len(job.StateReason) > 0 && job.StateReason != "None" {
+			msg += ", reason " + job.StateReason
+		}
+		if len(job.StateDescription) > 0 {
+			msg += " (" + job.StateDescription + ")"
+		}
+		messages = append(messages, msg)
+	}
+	if len(jobs) > 1 {
+		messages = append([]string{"Tasks " + taskSummary(jobs)}, messages...)
+	}
+	info["status.exitCode"] = strconv.FormatInt(exitCode, 10)
+	msg := strings.Join(messages, "; ")
+	if len(info["status.message"]) > 0 {
+		msg = info["status.message"] + "; " + msg
+	}
+	info["status.message"] = msg
 }
 
-// Add additional information from HPC
-func getAdditionalInfo(info map[string]string) {
-	start := JobMap["start_time"]
-	if start != 0 {
-		info["startTime"] = fmt.Sprint(start)
+// Get operator state for Slurm job state
+func jobState(job *Job) string {
+	state, ok := STATES[job.JobState.Base()]
+	if !ok {
+		klog.Info("Unknown Slurm job state ", job.JobState.Base())
+		return UNKNOWN
+	}
+	return state
+}
+
+// Aggregate state of array tasks and heterogeneous components. The job is running while any
+// task is running, and finished when all tasks are; it is DONE only if every task is DONE
+func aggregateState(jobs []Job) string {
+	counts := map[string]int{}
+	for i := range jobs {
+		counts[jobState(&jobs[i])]++
 	}
-	sub := JobMap["submit_time"]
-	if sub != 0 {
-		info["submitTime"] = fmt.Sprint(sub)
+	switch {
+	case counts[RUNNING] > 0:
+		return RUNNING
+	case counts[PENDING] > 0:
+		return PENDING
+	case counts[SUSPENDED] > 0:
+		return SUSPENDED
+	case counts[UNKNOWN] > 0:
+		return UNKNOWN
+	case counts[FAILED] > 0:
+		return FAILED
+	case counts[KILL] > 0:
+		return KILL
 	}
-	end := JobMap["end_time"]
-	if end != 0 {
-		info["endTime"] = fmt.Sprint(end)
+	return DONE
+}
+
+// Summarize task states, e.g. "DONE 10, RUNNING 2"
+func taskSummary(jobs []Job) string {
+	counts := map[string]int{}
+	for i := range jobs {
+		counts[jobState(&jobs[i])]++
+	}
+	summary := []string{}
+	for _, state := range []string{PENDING, RUNNING, SUSPENDED, DONE, FAILED, KILL, UNKNOWN} {
+		if counts[state] > 0 {
+			summary = append(summary, fmt.Sprintf("%s %d", state, counts[state]))
+		}
 	}
+	return strings.Join(summary, ", ")
+}
+
+// Check if the job has finished
+func finished(state string) bool {
+	return state == DONE || state == KILL || state == FAILED
 }
 
 // Kill the job
-func killJob(slurmUsername string, slurmToken string, id string, state string, info map[string]string) {
+func killJob(id string, state string, info map[string]string) {
 	// Check if the job is still running
-	running := state != CANCELLED && state != COMPLETED && state != FAILED
-	if running {
+	if !finished(state) {
 		// Only kill jobs that are still running
-		res := kill(slurmUsername, slurmToken, id)
+		res := kill(id)
 		if len(res) == 0 {
 			klog.Info("Job", id, "killed successfully.")
-			info["jobStatus"] = CANCELLED
+			info["status.jobStatus"] = KILL
 		} else {
 			klog.Info("Job ", id, " is not killed; msg: ", res, ". Continue in monitoring, will try to kill again.")
 		}
 	} else {
-		info["jobStatus"] = CANCELLED
+		info["status.jobStatus"] = KILL
 		klog.Info("Job ", id, " is already in finished state ", state)
 	}
 }
 
 // Monitoring job execution
 // Method that runs constantly monitoring HPC job
-func monitor(slurmUsername string, slurmToken string, info map[string]string) {
+func monitor(info map[string]string) {
 	id := info["id"]
+	misses := 0
+	tailing := false
 	// Run forever
 	for {
 		// Sleep before next run
@@ -238,29 +417,58 @@ func monitor(slurmUsername string, slurmToken string, info map[string]string) {
 		// Get current config map
 		cm := podutils.GetConfigMap()
 
-		// Get current execution status and update config map
+		// Get current execution status and update config map.
+		// Jobs purged from slurmctld are looked up in accounting
 		var state = ""
-		job := getJobInfo(slurmUsername, slurmToken, id)
-		if job != nil {
-			jstate := JobMap["job_state"]
-			state = fmt.Sprint(jstate)
-			info["jobStatus"] = state
-			if state == COMPLETED || state == COMPLETING || state == CANCELLED || state == FAILED {
-				// Get additional info from HPC job
-				getAdditionalInfo(info)
+		jobs := getJobInfo(id, info)
+		if jobs == nil {
+			jobs = getJobFromAccounting(id, info)
+		}
+		if jobs != nil {
+			misses = 0
+			if !tailing {
+				// Output paths are known once the job is found
+				podutils.TailLogs(cm.Data, logStreams(jobs)...)
+				tailing = true
+			}
+			state = aggregateState(jobs)
+			info["status.jobStatus"] = state
+			if len(jobs) == 1 {
+				info["status.slurmState"] = strings.Join(jobs[0].JobState, ",")
+			} else {
+				info["status.slurmState"] = ""
+				info["status.tasks"] = taskSummary(jobs)
+			}
+			if finished(state) {
+				// Get additional info from HPC job and upload results
+				getAdditionalInfo(jobs, info)
+				uploadOutputs(jobs, cm.Data, info)
 			} else {
 				// Check for kill flag
 				if cm.Data["kill"] == "true" {
-					killJob(slurmUsername, slurmToken, id, info["jobStatus"], info)
+					killJob(id, state, info)
 				}
 			}
 			podutils.UpdateConfigMap(cm, info)
+		} else {
+			misses++
+			if misses >= MAX_MISSES {
+				state = UNKNOWN
+				info["status.jobStatus"] = UNKNOWN
+				info["status.endTime"] = time.Now().Format(TIME)
+				info["status.message"] = fmt.Sprintf("Slurm job %s not found in slurmctld nor accounting", id)
+				podutils.UpdateConfigMap(cm, info)
+				os.Exit(1)
+			}
 		}
 		// Terminate if we are done
-		if state == COMPLETED {
+		if finished(state) {
+			podutils.FlushLogs()
+		}
+		if state == DONE {
 			os.Exit(0)
 		}
-		if state == CANCELLED || state == FAILED {
+		if state == KILL || state == FAILED {
 			os.Exit(1)
 		}
 
@@ -279,50 +487,59 @@ func main() {
 
 	// Get config map and its parameters
 	cm := podutils.GetConfigMap()
+	podutils.SetHTTPSettings(cm.Data)
 	HPCURL = cm.Data["resourceURL"]
 	POLL, _ = strconv.Atoi(cm.Data["updateInterval"])
 	S3 = cm.Data["s3.secret"]
+	var err error
+	JobProp, COMPONENTS, err = parseJobProperties(cm.Data["jobproperties"])
+	if err != nil {
+		klog.Info("Error in JobProperties provided ", err)
+	}
 
 	// Get Access Username, Token for Slurm  cluster
-	slurmUsername, slurmToken := getToken()
-	checkSlurmToken(slurmUsername, slurmToken)
-
-	if len(slurmToken) == 0 || len(slurmUsername) == 0 {
+	TOKEN = podutils.NewTokenProvider(getToken)
+	if _, err := TOKEN.Token(); err != nil {
 		// Failed to get credentials for HPC cluster
 		klog.Exit("Failed to get access token for HPC cluster")
 	}
+	if err := negotiateVersion(HPCURL); err != nil {
+		klog.Exit("Failed to negotiate API version with HPC cluster; err ", err)
+	}
+	checkSlurmToken()
+	podutils.WatchCredentials(time.Duration(POLL)*time.Second, TOKEN)
 
 	// Get ID from config map
 	id := cm.Data["id"]
 
 	// create info for keeping track of execution parameters
 	info := make(map[string]string)
-	info["startTime"] = ""
-	info["endTime"] = ""
-	info["message"] = ""
+	info["status.startTime"] = ""
+	info["status.endTime"] = ""
+	info["status.message"] = ""
 
 	// If an ID is present in the config map it means that that we have already started a job
 	if len(id) == 0 {
 		klog.Info("Slurm Job with name ", JOB_NAME, " does not exist. Submitting new job.")
 
-		intId := submit(slurmUsername, slurmToken, cm.Data)
-		id = fmt.Sprint(intId)
+		var msg string
+		id, msg = submit(cm.Data)
+		info["status.message"] = msg
 
 		if len(id) == 0 {
 			// Failed to submit a job
-			info["jobStatus"] = FAILED
-			info["message"] = "Failed to submit a job to HPC"
+			info["status.jobStatus"] = FAILED
 		} else {
 			info["id"] = id
-			info["jobStatus"] = SUBMITTED
-			info["startTime"] = time.Now().Format(TIME)
+			info["status.jobStatus"] = SUBMITTED
+			info["status.startTime"] = time.Now().Format(TIME)
 		}
 
 		podutils.UpdateConfigMap(cm, info)
 
 		// Start monitoring or exit
 		if len(id) != 0 {
-			monitor(slurmUsername, slurmToken, info)
+			monitor(info)
 		} else {
 			klog.Exit("Failed to start HPC job")
 		}
@@ -330,6 +547,6 @@ func main() {
 		// Job is already running
 		klog.Info("Slurm Job  has associated ID in ConfigMap. Handling state.")
 		info["id"] = id
-		monitor(slurmUsername, slurmToken, info)
+		monitor(info)
 	}
 }
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ibm/bridge-operator/podutils"
+)
+
+func TestJobStates(t *testing.T) {
+	tests := []struct {
+		state  JobState
+		mapped string
+	}{
+		{JobState{"PENDING"}, PENDING},
+		{JobState{"PENDING", "REQUEUED"}, PENDING},
+		{JobState{"REQUEUE_HOLD"}, PENDING},
+		{JobState{"RUNNING", "COMPLETING"}, RUNNING},
+		{JobState{"STAGE_OUT"}, RUNNING},
+		{JobState{"SUSPENDED"}, SUSPENDED},
+		{JobState{"STOPPED"}, SUSPENDED},
+		{JobState{"COMPLETED"}, DONE},
+		{JobState{"CANCELLED"}, KILL},
+		{JobState{"TIMEOUT"}, FAILED},
+		{JobState{"OUT_OF_MEMORY"}, FAILED},
+		{JobState{"NODE_FAIL"}, FAILED},
+		{JobState{"NEW_STATE"}, UNKNOWN},
+		{JobState{}, UNKNOWN},
+	}
+	for _, test := range tests {
+		if mapped := jobState(&Job{JobState: test.state}); mapped != test.mapped {
+			t.Errorf("%v: got %s, expected %s", test.state, mapped, test.mapped)
+		}
+	}
+}
+
+// Exit codes before v0.0.40 are wait statuses, later ones carry return code and signal
+func TestExitCodeCode(t *testing.T) {
+	tests := []struct {
+		data       string
+		rc, signal int64
+	}{
+		{`0`, 0, 0},
+		{`512`, 2, 0},
+		{`{"set":true,"infinite":false,"number":9}`, 0, 9},
+		{`{"status":["EXITED"],"return_code":{"set":true,"number":2}}`, 2, 0},
+		{`{"status":["SIGNALED"],"return_code":{"set":false},"signal":{"id":{"set":true,"number":15},"name":"SIGTERM"}}`, 0, 15},
+	}
+	for _, test := range tests {
+		code := ExitCode{}
+		if err := json.Unmarshal([]byte(test.data), &code); err != nil {
+			t.Errorf("%s: %v", test.data, err)
+			continue
+		}
+		if rc, signal := code.Code(); rc != test.rc || signal != test.signal {
+			t.Errorf("%s: got %d, %d, expected %d, %d", test.data, rc, signal, test.rc, test.signal)
+		}
+	}
+}
+
+// Jobs purged from slurmctld are found in accounting, the last record of a requeued job is current
+func TestGetJobFromAccounting(t *testing.T) {
+	TOKEN = podutils.NewTokenProvider(func() (string, time.Time, error) { return "token", time.Time{}, nil })
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slurm/v0.0.40/job/17":
+			w.Write([]byte(`{"jobs":[],"errors":[{"error":"Invalid job id specified","error_number":2017}]}`))
+		case "/slurmdb/v0.0.40/job/17":
+			w.Write([]byte(`{"jobs":[
+				{"job_id":17,"name":"first","state":{"current":["REQUEUED"],"reason":"NodeDown"}},
+				{"job_id":18,"name":"other","state":{"current":["COMPLETED"]}},
+				{"job_id":17,"name":"last","working_directory":"/home/alice",
+					"exit_code":{"status":["EXITED"],"return_code":{"set":true,"number":3}},
+					"state":{"current":["FAILED"],"reason":"NonZeroExitCode"},
+					"time":{"start":{"set":true,"number":1700000000},"end":{"set":true,"number":1700000100}}}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	BASEURL, API_VERSION = server.URL, "v0.0.40"
+
+	info := map[string]string{}
+	if jobs := getJobInfo("17", info); jobs != nil {
+		t.Errorf("purged job found in slurmctld: %+v", jobs)
+	}
+	jobs := getJobFromAccounting("17", info)
+	if len(jobs) != 1 {
+		t.Fatalf("expected one job record, got %+v", jobs)
+	}
+	job := jobs[0]
+	if job.Name != "last" || job.WorkingDirectory != "/home/alice" || job.StateReason != "NonZeroExitCode" ||
+		job.StartTime.Number != 1700000000 || job.EndTime.Number != 1700000100 || jobState(&job) != FAILED {
+		t.Errorf("unexpected job %+v", job)
+	}
+	if rc, _ := job.ExitCode.Code(); rc != 3 {
+		t.Errorf("unexpected exit code %d", rc)
+	}
+	if jobs := getJobFromAccounting("19", info); jobs != nil {
+		t.Errorf("unknown job found in accounting: %+v", jobs)
+	}
+}
+
+// Array tasks and heterogeneous components are named after the job, the job is DONE only if every task is
+func TestTaskAggregation(t *testing.T) {
+	task := func(state string, array, index, het, offset int64) Job {
+		return Job{JobId: 100, JobState: JobState{state},
+			ArrayJobId: NoValNumber{Set: true, Number: array}, ArrayTaskId: NoValNumber{Set: true, Number: index},
+			HetJobId: NoValNumber{Set: true, Number: het}, HetJobOffset: NoValNumber{Set: true, Number: offset}}
+	}
+	pending := task("PENDING", 90, 0, 0, 0)
+	pending.ArrayTaskString = "3-7%2"
+	tests := []struct {
+		jobs    []Job
+		names   []string
+		state   string
+		summary string
+	}{
+		{[]Job{task("COMPLETED", 0, 0, 0, 0)}, []string{"100"}, DONE, "DONE 1"},
+		{[]Job{task("COMPLETED", 90, 0, 0, 0), task("RUNNING", 90, 1, 0, 0), pending},
+			[]string{"90_0", "90_1", "90_[3-7%2]"}, RUNNING, "PENDING 1, RUNNING 1, DONE 1"},
+		{[]Job{task("COMPLETED", 90, 0, 0, 0), task("SUSPENDED", 90, 1, 0, 0)}, []string{"90_0", "90_1"}, SUSPENDED, "SUSPENDED 1, DONE 1"},
+		{[]Job{task("COMPLETED", 0, 0, 80, 0), task("FAILED", 0, 0, 80, 1)}, []string{"80+0", "80+1"}, FAILED, "DONE 1, FAILED 1"},
+		{[]Job{task("CANCELLED", 90, 0, 0, 0), task("COMPLETED", 90, 1, 0, 0)}, []string{"90_0", "90_1"}, KILL, "DONE 1, KILL 1"},
+		{[]Job{task("TIMEOUT", 90, 0, 0, 0), task("CANCELLED", 90, 1, 0, 0)}, []string{"90_0", "90_1"}, FAILED, "FAILED 1, KILL 1"},
+		{[]Job{task("COMPLETED", 90, 0, 0, 0), task("NEW_STATE", 90, 1, 0, 0)}, []string{"90_0", "90_1"}, UNKNOWN, "DONE 1, UNKNOWN 1"},
+	}
+	for _, test := range tests {
+		for i := range test.jobs {
+			if name := test.jobs[i].taskName(); name != test.names[i] {
+				t.Errorf("got task name %s, expected %s", name, test.names[i])
+			}
+		}
+		if state := aggregateState(test.jobs); state != test.state {
+			t.Errorf("%v: got state %s, expected %s", test.names, state, test.state)
+		}
+		if summary := taskSummary(test.jobs); summary != test.summary {
+			t.Errorf("%v: got summary %s, expected %s", test.names, summary, test.summary)
+		}
+	}
+}
+
+// Only the job itself, its array tasks and heterogeneous components belong to it
+func TestBelongsTo(t *testing.T) {
+	tests := []struct {
+		job     Job
+		belongs bool
+	}{
+		{Job{JobId: 90}, true},
+		{Job{JobId: 91, ArrayJobId: NoValNumber{Set: true, Number: 90}}, true},
+		{Job{JobId: 92, HetJobId: NoValNumber{Set: true, Number: 90}}, true},
+		{Job{JobId: 93, ArrayJobId: NoValNumber{Set: true, Number: 0}, HetJobId: NoValNumber{Set: true, Number: 0}}, false},
+		{Job{JobId: 94, ArrayJobId: NoValNumber{Set: true, Number: 89}}, false},
+	}
+	for _, test := range tests {
+		if belongs := test.job.belongsTo("90"); belongs != test.belongs {
+			t.Errorf("%+v: got %v, expected %v", test.job, belongs, test.belongs)
+		}
+	}
+}
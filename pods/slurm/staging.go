@@ -0,0 +1,334 @@
+//=============================================================================
+// Data staging for Slurm jobs
+// Inputs are pulled by the batch script from S3 using presigned URLs, or pushed by the pod.
+// slurmrestd does not provide file access, so files are transferred through a staging endpoint
+// (stagingURL job property) serving the cluster file system, e.g. WebDAV or HTTP file server.
+// File path is appended to the staging URL. Requests are authenticated by the Slurm user token only
+// if the endpoint is on the slurmrestd host, Slurm credentials are not sent to other hosts
+//=============================================================================
+
+package main
+
+import (
+	"bytes"
+	e "errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ibm/bridge-operator/podutils"
+
+	"k8s.io/klog"
+)
+
+const (
+	SCRIPT_NAME    = "script"
+	STAGING_EXPIRY = 24 * 3600 // Default validity of presigned input URLs (sec)
+)
+
+// Send request to the staging endpoint. Slurm user token is only sent to the slurmrestd host
+func sendStagingReq(req *http.Request) ([]byte, int) {
+	slurm, err := url.Parse(HPCURL)
+	if err == nil && strings.EqualFold(slurm.Hostname(), req.URL.Hostname()) {
+		return sendReq(req)
+	}
+	return podutils.SendReq(req)
+}
+
+// Fetch file from the cluster through the staging endpoint
+func fetchFile(filename string) ([]byte, error) {
+	content, _, err := fetchFileFrom(filename, 0)
+	return content, err
+}
+
+// Fetch file content from offset through the staging endpoint. Returns the content and its offset,
+// 0 if the endpoint does not support ranges and returns the whole file
+func fetchFileFrom(filename string, offset int64) ([]byte, int64, error) {
+	staging := JobProp["stagingURL"]
+	if len(staging) == 0 {
+		return nil, 0, e.New("staging endpoint (stagingURL) is not configured")
+	}
+	url := strings.TrimSuffix(staging, "/") + "/" + strings.TrimPrefix(filename, "/")
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", "application/octet-stream")
+	podutils.SetRange(req, offset)
+
+	respBody, statusCode := sendStagingReq(req)
+	content, from, ok := podutils.RangeContent(respBody, statusCode, offset)
+	if !ok {
+		return nil, 0, fmt.Errorf("failed to fetch file %s, status code %d", filename, statusCode)
+	}
+	return content, from, nil
+}
+
+// Expand Slurm filename pattern and resolve it against job working directory
+func expandPath(pattern string, job *Job) string {
+	id := fmt.Sprint(job.JobId)
+	master, task := id, "4294967294"
+	if job.ArrayJobId.Set && job.ArrayJobId.Number != 0 {
+		master = fmt.Sprint(job.ArrayJobId.Number)
+		task = fmt.Sprint(job.ArrayTaskId.Number)
+	}
+	filename := strings.NewReplacer("%%", "%", "%j", id, "%A", master, "%a", task, "%x", job.Name, "%u", USERNAME).Replace(pattern)
+	if !path.IsAbs(filename) {
+		filename = path.Join(job.WorkingDirectory, filename)
+	}
+	return filename
+}
+
+// Get the list of output files of the job. Slurm writes both outputs to slurm-<id>.out by default.
+// Accounting does not record output files, so requested ones are used
+func outputFiles(job *Job, data map[string]string) []string {
+	files := []string{}
+	stdout, stderr := job.StandardOutput, job.StandardError
+	if len(stdout) == 0 {
+		stdout, stderr = JobProp["OutputFileName"], JobProp["ErrorFileName"]
+	}
+	if len(stdout) == 0 {
+		stdout = "slurm-%j.out"
+	}
+	files = append(files, expandPath(stdout, job))
+	if len(stderr) > 0 && stderr != stdout {
+		files = append(files, expandPath(stderr, job))
+	}
+	for _, f := range strings.Split(data["s3upload.files"], ",") {
+		f = strings.TrimSpace(f)
+		if len(f) > 0 {
+			files = append(files, expandPath(f, job))
+		}
+	}
+	return files
+}
+
+// Upload outputs of all job tasks, listed result files and execution script to <bucket>/<jobname>/.
+// Uploaded objects are reported in the status message
+func uploadOutputs(jobs []Job, data map[string]string, info map[string]string) {
+	// Skip if S3 info is not provided
+	if len(S3) == 0 || len(data["s3upload.bucket"]) == 0 {
+		return
+	}
+
+	// Build S3 file prefix
+	prefix := JOB_NAME + "/"
+	var objects []podutils.UploadFileLocation
+
+	// Add execution script, if not already on s3
+	if data["jobdata.scriptLocation"] != "s3" {
+		err := os.WriteFile(FILES_DIR+SCRIPT_NAME, []byte(data["jobdata.jobScript"]), 0644)
+		if err != nil {
+			klog.Info("Error saving execution script, it won't be uploaded to S3; err ", err.Error())
+		} else {
+			objects = append(objects, podutils.UploadFileLocation{Name: prefix + SCRIPT_NAME, Path: FILES_DIR + SCRIPT_NAME})
+		}
+	}
+
+	// Collect files of all tasks
+	files := []string{}
+	seen := map[string]bool{}
+	for i := range jobs {
+		for _, f := range outputFiles(&jobs[i], data) {
+			if !seen[f] {
+				seen[f] = true
+				files = append(files, f)
+			}
+		}
+	}
+
+	// For every file to upload
+	for _, f := range files {
+		content, err := fetchFile(f)
+		if err != nil {
+			klog.Info("Error downloading file ", f, ", this file won't be uploaded to S3; err ", err.Error())
+			continue
+		}
+		shortname := path.Base(f)
+		err = os.WriteFile(FILES_DIR+shortname, content, 0644)
+		if err != nil {
+			klog.Info("Error saving file ", f, ", this file won't be uploaded to S3; err ", err.Error())
+			continue
+		}
+		objects = append(objects, podutils.UploadFileLocation{Name: prefix + shortname, Path: FILES_DIR + shortname})
+	}
+
+	// Load to S3, one by one so that a failure does not prevent uploading the rest
+	uploaded := []string{}
+	for _, object := range objects {
+		if err := podutils.UploadS3DataDisk(data, []podutils.UploadFileLocation{object}); err == nil {
+			uploaded = append(uploaded, object.Name)
+		}
+	}
+	if len(uploaded) == 0 {
+		return
+	}
+	msg := fmt.Sprintf("Uploaded to S3 bucket %s: %s", data["s3upload.bucket"], strings.Join(uploaded, ", "))
+	if len(info["status.message"]) > 0 {
+		msg = info["status.message"] + "; " + msg
+	}
+	info["status.message"] = msg
+}
+
+// Output streams of the job tasks, tailed to the pod log through the staging endpoint
+func logStreams(jobs []Job) []podutils.LogStream {
+	if len(JobProp["stagingURL"]) == 0 {
+		klog.Info("Staging endpoint (stagingURL) is not configured, job output can't be tailed")
+		return nil
+	}
+	streams := []podutils.LogStream{}
+	seen := map[string]bool{}
+	for i := range jobs {
+		for j, f := range outputFiles(&jobs[i], map[string]string{}) {
+			if seen[f] {
+				continue
+			}
+			seen[f] = true
+			name := "stdout"
+			if j > 0 {
+				name = "stderr"
+			}
+			if len(jobs) > 1 {
+				name = jobs[i].taskName() + " " + name
+			}
+			filename := f
+			streams = append(streams, podutils.LogStream{Name: name, Fetch: func() ([]byte, error) {
+				return fetchFile(filename)
+			}, FetchFrom: func(offset int64) ([]byte, int64, error) {
+				return fetchFileFrom(filename, offset)
+			}})
+		}
+	}
+	return streams
+}
+
+// Get the list of bucket:object inputs to stage into the job working directory
+func inputFiles(data map[string]string) []string {
+	inputs := []string{}
+	lists := []string{data["jobdata.additionalData"]}
+	if data["jobdata.scriptExtraLocation"] == "s3" {
+		lists = append(lists, data["jobdata.jobParameters"], data["jobdata.scriptMetadata"])
+	}
+	for _, list := range lists {
+		for _, f := range strings.Split(list, ",") {
+			f = strings.TrimSpace(f)
+			if len(f) > 0 {
+				inputs = append(inputs, f)
+			}
+		}
+	}
+	return inputs
+}
+
+// Stage input files for the job. By default (stageIn "presigned") a prelude pulling the files from S3
+// with presigned URLs is added to the batch script. With stageIn "push" the files are downloaded by the pod
+// and pushed to the working directory through the staging endpoint. Returns the script to submit
+func stageInputs(script string, data map[string]string) (string, error) {
+	inputs := inputFiles(data)
+	if len(inputs) == 0 {
+		return script, nil
+	}
+	if len(S3) == 0 {
+		return script, e.New("input data requested, but S3 storage is not configured")
+	}
+	klog.Info("List of files to stage in: ", inputs)
+
+	if JobProp["stageIn"] == "push" {
+		return script, pushInputs(inputs, data)
+	}
+
+	// URLs have to be valid until the job starts
+	expiry := time.Duration(STAGING_EXPIRY) * time.Second
+	if v, err := strconv.Atoi(JobProp["stagingExpiry"]); err == nil && v > 0 {
+		expiry = time.Duration(v) * time.Second
+	}
+	prelude := []string{
+		"# Stage-in of input data, generated by bridge operator",
+		"bridge_stage_in() {",
+		"  if command -v curl >/dev/null 2>&1; then curl -fsSL -o \"$2\" \"$1\"; else wget -q -O \"$2\" \"$1\"; fi",
+		"}",
+	}
+	for _, f := range inputs {
+		bucket, object, ok := splitS3Location(f)
+		if !ok {
+			return script, fmt.Errorf("invalid input data location %s, expected bucket:object", f)
+		}
+		url, err := podutils.PresignS3Object(bucket, object, expiry, data)
+		if err != nil {
+			return script, fmt.Errorf("failed to presign input data %s; err %s", f, err.Error())
+		}
+		name := podutils.ShellQuote(path.Base(object))
+		prelude = append(prelude, fmt.Sprintf("bridge_stage_in %s %s || { echo \"Failed to stage in\" %s >&2; exit 1; }",
+			podutils.ShellQuote(url), name, name))
+	}
+
+	return insertPrelude(script, prelude), nil
+}
+
+// Insert prelude into batch script. #SBATCH directives are only processed before the first command,
+// so the prelude goes after the leading comments
+func insertPrelude(script string, prelude []string) string {
+	lines := strings.Split(script, "\n")
+	i := 0
+	for i < len(lines) {
+		line := strings.TrimSpace(lines[i])
+		if len(line) > 0 && !strings.HasPrefix(line, "#") {
+			break
+		}
+		i++
+	}
+	result := append([]string{}, lines[:i]...)
+	result = append(result, prelude...)
+	result = append(result, lines[i:]...)
+	return strings.Join(result, "\n")
+}
+
+// Download inputs from S3 and push them to the job working directory through the staging endpoint
+func pushInputs(inputs []string, data map[string]string) error {
+	staging := JobProp["stagingURL"]
+	cwd := JobProp["currentWorkingDir"]
+	if len(staging) == 0 || len(cwd) == 0 {
+		return e.New("pushing input data requires stagingURL and currentWorkingDir job properties")
+	}
+	for _, f := range inputs {
+		bucket, object, ok := splitS3Location(f)
+		if !ok {
+			return fmt.Errorf("invalid input data location %s, expected bucket:object", f)
+		}
+		name := path.Base(object)
+		err := podutils.DownloadS3DataDisk(bucket, object, FILES_DIR+name, data)
+		if err != nil {
+			return fmt.Errorf("failed to download input data %s; err %s", f, err.Error())
+		}
+		content, err := os.ReadFile(FILES_DIR + name)
+		if err != nil {
+			return err
+		}
+		url := strings.TrimSuffix(staging, "/") + "/" + strings.TrimPrefix(path.Join(cwd, name), "/")
+		req, err := http.NewRequest("PUT", url, bytes.NewReader(content))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/octet-stream")
+		_, statusCode := sendStagingReq(req)
+		if statusCode < 200 || statusCode > 299 {
+			return fmt.Errorf("failed to push input data %s, status code %d", f, statusCode)
+		}
+		klog.Info("Successfuly staged file ", f, " to ", path.Join(cwd, name))
+	}
+	return nil
+}
+
+// Split bucket:object location
+func splitS3Location(location string) (string, string, bool) {
+	pair := strings.SplitN(location, ":", 2)
+	if len(pair) != 2 || len(pair[0]) == 0 || len(pair[1]) == 0 {
+		return "", "", false
+	}
+	return pair[0], pair[1], true
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInputFiles(t *testing.T) {
+	tests := []struct {
+		data   map[string]string
+		inputs []string
+	}{
+		{map[string]string{}, []string{}},
+		{map[string]string{"jobdata.additionalData": "b:in1.dat, b:dir/in2.dat,"}, []string{"b:in1.dat", "b:dir/in2.dat"}},
+		{map[string]string{"jobdata.jobParameters": "b:params", "jobdata.scriptMetadata": "b:meta"}, []string{}},
+		{map[string]string{"jobdata.scriptExtraLocation": "s3", "jobdata.additionalData": "b:in",
+			"jobdata.jobParameters": "b:params", "jobdata.scriptMetadata": "b:meta"}, []string{"b:in", "b:params", "b:meta"}},
+	}
+	for _, test := range tests {
+		if inputs := inputFiles(test.data); !reflect.DeepEqual(inputs, test.inputs) {
+			t.Errorf("%v: got %v, expected %v", test.data, inputs, test.inputs)
+		}
+	}
+}
+
+func TestSplitS3Location(t *testing.T) {
+	tests := []struct {
+		location, bucket, object string
+		ok                       bool
+	}{
+		{"bucket:dir/object", "bucket", "dir/object", true},
+		{"bucket:a:b", "bucket", "a:b", true},
+		{"bucket", "", "", false},
+		{":object", "", "", false},
+		{"bucket:", "", "", false},
+	}
+	for _, test := range tests {
+		bucket, object, ok := splitS3Location(test.location)
+		if bucket != test.bucket || object != test.object || ok != test.ok {
+			t.Errorf("%s: got %s, %s, %v", test.location, bucket, object, ok)
+		}
+	}
+}
+
+// Stage-in prelude goes after the #SBATCH directives
+func TestInsertPrelude(t *testing.T) {
+	prelude := []string{"stage in"}
+	tests := []struct {
+		script, result string
+	}{
+		{"#!/bin/bash\n#SBATCH -N 1\n\n#SBATCH -t 10\nsrun ./app\n# done", "#!/bin/bash\n#SBATCH -N 1\n\n#SBATCH -t 10\nstage in\nsrun ./app\n# done"},
+		{"srun ./app", "stage in\nsrun ./app"},
+		{"  #SBATCH -N 1\n  srun ./app", "  #SBATCH -N 1\nstage in\n  srun ./app"},
+		{"#!/bin/bash\n#SBATCH -N 1", "#!/bin/bash\n#SBATCH -N 1\nstage in"},
+	}
+	for _, test := range tests {
+		if result := insertPrelude(test.script, prelude); result != test.result {
+			t.Errorf("%q: got %q, expected %q", test.script, result, test.result)
+		}
+	}
+}
+
+// Invalid stage-in requests fail before anything is downloaded or presigned
+func TestStageInputs(t *testing.T) {
+	script := "#!/bin/bash\nsrun ./app"
+	tests := []struct {
+		s3    string
+		props map[string]string
+		data  map[string]string
+		err   string
+	}{
+		{"", map[string]string{}, map[string]string{}, ""},
+		{"", map[string]string{}, map[string]string{"jobdata.additionalData": "b:in.dat"}, "S3 storage is not configured"},
+		{"s3", map[string]string{}, map[string]string{"jobdata.additionalData": "in.dat"}, "invalid input data location"},
+		{"s3", map[string]string{"stageIn": "push"}, map[string]string{"jobdata.additionalData": "b:in.dat"}, "stagingURL"},
+		{"s3", map[string]string{"stageIn": "push", "stagingURL": "https://fs"}, map[string]string{"jobdata.additionalData": "b:in.dat"}, "currentWorkingDir"},
+	}
+	for _, test := range tests {
+		S3, JobProp = test.s3, test.props
+		staged, err := stageInputs(script, test.data)
+		if staged != script {
+			t.Errorf("%v: script changed to %s", test.data, staged)
+		}
+		if len(test.err) == 0 && err != nil {
+			t.Errorf("%v: %v", test.data, err)
+		} else if len(test.err) > 0 && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%v: got error %v, expected %s", test.data, err, test.err)
+		}
+	}
+}
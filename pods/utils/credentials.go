@@ -0,0 +1,158 @@
+package podutils
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const (
+	WATCH_INTERVAL = 30               // Default interval for checking mounted secrets (sec)
+	TOKEN_MARGIN   = 60 * time.Second // Renew tokens this long before they expire
+)
+
+// Token provider. Obtains tokens for external resource access and renews them
+type TokenProvider interface {
+	// Get current token, authenticating if there is none or it is about to expire
+	Token() (string, error)
+	// Drop current token, so that the next call to Token authenticates again
+	Invalidate()
+}
+
+// Login function used by token provider. Returns token and its expiry (zero time if unknown)
+type LoginFunc func() (string, time.Time, error)
+
+// Token provider caching token obtained by login function
+type cachedTokenProvider struct {
+	lock   sync.Mutex
+	login  LoginFunc
+	token  string
+	expiry time.Time
+}
+
+// Create token provider for login function
+func NewTokenProvider(login LoginFunc) TokenProvider {
+	return &cachedTokenProvider{login: login}
+}
+
+func (p *cachedTokenProvider) Token() (string, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if len(p.token) > 0 && (p.expiry.IsZero() || time.Until(p.expiry) > TOKEN_MARGIN) {
+		return p.token, nil
+	}
+	token, expiry, err := p.login()
+	if err != nil {
+		return "", err
+	}
+	p.token = token
+	p.expiry = expiry
+	if expiry.IsZero() {
+		klog.Info("Obtained new access token")
+	} else {
+		klog.Info("Obtained new access token, valid until ", expiry.Format(time.RFC3339))
+	}
+	return token, nil
+}
+
+func (p *cachedTokenProvider) Invalidate() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.token = ""
+}
+
+// Send HTTP request authenticated by token from provider. If the request is rejected with 401 or 403,
+// the token is renewed and request is sent once more
+func SendAuthReq(req *http.Request, provider TokenProvider, auth func(req *http.Request, token string)) ([]byte, int) {
+	for attempt := 0; ; attempt++ {
+		token, err := provider.Token()
+		if err != nil {
+			klog.Error("Failed to get access token; err ", err)
+			return nil, -1
+		}
+		auth(req, token)
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				klog.Error("Can not resend request ", req.Method, " ", req.URL.Redacted(), "; error ", err)
+				return nil, -1
+			}
+			req.Body = body
+		}
+		respBody, statusCode := SendReq(req)
+		if (statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden) && attempt == 0 &&
+			(req.Body == nil || req.Body == http.NoBody || req.GetBody != nil) {
+			klog.Info("Request ", req.Method, " ", req.URL.Redacted(), " rejected with status ", statusCode, ", renewing token")
+			provider.Invalidate()
+			continue
+		}
+		return respBody, statusCode
+	}
+}
+
+// Watch mounted secrets for rotation. Kubernetes updates mounted secrets atomically, so we periodically
+// compare their content. When resource credentials change, tokens are invalidated and HTTP transport is rebuilt,
+// as they can hold CA bundle and client certificate. When TLS secret changes HTTP transport is rebuilt.
+// S3 credentials are read on every S3 access, so they are only reported
+func WatchCredentials(interval time.Duration, providers ...TokenProvider) {
+	if interval <= 0 {
+		interval = time.Duration(WATCH_INTERVAL) * time.Second
+	}
+	dirs := map[string]func(){
+		CREDS_DIR: func() {
+			rebuildTransport()
+			for _, p := range providers {
+				p.Invalidate()
+			}
+		},
+		TLS_DIR: rebuildTransport,
+		S3_DIR:  func() {},
+	}
+	hashes := make(map[string][32]byte)
+	for dir := range dirs {
+		hashes[dir] = hashDir(dir)
+	}
+	go func() {
+		for {
+			time.Sleep(interval)
+			for dir, changed := range dirs {
+				h := hashDir(dir)
+				if h != hashes[dir] {
+					klog.Info("Mounted secret ", dir, " changed, reloading")
+					hashes[dir] = h
+					changed()
+				}
+			}
+		}
+	}()
+}
+
+// Hash the content of mounted secret directory
+func hashDir(dir string) [32]byte {
+	hash := sha256.New()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return [32]byte{}
+	}
+	for _, entry := range entries {
+		// Skip Kubernetes internal ..data links and timestamped directories
+		if strings.HasPrefix(entry.Name(), "..") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		hash.Write([]byte(entry.Name()))
+		hash.Write(content)
+	}
+	var result [32]byte
+	copy(result[:], hash.Sum(nil))
+	return result
+}
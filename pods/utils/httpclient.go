@@ -0,0 +1,220 @@
+package podutils
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const (
+	// Defaults for HTTP client, used when ConfigMap does not define them
+	HTTP_TIMEOUT     = 10 // Timeout of a single request attempt (sec)
+	HTTP_RETRIES     = 3  // Maximum number of retries
+	HTTP_BACKOFF     = 1  // Initial backoff (sec)
+	HTTP_MAX_BACKOFF = 30 // Maximum backoff (sec)
+)
+
+// HTTP client settings
+type HTTPSettings struct {
+	Timeout    time.Duration // Timeout of a single request attempt
+	Retries    int           // Maximum number of retries
+	Backoff    time.Duration // Initial backoff, doubled on every retry
+	MaxBackoff time.Duration // Maximum backoff
+	Proxy      string        // Proxy URL of external resource and S3 access
+	NoProxy    string        // Comma separated hosts that are not proxied
+}
+
+var settings = HTTPSettings{
+	Timeout:    time.Duration(HTTP_TIMEOUT) * time.Second,
+	Retries:    HTTP_RETRIES,
+	Backoff:    time.Duration(HTTP_BACKOFF) * time.Second,
+	MaxBackoff: time.Duration(HTTP_MAX_BACKOFF) * time.Second,
+}
+
+var retries int64 // Number of retried HTTP requests
+
+// Configure HTTP client from the config map data
+func SetHTTPSettings(data map[string]string) {
+	if v, err := strconv.Atoi(data["http.timeout"]); err == nil && v > 0 {
+		settings.Timeout = time.Duration(v) * time.Second
+	}
+	if v, err := strconv.Atoi(data["http.retries"]); err == nil && v >= 0 {
+		settings.Retries = v
+	}
+	if v, err := strconv.Atoi(data["http.backoff"]); err == nil && v > 0 {
+		settings.Backoff = time.Duration(v) * time.Second
+	}
+	if v, err := strconv.Atoi(data["http.maxBackoff"]); err == nil && v > 0 {
+		settings.MaxBackoff = time.Duration(v) * time.Second
+	}
+	if len(data["http.proxy"]) > 0 {
+		settings.Proxy = data["http.proxy"]
+		settings.NoProxy = data["http.noProxy"]
+		proxy = proxyFunc(settings.Proxy, settings.NoProxy)
+		rebuildTransport()
+		klog.Info("HTTP proxy ", settings.Proxy, ", no proxy ", settings.NoProxy)
+	}
+	clientLock.Lock()
+	client.Timeout = settings.Timeout
+	clientLock.Unlock()
+	klog.Info("HTTP client timeout ", settings.Timeout, ", retries ", settings.Retries,
+		", backoff ", settings.Backoff, ", max backoff ", settings.MaxBackoff)
+}
+
+// Get the number of retried HTTP requests
+func HTTPRetries() int64 {
+	return atomic.LoadInt64(&retries)
+}
+
+// Send HTTP request
+func SendReq(req *http.Request) ([]byte, int) {
+	return SendReqWithTimeout(req, settings.Timeout)
+}
+
+// Send HTTP request with a specific timeout for every attempt. Idempotent requests are retried
+// on connection errors, 429 and 5xx. Other requests (POST submissions) are only retried when
+// we know that the server has not processed them - the connection was never established or 429
+func SendReqWithTimeout(req *http.Request, timeout time.Duration) ([]byte, int) {
+	clientLock.RLock()
+	c := client
+	clientLock.RUnlock()
+	c.Timeout = timeout
+	idempotent := isIdempotent(req)
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			// Rewind request body
+			if req.Body != nil && req.Body != http.NoBody {
+				if req.GetBody == nil {
+					klog.Error("Can not retry request ", req.Method, " ", req.URL.Redacted(), ", body can not be rewound")
+					return nil, -1
+				}
+				body, err := req.GetBody()
+				if err != nil {
+					klog.Error("Can not retry request ", req.Method, " ", req.URL.Redacted(), "; error ", err)
+					return nil, -1
+				}
+				req.Body = body
+			}
+		}
+
+		// Execute request
+		resp, err := c.Do(req)
+		if err != nil {
+			if attempt < settings.Retries && (isDialError(err) || (idempotent && isTransient(err))) {
+				retry(req, attempt, err.Error(), 0)
+				continue
+			}
+			klog.Error("Error invoking HTTP client; error ", err)
+			return nil, -1
+		}
+
+		// Process response
+		respBody, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			if attempt < settings.Retries && idempotent {
+				retry(req, attempt, err.Error(), 0)
+				continue
+			}
+			klog.Error("Error reading HTTP result; error ", err)
+			return nil, -1
+		}
+		if attempt < settings.Retries && isRetryableStatus(resp.StatusCode, idempotent) {
+			retry(req, attempt, resp.Status, retryAfter(resp))
+			continue
+		}
+		return respBody, resp.StatusCode
+	}
+}
+
+// Wait before the next attempt
+func retry(req *http.Request, attempt int, reason string, after time.Duration) {
+	wait := backoff(attempt)
+	if after > wait {
+		wait = after
+	}
+	if wait > settings.MaxBackoff {
+		wait = settings.MaxBackoff
+	}
+	atomic.AddInt64(&retries, 1)
+	klog.Info("Retrying request ", req.Method, " ", req.URL.Redacted(), " in ", wait, " (attempt ", attempt+1,
+		" of ", settings.Retries, "); reason ", reason)
+	time.Sleep(wait)
+}
+
+// Exponential backoff with full jitter
+func backoff(attempt int) time.Duration {
+	max := settings.Backoff << uint(attempt)
+	if max <= 0 || max > settings.MaxBackoff {
+		max = settings.MaxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(max)) + 1)
+}
+
+// Get wait time from the Retry-After header, either seconds or HTTP date
+func retryAfter(resp *http.Response) time.Duration {
+	header := resp.Header.Get("Retry-After")
+	if len(header) == 0 {
+		return 0
+	}
+	if secs, err := strconv.Atoi(header); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// Check whether request can be safely repeated
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	// Same convention as net/http transport
+	return len(req.Header.Get("Idempotency-Key")) > 0 || len(req.Header.Get("X-Idempotency-Key")) > 0
+}
+
+// Check whether status code is worth retrying
+func isRetryableStatus(status int, idempotent bool) bool {
+	if status == http.StatusTooManyRequests {
+		// Request was rejected before processing
+		return true
+	}
+	if !idempotent {
+		return false
+	}
+	return status == http.StatusInternalServerError || status == http.StatusBadGateway ||
+		status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+// Check whether connection to the server was never established, so request was never sent
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsTemporary
+}
+
+// Check for transient network errors
+func isTransient(err error) bool {
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,130 @@
+package podutils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Use HTTP client without InitUtils, with short backoffs. Settings are restored by cleanup
+func testSettings(t *testing.T, s HTTPSettings) {
+	saved := settings
+	settings = s
+	client = http.Client{Timeout: s.Timeout, Transport: newTransport()}
+	t.Cleanup(func() { settings = saved })
+}
+
+func TestSendReqRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		header     map[string]string
+		responses  []int  // Status of the responses in order, the last one repeats
+		retryAfter string // Retry-After of error responses
+		maxBackoff time.Duration
+		status     int           // Expected status
+		attempts   int32         // Expected number of requests
+		minElapsed time.Duration // Expected minimal duration
+		maxElapsed time.Duration // Expected maximal duration
+	}{
+		{name: "GET retried on 5xx", method: http.MethodGet, responses: []int{503, 502, 200},
+			status: 200, attempts: 3},
+		{name: "GET gives up after retries", method: http.MethodGet, responses: []int{500},
+			status: 500, attempts: 4},
+		{name: "POST not retried on 5xx", method: http.MethodPost, responses: []int{500, 200},
+			status: 500, attempts: 1},
+		{name: "POST retried on 429", method: http.MethodPost, responses: []int{429, 201},
+			status: 201, attempts: 2},
+		{name: "POST with idempotency key retried on 5xx", method: http.MethodPost,
+			header: map[string]string{"Idempotency-Key": "abc"}, responses: []int{503, 201}, status: 201, attempts: 2},
+		{name: "client errors not retried", method: http.MethodGet, responses: []int{404, 200},
+			status: 404, attempts: 1},
+		{name: "Retry-After honoured", method: http.MethodGet, responses: []int{503, 200}, retryAfter: "1",
+			maxBackoff: 5 * time.Second, status: 200, attempts: 2, minElapsed: time.Second},
+		{name: "Retry-After capped by max backoff", method: http.MethodGet, responses: []int{429, 200},
+			retryAfter: "60", maxBackoff: 100 * time.Millisecond, status: 200, attempts: 2,
+			minElapsed: 100 * time.Millisecond, maxElapsed: 5 * time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			maxBackoff := test.maxBackoff
+			if maxBackoff == 0 {
+				maxBackoff = 10 * time.Millisecond
+			}
+			testSettings(t, HTTPSettings{Timeout: 5 * time.Second, Retries: 3, Backoff: time.Millisecond, MaxBackoff: maxBackoff})
+			var attempts int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(atomic.AddInt32(&attempts, 1))
+				if n > len(test.responses) {
+					n = len(test.responses)
+				}
+				status := test.responses[n-1]
+				if status >= 400 && len(test.retryAfter) > 0 {
+					w.Header().Set("Retry-After", test.retryAfter)
+				}
+				w.WriteHeader(status)
+			}))
+			defer server.Close()
+
+			req, _ := http.NewRequest(test.method, server.URL, strings.NewReader("{}"))
+			for k, v := range test.header {
+				req.Header.Set(k, v)
+			}
+			start := time.Now()
+			_, status := SendReq(req)
+			elapsed := time.Since(start)
+			if status != test.status {
+				t.Errorf("expected status %d, got %d", test.status, status)
+			}
+			if attempts != test.attempts {
+				t.Errorf("expected %d attempts, got %d", test.attempts, attempts)
+			}
+			if elapsed < test.minElapsed || (test.maxElapsed > 0 && elapsed > test.maxElapsed) {
+				t.Errorf("unexpected duration %s", elapsed)
+			}
+		})
+	}
+}
+
+// Timed out requests are retried only if they are idempotent
+func TestSendReqTimeout(t *testing.T) {
+	tests := []struct {
+		method   string
+		attempts int32
+	}{
+		{http.MethodGet, 2},
+		{http.MethodPost, 1},
+	}
+	for _, test := range tests {
+		testSettings(t, HTTPSettings{Timeout: 5 * time.Second, Retries: 1, Backoff: time.Millisecond, MaxBackoff: time.Millisecond})
+		var attempts int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&attempts, 1)
+			time.Sleep(200 * time.Millisecond)
+		}))
+		req, _ := http.NewRequest(test.method, server.URL, strings.NewReader("{}"))
+		body, status := SendReqWithTimeout(req, 50*time.Millisecond)
+		server.Close()
+		if status != -1 || body != nil {
+			t.Errorf("%s: expected failure, got status %d", test.method, status)
+		}
+		if attempts != test.attempts {
+			t.Errorf("%s: expected %d attempts, got %d", test.method, test.attempts, attempts)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	testSettings(t, HTTPSettings{Backoff: time.Second, MaxBackoff: 5 * time.Second})
+	for attempt := 0; attempt < 70; attempt++ {
+		if wait := backoff(attempt); wait <= 0 || wait > settings.MaxBackoff {
+			t.Errorf("attempt %d: backoff %s out of range", attempt, wait)
+		}
+	}
+	if wait := backoff(1); wait > 2*time.Second {
+		t.Errorf("backoff %s over exponential bound", wait)
+	}
+}
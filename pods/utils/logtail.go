@@ -0,0 +1,171 @@
+package podutils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const (
+	LOG_TAIL     = 4096 // Default size of the output tail shown when tailing starts (bytes)
+	LOG_INTERVAL = 30   // Default interval of fetching job output (sec)
+)
+
+// Output stream of the remote job. Streams able to read the output from an offset set FetchFrom,
+// so that only new content is fetched once tailing started
+type LogStream struct {
+	Name  string                 // Stream name, prefixed to every line written to the pod log
+	Fetch func() ([]byte, error) // Get current content of the output
+	// Get content of the output from offset. Returns the content and its offset in the output,
+	// 0 if the whole output is returned. Content is empty if the output is shorter than offset
+	FetchFrom func(offset int64) ([]byte, int64, error)
+}
+
+// Tailed stream
+type logTailer struct {
+	stream  LogStream
+	offset  int64 // Length of the content already written
+	started bool  // Content was fetched at least once
+}
+
+var (
+	tailLock sync.Mutex
+	tailers  []*logTailer
+	tailSize           = LOG_TAIL
+	logOut   io.Writer = os.Stdout
+)
+
+// Start tailing remote job outputs to the pod stdout, so that they can be followed by kubectl logs.
+// Tailing is enabled by the config map (logs.interval, logs.tail). Streams are fetched in the background,
+// only content not yet written is printed
+func TailLogs(data map[string]string, streams ...LogStream) {
+	interval, err := strconv.Atoi(data["logs.interval"])
+	if err != nil || len(streams) == 0 {
+		return
+	}
+	if interval <= 0 {
+		interval = LOG_INTERVAL
+	}
+	tailLock.Lock()
+	if v, err := strconv.Atoi(data["logs.tail"]); err == nil && v >= 0 {
+		tailSize = v
+	}
+	started := len(tailers) > 0
+	for _, s := range streams {
+		tailers = append(tailers, &logTailer{stream: s})
+		klog.Info("Tailing job output ", s.Name, " every ", interval, " sec")
+	}
+	tailLock.Unlock()
+	if started {
+		return
+	}
+
+	go func() {
+		for {
+			time.Sleep(time.Duration(interval) * time.Second)
+			pollLogs(false)
+		}
+	}()
+}
+
+// Write the rest of all tailed streams, called when the job finishes
+func FlushLogs() {
+	pollLogs(true)
+}
+
+// Write new content of all tailed streams
+func pollLogs(final bool) {
+	tailLock.Lock()
+	defer tailLock.Unlock()
+	for _, t := range tailers {
+		t.poll(final)
+	}
+}
+
+// Fetch content not yet written. Streams reading from an offset are asked for the content from the byte
+// before it, so that output without new content can be told from truncated output, which is fetched whole
+func (t *logTailer) fetch() ([]byte, int64, error) {
+	if t.stream.FetchFrom == nil {
+		content, err := t.stream.Fetch()
+		return content, 0, err
+	}
+	start := t.offset - 1
+	if start < 0 {
+		start = 0
+	}
+	content, from, err := t.stream.FetchFrom(start)
+	if err == nil && from > 0 && from+int64(len(content)) < t.offset {
+		content, from, err = t.stream.FetchFrom(0)
+	}
+	return content, from, err
+}
+
+// Fetch stream and write content not yet written, prefixing every line with the stream name.
+// Incomplete last line is written only if final
+func (t *logTailer) poll(final bool) {
+	content, from, err := t.fetch()
+	if err != nil {
+		klog.V(2).Info("Failed to fetch job output ", t.stream.Name, "; err ", err)
+		return
+	}
+	size := from + int64(len(content))
+	if !t.started {
+		t.started = true
+		// Start from the tail, at the beginning of a line
+		if size > int64(tailSize) && from == 0 {
+			t.offset = size - int64(tailSize)
+			if i := bytes.IndexByte(content[t.offset:], '\n'); i >= 0 {
+				t.offset += int64(i) + 1
+			}
+			fmt.Fprintf(logOut, "[%s] ... %d bytes skipped\n", t.stream.Name, t.offset)
+		}
+	}
+	if size < t.offset || from > t.offset {
+		// Output was truncated, e.g. the job was requeued
+		fmt.Fprintf(logOut, "[%s] --- output restarted ---\n", t.stream.Name)
+		t.offset = from
+	}
+	// Only complete lines are written
+	rest := content[t.offset-from:]
+	end := bytes.LastIndexByte(rest, '\n')
+	next := end + 1
+	if final && next < len(rest) {
+		end, next = len(rest), len(rest)
+	}
+	if end < 0 {
+		return
+	}
+	for _, line := range bytes.Split(rest[:end], []byte("\n")) {
+		fmt.Fprintf(logOut, "[%s] %s\n", t.stream.Name, line)
+	}
+	t.offset += int64(next)
+}
+
+// Set range of request to the content from offset
+func SetRange(req *http.Request, offset int64) {
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+}
+
+// Get content and its offset from response to request with range set by SetRange. Servers ignoring
+// the range return the whole content, range beyond the end of the content gives no content.
+// Returns false for other responses
+func RangeContent(body []byte, statusCode int, offset int64) ([]byte, int64, bool) {
+	switch statusCode {
+	case http.StatusOK:
+		return body, 0, true
+	case http.StatusPartialContent:
+		return body, offset, true
+	case http.StatusRequestedRangeNotSatisfiable:
+		return nil, offset, true
+	}
+	return nil, 0, false
+}
@@ -0,0 +1,119 @@
+package podutils
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// Remote job output, read whole or from an offset
+type fakeOutput struct {
+	content  string
+	requests []int64
+}
+
+func (o *fakeOutput) fetch() ([]byte, error) {
+	return []byte(o.content), nil
+}
+
+func (o *fakeOutput) fetchFrom(offset int64) ([]byte, int64, error) {
+	o.requests = append(o.requests, offset)
+	if offset > int64(len(o.content)) {
+		return nil, offset, nil
+	}
+	return []byte(o.content[offset:]), offset, nil
+}
+
+// Tailing starts with the tail at a line start, writes complete lines only until the final flush
+// and starts over when the output is truncated, whether the stream is fetched whole or from an offset
+func TestLogTailerPoll(t *testing.T) {
+	steps := []struct {
+		content string
+		final   bool
+		written string
+	}{
+		{"line 1\nline 2\nline 3\nline 4\npart", false, "[out] ... 21 bytes skipped\n[out] line 4\n"},
+		{"line 1\nline 2\nline 3\nline 4\npart", false, ""},
+		{"line 1\nline 2\nline 3\nline 4\npartial\nline 6\n", false, "[out] partial\n[out] line 6\n"},
+		{"line 1\nline 2\nline 3\nline 4\npartial\nline 6\n", false, ""},
+		{"again 1\n", false, "[out] --- output restarted ---\n[out] again 1\n"},
+		{"again 1\nagain 2\nlast", false, "[out] again 2\n"},
+		{"again 1\nagain 2\nlast", true, "[out] last\n"},
+		{"again 1\nagain 2\nlast", true, ""},
+	}
+	savedOut, savedSize := logOut, tailSize
+	defer func() { logOut, tailSize = savedOut, savedSize }()
+	tailSize = 16
+
+	for _, ranged := range []bool{false, true} {
+		output := &fakeOutput{}
+		stream := LogStream{Name: "out", Fetch: output.fetch}
+		if ranged {
+			stream.FetchFrom = output.fetchFrom
+		}
+		tailer := &logTailer{stream: stream}
+		for i, step := range steps {
+			written := &bytes.Buffer{}
+			logOut = written
+			output.content = step.content
+			tailer.poll(step.final)
+			if written.String() != step.written {
+				t.Errorf("ranged %v, step %d: got %q, expected %q", ranged, i, written.String(), step.written)
+			}
+		}
+		if ranged {
+			// Byte before the offset is fetched, truncated output is fetched again whole
+			expected := []int64{0, 27, 27, 42, 42, 0, 7, 15, 19}
+			if !reflect.DeepEqual(output.requests, expected) {
+				t.Errorf("got requests from %v, expected %v", output.requests, expected)
+			}
+		}
+	}
+}
+
+// Streams shorter than the tail are written whole
+func TestLogTailerShortStream(t *testing.T) {
+	savedOut, savedSize := logOut, tailSize
+	defer func() { logOut, tailSize = savedOut, savedSize }()
+	tailSize = 4096
+	written := &bytes.Buffer{}
+	logOut = written
+
+	output := &fakeOutput{content: "line 1\nline 2\n"}
+	tailer := &logTailer{stream: LogStream{Name: "err", FetchFrom: output.fetchFrom}}
+	tailer.poll(false)
+	if written.String() != "[err] line 1\n[err] line 2\n" {
+		t.Errorf("unexpected output %q", written.String())
+	}
+}
+
+func TestRangeContent(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		content    string
+		from       int64
+		ok         bool
+	}{
+		{http.StatusOK, "whole", 0, true},
+		{http.StatusPartialContent, "whole", 10, true},
+		{http.StatusRequestedRangeNotSatisfiable, "", 10, true},
+		{http.StatusNotFound, "", 0, false},
+	}
+	for _, test := range tests {
+		content, from, ok := RangeContent([]byte("whole"), test.statusCode, 10)
+		if string(content) != test.content || from != test.from || ok != test.ok {
+			t.Errorf("%d: got %q, %d, %v", test.statusCode, content, from, ok)
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/out", nil)
+	SetRange(req, 0)
+	if req.Header.Get("Range") != "" {
+		t.Errorf("unexpected range %s", req.Header.Get("Range"))
+	}
+	SetRange(req, 42)
+	if req.Header.Get("Range") != "bytes=42-" {
+		t.Errorf("unexpected range %s", req.Header.Get("Range"))
+	}
+}
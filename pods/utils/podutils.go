@@ -9,6 +9,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"k8s.io/klog"
@@ -32,6 +33,8 @@ const (
 var JOB_NAME string                 // Job name
 var NAMESPACE string                // Namespace
 var client http.Client              // HTTP client
+var transport *http.Transport       // HTTP transport shared by HTTP and S3 clients
+var clientLock sync.RWMutex         // Protects HTTP client and transport, which are rebuilt on TLS rotation
 var clientset *kubernetes.Clientset // Kubernetes clienset
 
 // Upload file definition
@@ -64,26 +67,9 @@ func InitUtils(job string, ns string) {
 	}
 	clientset = clients
 
-	// Create HTTP Client
-	client = http.Client{Timeout: time.Duration(10) * time.Second}
-}
-
-// Send HTTP request
-func SendReq(req *http.Request) ([]byte, int) {
-	// Execute request
-	resp, err := client.Do(req)
-	if err != nil {
-		klog.Error("Error invoking HTTP client; error ", err)
-		return nil, -1
-	}
-	defer resp.Body.Close()
-	// Process response
-	respBody, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		klog.Error("Error reading HTTP result; error ", err)
-		return nil, -1
-	}
-	return respBody, resp.StatusCode
+	// Create HTTP Client. Settings can be changed later by SetHTTPSettings
+	transport = newTransport()
+	client = http.Client{Timeout: settings.Timeout, Transport: transport}
 }
 
 // Get config map
@@ -103,6 +89,11 @@ func GetConfigMap() *v1.ConfigMap {
 func UpdateConfigMap(cm *v1.ConfigMap, info map[string]string) {
 	change := false
 
+	// Report HTTP retries
+	if r := HTTPRetries(); r > 0 {
+		info["metrics.httpRetries"] = strconv.FormatInt(r, 10)
+	}
+
 	// Check if the information changed
 	for k, v := range info {
 		val := cm.Data[k]
@@ -157,9 +148,12 @@ func ReadMountedFileContent(path string) string {
 func getMinioClient(endpoint string, secure bool) (*minio.Client, error) {
 	accessKey := ReadMountedFileContent(S3_DIR + "accesskey")
 	secretKey := ReadMountedFileContent(S3_DIR + "secretkey")
+	clientLock.RLock()
+	defer clientLock.RUnlock()
 	minioClient, err := minio.New(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
-		Secure: secure,
+		Creds:     credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure:    secure,
+		Transport: transport,
 	})
 	if err != nil {
 		return nil, err
@@ -239,6 +233,29 @@ func UploadS3Data(data map[string]string, info map[string]string, objects []Uplo
 	}
 }
 
+// Create presigned URL for downloading S3 object, valid for the given duration
+func PresignS3Object(bucket string, object string, expiry time.Duration, data map[string]string) (string, error) {
+	// Create Minio client
+	secure, _ := strconv.ParseBool(data["s3.secure"])
+	minioClient, err := getMinioClient(data["s3.endpoint"], secure)
+	if err != nil {
+		klog.Info("Error while getting S3 client; err ", err.Error())
+		return "", err
+	}
+	// Presign object
+	u, err := minioClient.PresignedGetObject(context.Background(), bucket, object, expiry, nil)
+	if err != nil {
+		klog.Info("Error presigning S3 bucket ", bucket, " object ", object, " ; err ", err.Error())
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// Quote string for use in shell command
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
 func UploadS3DataDisk(data map[string]string, objects []UploadFileLocation) error {
 
 	// Create client
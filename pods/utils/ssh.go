@@ -0,0 +1,202 @@
+package podutils
+
+import (
+	"bytes"
+	e "errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"k8s.io/klog"
+)
+
+const (
+	SSH_PORT    = "22"
+	SSH_TIMEOUT = 30 // Connection timeout (sec)
+)
+
+// SSH connection to a login (submit) node of batch systems without an HTTP API.
+// Commands are run in a login shell, so that the environment of the user is set up.
+// Credentials are read from the mounted resource secret:
+//   - username - user on the login node
+//   - password - password, used if there is no private key or it is not accepted
+//   - privatekey - private key (PEM/OpenSSH), optionally protected by passphrase
+//   - knownhosts - known_hosts entries of the login node, required to verify its host key
+//   - insecureskiphostkey - "true" to connect without host key verification if there are no known hosts
+//
+// The connection is reopened, with credentials read again, when it breaks
+type SSHClient struct {
+	Address  string // host:port of the login node
+	credsDir string
+	lock     sync.Mutex
+	client   *ssh.Client
+}
+
+// Command failed on the login node
+type CommandError struct {
+	Status int
+	Stderr string
+}
+
+func (err *CommandError) Error() string {
+	return fmt.Sprintf("exit status %d: %s", err.Status, err.Stderr)
+}
+
+// Create SSH client for resource URL (ssh://host[:port] or host[:port]) with credentials in the given directory.
+// The connection is opened by the first command
+func NewSSHClient(resourceURL string, credsDir string) *SSHClient {
+	address := strings.TrimSuffix(strings.TrimPrefix(resourceURL, "ssh://"), "/")
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, SSH_PORT)
+	}
+	return &SSHClient{Address: address, credsDir: credsDir}
+}
+
+// Read optional credential
+func (c *SSHClient) readCred(key string) string {
+	content, err := os.ReadFile(c.credsDir + key)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// Build SSH client configuration from the credentials
+func (c *SSHClient) config() (*ssh.ClientConfig, error) {
+	config := &ssh.ClientConfig{User: c.readCred("username"), Timeout: SSH_TIMEOUT * time.Second}
+	if len(config.User) == 0 {
+		return nil, e.New("username missing in resource secret")
+	}
+	if key := c.readCred("privatekey"); len(key) > 0 {
+		var signer ssh.Signer
+		var err error
+		if passphrase := c.readCred("passphrase"); len(passphrase) > 0 {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(key), []byte(passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey([]byte(key))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key; err %s", err.Error())
+		}
+		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
+	}
+	if password := c.readCred("password"); len(password) > 0 {
+		config.Auth = append(config.Auth, ssh.Password(password))
+	}
+	if len(config.Auth) == 0 {
+		return nil, e.New("password or private key missing in resource secret")
+	}
+	if _, err := os.Stat(c.credsDir + "knownhosts"); err == nil {
+		callback, err := knownhosts.New(c.credsDir + "knownhosts")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse known hosts; err %s", err.Error())
+		}
+		config.HostKeyCallback = callback
+	} else if c.readCred("insecureskiphostkey") == "true" {
+		klog.Warning("Host key verification disabled by resource secret, host key of the login node is not verified")
+		config.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+	} else {
+		return nil, e.New("known hosts missing in resource secret, set knownhosts or insecureskiphostkey")
+	}
+	return config, nil
+}
+
+// Get SSH connection to the login node, opening it if needed
+func (c *SSHClient) connection() (*ssh.Client, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.client != nil {
+		return c.client, nil
+	}
+	config, err := c.config()
+	if err != nil {
+		return nil, err
+	}
+	client, err := ssh.Dial("tcp", c.Address, config)
+	if err != nil {
+		return nil, err
+	}
+	klog.Info("Connected to ", c.Address, " as ", config.User)
+	c.client = client
+	return c.client, nil
+}
+
+// Close broken connection, the next command opens a new one
+func (c *SSHClient) disconnect(client *ssh.Client) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.client == client {
+		c.client.Close()
+		c.client = nil
+	}
+}
+
+// Check that the login node can be reached with the credentials
+func (c *SSHClient) Connect() error {
+	_, err := c.connection()
+	return err
+}
+
+// Run command in login shell on the login node, with stdin if not nil. Returns stdout.
+// Commands exiting with non zero status return CommandError with their stderr
+func (c *SSHClient) Run(command string, stdin io.Reader) ([]byte, error) {
+	client, err := c.connection()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s; err %s", c.Address, err.Error())
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		c.disconnect(client)
+		return nil, fmt.Errorf("failed to open SSH session; err %s", err.Error())
+	}
+	defer session.Close()
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	session.Stdout, session.Stderr = stdout, stderr
+	if stdin != nil {
+		session.Stdin = stdin
+	}
+	err = session.Run("bash -lc " + ShellQuote(command))
+	if err != nil {
+		exitErr := &ssh.ExitError{}
+		if e.As(err, &exitErr) {
+			return stdout.Bytes(), &CommandError{Status: exitErr.ExitStatus(), Stderr: strings.TrimSpace(stderr.String())}
+		}
+		c.disconnect(client)
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// Read file on the login node
+func (c *SSHClient) FetchFile(path string) ([]byte, error) {
+	return c.Run("cat -- "+ShellQuote(path), nil)
+}
+
+// Read file on the login node from offset. Returns the content and its offset, content is empty
+// if the file is shorter than offset
+func (c *SSHClient) FetchFileFrom(path string, offset int64) ([]byte, int64, error) {
+	if offset <= 0 {
+		content, err := c.FetchFile(path)
+		return content, 0, err
+	}
+	content, err := c.Run(fmt.Sprintf("tail -c +%d -- %s", offset+1, ShellQuote(path)), nil)
+	return content, offset, err
+}
+
+// Write file on the login node, parent directories are created
+func (c *SSHClient) PushFile(path string, content []byte) error {
+	dir := path[:strings.LastIndex(path, "/")+1]
+	command := "cat > " + ShellQuote(path)
+	if len(dir) > 1 {
+		command = "mkdir -p -- " + ShellQuote(dir) + " && " + command
+	}
+	_, err := c.Run(command, bytes.NewReader(content))
+	return err
+}
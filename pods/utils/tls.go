@@ -0,0 +1,113 @@
+package podutils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+
+	"k8s.io/klog"
+)
+
+const (
+	TLS_DIR   = "/tls/"         // Mounted TLS secret
+	CREDS_DIR = "/credentials/" // Mounted resource credentials secret
+
+	CA_FILE   = "ca.crt"  // CA bundle
+	CERT_FILE = "tls.crt" // Client certificate
+	KEY_FILE  = "tls.key" // Client key
+)
+
+// Proxy of external resource and S3 access, set from the config map by SetHTTPSettings.
+// Environment proxy settings are used if not set
+var proxy = http.ProxyFromEnvironment
+
+// Create HTTP transport used for both external resource and S3 access
+func newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+	transport.TLSClientConfig = tlsConfig()
+	return transport
+}
+
+// Rebuild HTTP transport, when TLS or proxy settings change
+func rebuildTransport() {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	if transport != nil {
+		transport.CloseIdleConnections()
+	}
+	transport = newTransport()
+	client.Transport = transport
+}
+
+// Build proxy function for proxy URL and comma separated hosts that are not proxied.
+// The Kubernetes API server and cluster services are never proxied
+func proxyFunc(proxyURL string, noProxy string) func(*http.Request) (*url.URL, error) {
+	exclude := []string{".svc", ".cluster.local"}
+	if host := os.Getenv("KUBERNETES_SERVICE_HOST"); len(host) > 0 {
+		exclude = append(exclude, host)
+	}
+	if len(strings.TrimSpace(noProxy)) > 0 {
+		exclude = append(exclude, noProxy)
+	}
+	config := httpproxy.Config{HTTPProxy: proxyURL, HTTPSProxy: proxyURL, NoProxy: strings.Join(exclude, ",")}
+	fn := config.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return fn(req.URL)
+	}
+}
+
+// Build TLS configuration from the mounted TLS secret or resource credentials secret.
+// CA bundles (ca.crt) are added to the system pool, client certificate (tls.crt, tls.key) is used for mTLS
+func tlsConfig() *tls.Config {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	// CA bundles
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	custom := false
+	for _, dir := range []string{TLS_DIR, CREDS_DIR} {
+		pem, err := os.ReadFile(dir + CA_FILE)
+		if err != nil {
+			continue
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			klog.Error("No valid certificates found in ", dir+CA_FILE)
+			continue
+		}
+		klog.Info("Using CA bundle ", dir+CA_FILE)
+		custom = true
+	}
+	if custom {
+		config.RootCAs = pool
+	}
+
+	// Client certificate
+	for _, dir := range []string{TLS_DIR, CREDS_DIR} {
+		if !fileExists(dir+CERT_FILE) || !fileExists(dir+KEY_FILE) {
+			continue
+		}
+		cert, err := tls.LoadX509KeyPair(dir+CERT_FILE, dir+KEY_FILE)
+		if err != nil {
+			klog.Error("Failed to load client certificate from ", dir, "; err ", err)
+			continue
+		}
+		klog.Info("Using client certificate ", dir+CERT_FILE)
+		config.Certificates = []tls.Certificate{cert}
+		break
+	}
+	return config
+}
+
+// Check if file exists
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
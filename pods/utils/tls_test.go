@@ -0,0 +1,27 @@
+package podutils
+
+import (
+	"net/http"
+	"testing"
+)
+
+// Cluster services and hosts listed in no proxy are not proxied
+func TestProxyFunc(t *testing.T) {
+	fn := proxyFunc("http://proxy.mycompany.com:3128", "minio.mycompany.com")
+	tests := map[string]bool{
+		"https://lsf.mycompany.com/platform/":              true,
+		"https://minio.mycompany.com/bucket":               false,
+		"https://minio.default.svc:9000/":                  false,
+		"https://kubernetes.default.svc.cluster.local/api": false,
+	}
+	for target, proxied := range tests {
+		req, _ := http.NewRequest(http.MethodGet, target, nil)
+		proxyURL, err := fn(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (proxyURL != nil) != proxied {
+			t.Errorf("%s: expected proxied %t, got %v", target, proxied, proxyURL)
+		}
+	}
+}
@@ -1,10 +1,10 @@
 .PHONY: build
 build: fmt vet test ## Build pod executable binary
-	go build -o bin/${EXECUTABLE_NAME} main.go
+	go build -o bin/${EXECUTABLE_NAME} .
 
 .PHONY: run
 run: build ## Run the pod executable from your host.
-	go run ./main.go
+	go run .
 
 .PHONY: test
 test: fmt vet ## Run pod test tests for the pods